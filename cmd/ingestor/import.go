@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/raphaelreis/go-event-ingestor/internal/config"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/raphaelreis/go-event-ingestor/pkg/logger"
+)
+
+// importJobNamespace derives default job IDs from the file location.
+var importJobNamespace = uuid.MustParse("3c1f6a52-9e0b-4d7f-8a2e-6b5d4c3f2e10")
+
+type importOptions struct {
+	source       string
+	file         string
+	customer     string
+	dataset      string
+	period       string
+	jobID        string
+	workers      int
+	batchSize    int
+	parseWorkers int
+	rateLimit    float64
+	schema       string
+	mapping      string
+	rejects      string
+	keyColumn    string
+	previous     string
+	diff         bool
+	format       csv.Format
+	noHeader     bool
+	maxErrors    int
+	noQuarantine bool
+	resume       bool
+	dryRun       bool
+	report       string
+	interval     time.Duration
+}
+
+// runImport implements `ingestor import`, which ingests one bulk file through
+// csv.Pipeline and returns the process exit code.
+func runImport(args []string) int {
+	var opts importOptions
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&opts.source, "source", ".", "directory the file paths are relative to, or s3://<bucket>")
+	fs.StringVar(&opts.file, "file", "", "path of the file within the source")
+	fs.StringVar(&opts.customer, "customer", "", "customer ID of the dataset to import, instead of --file")
+	fs.StringVar(&opts.dataset, "dataset", "", "dataset to import through its manifest, instead of --file")
+	fs.StringVar(&opts.period, "period", "", "period of the dataset as YYYY-MM; defaults to the current version")
+	fs.StringVar(&opts.jobID, "job-id", "", "ID of the import in event IDs and lineage headers; defaults to one derived from the file")
+	fs.IntVar(&opts.workers, "workers", 4, "number of concurrent publishers")
+	fs.IntVar(&opts.batchSize, "batch-size", 100, "rows per batch")
+	fs.IntVar(&opts.parseWorkers, "parse-workers", 1, "number of chunks of a large local file parsed concurrently")
+	fs.Float64Var(&opts.rateLimit, "rate-limit", 0, "maximum rows per second; 0 is unlimited")
+	fs.StringVar(&opts.schema, "schema", "", "JSON schema file typing and validating columns")
+	fs.StringVar(&opts.mapping, "mapping", "", "JSON mapping file renaming and dropping columns")
+	fs.StringVar(&opts.rejects, "rejects", "", "file receiving invalid rows as JSON lines")
+	fs.StringVar(&opts.keyColumn, "key-column", "", "column used as Kafka key")
+	fs.StringVar(&opts.previous, "previous", "", "previous version of --file; only rows changed since are published, keyed by --key-column")
+	fs.BoolVar(&opts.diff, "diff", false, "publish only the rows of --dataset changed since the previous month, keyed by --key-column")
+	fs.StringVar(&opts.format.Type, "format", "", "csv, jsonl or parquet; defaults to the file extension")
+	fs.StringVar(&opts.format.Delimiter, "delimiter", "", "field delimiter of delimited text; defaults to a comma, or a tab for .tsv files")
+	fs.StringVar(&opts.format.Quote, "quote", "", "quote character of delimited text; defaults to a double quote")
+	fs.StringVar(&opts.format.Comment, "comment", "", "character starting comment lines in delimited text")
+	fs.BoolVar(&opts.format.LazyQuotes, "lazy-quotes", false, "accept stray quotes in delimited text")
+	fs.BoolVar(&opts.noHeader, "no-header", false, "the first row is data, not column names")
+	fs.IntVar(&opts.maxErrors, "max-errors", 0, "fail once more rows are invalid or malformed; 0 allows any number")
+	fs.BoolVar(&opts.noQuarantine, "no-quarantine", false, "do not write rejected rows and the run report next to the file")
+	fs.BoolVar(&opts.resume, "resume", false, "continue from the checkpoint of a previous import of the file")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "validate every row, the uniqueness of --key-column and the checksum without publishing or checkpointing")
+	fs.StringVar(&opts.report, "report", "", "file receiving the JSON report of the run, - for stdout")
+	fs.DurationVar(&opts.interval, "progress-interval", 2*time.Second, "how often progress is printed")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		fs.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := importFile(ctx, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (o importOptions) validate() error {
+	switch {
+	case o.file == "" && o.dataset == "":
+		return errors.New("--file or --dataset is required")
+	case o.file != "" && o.dataset != "":
+		return errors.New("--file and --dataset are mutually exclusive")
+	case o.dataset != "" && o.customer == "":
+		return errors.New("--dataset requires --customer")
+	case o.period != "" && o.dataset == "":
+		return errors.New("--period requires --dataset")
+	case o.workers < 1 || o.batchSize < 1:
+		return errors.New("--workers and --batch-size must be positive")
+	case o.parseWorkers < 1:
+		return errors.New("--parse-workers must be positive")
+	case o.rateLimit < 0:
+		return errors.New("--rate-limit must not be negative")
+	case o.diff && o.dataset == "":
+		return errors.New("--diff requires --dataset")
+	case o.previous != "" && o.file == "":
+		return errors.New("--previous requires --file")
+	case (o.diff || o.previous != "") && o.keyColumn == "":
+		return errors.New("--diff and --previous require --key-column")
+	}
+	return o.format.Validate()
+}
+
+func importFile(ctx context.Context, opts importOptions) error {
+	cfg := config.LoadFromEnv()
+	log := logger.New(cfg.LogLevel)
+	mets := metrics.New()
+
+	base, err := newFileSource(cfg, opts.source)
+	if err != nil {
+		return err
+	}
+
+	var source csv.FileSource = base
+	path := opts.file
+	if opts.dataset != "" {
+		ref := dataset.Ref{CustomerID: opts.customer, Dataset: opts.dataset}
+		if opts.period != "" {
+			if ref.Year, ref.Month, err = parsePeriod(opts.period); err != nil {
+				return err
+			}
+		}
+		resolver := dataset.NewResolver(base)
+		resolved, err := resolver.Resolve(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve dataset: %w", err)
+		}
+		path = resolved.FilePath
+		source = dataset.VerifyingSource(base, resolved)
+		if opts.diff {
+			previous, err := resolver.Previous(ctx, resolved)
+			if err != nil {
+				return fmt.Errorf("failed to resolve previous version: %w", err)
+			}
+			opts.previous = previous.FilePath
+		}
+	}
+
+	pipelineCfg := csv.Config{
+		FilePath:     path,
+		WorkerCount:  opts.workers,
+		BatchSize:    opts.batchSize,
+		ParseWorkers: opts.parseWorkers,
+		RateLimit:    opts.rateLimit,
+		Format:       opts.format,
+		NoHeader:     opts.noHeader,
+		MaxErrors:    opts.maxErrors,
+		KeyColumn:    opts.keyColumn,
+		Previous:     opts.previous,
+		JobID:        opts.jobID,
+		Dataset:      opts.dataset,
+		ValidateOnly: opts.dryRun,
+	}
+	if pipelineCfg.JobID == "" {
+		pipelineCfg.JobID = uuid.NewSHA1(importJobNamespace, []byte(opts.source+"\x00"+path)).String()
+	}
+	if opts.schema != "" {
+		if pipelineCfg.Schema, err = csv.LoadSchema(opts.schema); err != nil {
+			return err
+		}
+	}
+	if opts.mapping != "" {
+		if pipelineCfg.Mapping, err = csv.LoadMapping(opts.mapping); err != nil {
+			return err
+		}
+	}
+
+	progress := newProgress()
+	if sizer, ok := base.(interface {
+		Size(ctx context.Context, path string) (int64, error)
+	}); ok {
+		if size, err := sizer.Size(ctx, path); err == nil {
+			progress.total = size
+		}
+	}
+	source = &progressSource{FileSource: source, progress: progress, path: path}
+
+	var rejects csv.RejectSink
+	if opts.rejects != "" {
+		f, err := os.Create(opts.rejects)
+		if err != nil {
+			return fmt.Errorf("failed to create rejects file: %w", err)
+		}
+		defer f.Close()
+		rejects = csv.NewJSONRejectWriter(f)
+	}
+	if q, ok := base.(interface {
+		Quarantine(ctx context.Context, path string) (*storage.Quarantine, error)
+	}); ok && !opts.noQuarantine && !opts.dryRun {
+		quarantine, err := q.Quarantine(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := quarantine.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to close quarantine: %v\n", err)
+			}
+		}()
+		rejects = csv.TeeRejects(rejects, quarantine)
+		pipelineCfg.Reports = quarantine
+	}
+	pipelineCfg.Rejects = &countingRejects{RejectSink: rejects, progress: progress}
+	reports := &reportWriter{path: opts.report, next: pipelineCfg.Reports}
+	pipelineCfg.Reports = reports
+
+	var producer kafka.Producer
+	if opts.dryRun {
+		producer = discardProducer{}
+	} else {
+		serializer, err := newSerializer(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialise serializer: %w", err)
+		}
+		if producer, err = newProducer(cfg, serializer, log, mets); err != nil {
+			return err
+		}
+		defer producer.Close()
+
+		if opts.resume {
+			if completed, err := importCompleted(ctx, base, path); err != nil || completed {
+				if completed {
+					fmt.Fprintf(os.Stderr, "%s was already imported completely, nothing to resume\n", path)
+				}
+				return err
+			}
+		}
+		if err := checkResume(ctx, source, producer, pipelineCfg.JobID, path, opts.resume); err != nil {
+			return err
+		}
+	}
+
+	pipeline := csv.NewPipeline(source, countProducer(producer, progress), log, mets)
+	done := make(chan struct{})
+	go progress.report(os.Stderr, opts.interval, done)
+	err = pipeline.Process(ctx, pipelineCfg)
+	close(done)
+
+	progress.print(os.Stderr)
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted, rerun with --resume to continue: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	if v := reports.last.Validation; v != nil {
+		fmt.Fprintf(os.Stderr, "dry run: %d rows valid, %d rejected, %d duplicate keys, nothing published\n",
+			v.RowsValid, v.RowsRead-v.RowsValid, v.DuplicateKeys)
+	}
+	return nil
+}
+
+// checkResume refuses to import a file that was partially imported unless
+// resume is set, since starting over would publish its rows twice. A file
+// whose import completed is imported again from the start.
+func checkResume(ctx context.Context, source csv.FileSource, producer kafka.Producer, jobID, path string, resume bool) error {
+	if resume {
+		return nil
+	}
+	offset, err := source.ResumeOffset(ctx, path)
+	if err != nil {
+		return err
+	}
+	row := offset.Row
+	if publisher, ok := producer.(kafka.BatchPublisher); ok {
+		checkpointSource := csv.CheckpointSource(jobID, path)
+		committed, err := publisher.LastCheckpoint(ctx, checkpointSource)
+		if err != nil {
+			return fmt.Errorf("failed to load committed checkpoint: %w", err)
+		}
+		if committed.Completed {
+			return restart(ctx, source, publisher, checkpointSource, path)
+		}
+		row = max(row, committed.Offset)
+	}
+	if row > 0 {
+		return fmt.Errorf("%s was already imported up to row %d, pass --resume to continue it", path, row)
+	}
+	return nil
+}
+
+// importCompleted reports whether the import of path completed, when source
+// keeps track of it.
+func importCompleted(ctx context.Context, source csv.FileSource, path string) (bool, error) {
+	completion, ok := source.(interface {
+		Completed(ctx context.Context, path string) (bool, error)
+	})
+	if !ok {
+		return false, nil
+	}
+	return completion.Completed(ctx, path)
+}
+
+// restart resets the checkpoints of path, committing one back at its start.
+func restart(ctx context.Context, source csv.FileSource, publisher kafka.BatchPublisher, checkpointSource, path string) error {
+	if err := publisher.PublishBatch(ctx, kafka.Batch{Checkpoint: kafka.Checkpoint{Source: checkpointSource}}); err != nil {
+		return fmt.Errorf("failed to reset committed checkpoint: %w", err)
+	}
+	if err := source.Checkpoint(ctx, path, csv.Offset{}); err != nil {
+		return fmt.Errorf("failed to reset checkpoint: %w", err)
+	}
+	return nil
+}
+
+func newFileSource(cfg *config.Config, source string) (csv.FileSource, error) {
+	bucket, ok := strings.CutPrefix(source, "s3://")
+	if !ok {
+		return storage.NewLocalSource(source), nil
+	}
+	return storage.NewS3Source(storage.S3Config{
+		Endpoint:  cfg.S3Endpoint,
+		Region:    cfg.S3Region,
+		Bucket:    strings.TrimSuffix(bucket, "/"),
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+		UseSSL:    cfg.S3UseSSL,
+	})
+}
+
+func parsePeriod(period string) (year, month int, err error) {
+	y, m, ok := strings.Cut(period, "-")
+	if ok {
+		year, err = strconv.Atoi(y)
+	}
+	if ok && err == nil {
+		month, err = strconv.Atoi(m)
+	}
+	if !ok || err != nil || year < 1 || month < 1 || month > 12 {
+		return 0, 0, fmt.Errorf("invalid period %q, expected YYYY-MM", period)
+	}
+	return year, month, nil
+}
+
+// reportWriter writes the report of the run as JSON to path, - for stdout,
+// after handing it to next, if any.
+type reportWriter struct {
+	path string
+	next csv.ReportSink
+	last csv.Report
+}
+
+func (w *reportWriter) WriteReport(ctx context.Context, r csv.Report) error {
+	w.last = r
+	if w.next != nil {
+		if err := w.next.WriteReport(ctx, r); err != nil {
+			return err
+		}
+	}
+	if w.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	data = append(data, '\n')
+	if w.path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(w.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// discardProducer accepts every event, for dry runs.
+type discardProducer struct{}
+
+func (discardProducer) Publish(ctx context.Context, event model.Event) error { return nil }
+
+func (discardProducer) Close() error { return nil }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/config"
+	internalHttp "github.com/raphaelreis/go-event-ingestor/internal/http"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+)
+
+// startJobs runs the bulk import job manager, the stale job supervisor and
+// the triggers configured: the watcher of new files when
+// JOBS_WATCH_INTERVAL is set, the consumer of bucket notifications when
+// JOBS_NOTIFY_TOPIC is. It registers the job API, along with the
+// notification webhook when JOBS_NOTIFY_TOKEN is set, and returns the
+// function stopping them.
+func startJobs(cfg *config.Config, producer kafka.Producer, log *slog.Logger, mets *metrics.Metrics, mux *http.ServeMux) (func(), error) {
+	ctx := context.Background()
+	store, err := openJobStore(ctx, cfg.JobsDatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	source, err := newFileSource(cfg, cfg.JobsSource)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	runner := jobs.NewRunner(store, source, producer, log, mets)
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		MaxConcurrent: cfg.JobsMaxConcurrent,
+		Pipeline:      csv.Config{WorkerCount: cfg.WorkerPoolSize, BatchSize: 100},
+	}, log)
+	supervisor := jobs.NewSupervisor(manager, jobs.SupervisorConfig{
+		StaleAfter: cfg.JobsStaleAfter,
+	}, log)
+
+	var watcher *jobs.Watcher
+	if cfg.JobsWatchInterval > 0 {
+		watchSource, ok := source.(jobs.WatchSource)
+		if !ok {
+			store.Close()
+			return nil, errors.New("jobs source cannot be watched")
+		}
+		watcher = jobs.NewWatcher(watchSource, manager, jobs.WatcherConfig{
+			Prefix:       cfg.JobsWatchPrefix,
+			PollInterval: cfg.JobsWatchInterval,
+			StableFor:    cfg.JobsWatchStableFor,
+		}, log)
+	}
+
+	var trigger *jobs.Trigger
+	if cfg.JobsNotifyTopic != "" || cfg.JobsNotifyToken != "" {
+		completionSource, ok := source.(jobs.CompletionSource)
+		if !ok {
+			store.Close()
+			return nil, errors.New("jobs source cannot be triggered by notifications")
+		}
+		// Notifications of any bucket trigger imports from a directory.
+		var bucket string
+		if b, ok := strings.CutPrefix(cfg.JobsSource, "s3://"); ok {
+			bucket = strings.TrimSuffix(b, "/")
+		}
+		trigger = jobs.NewTrigger(completionSource, manager, jobs.TriggerConfig{
+			Bucket: bucket,
+			Prefix: cfg.JobsNotifyPrefix,
+		}, log)
+	}
+
+	runCtx, stopRunning := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	run := func(name string, fn func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(runCtx); err != nil {
+				log.Error(name+" stopped", "error", err)
+			}
+		}()
+	}
+	run("Job supervisor", supervisor.Run)
+	if watcher != nil {
+		run("File watcher", watcher.Run)
+	}
+	if cfg.JobsNotifyTopic != "" {
+		consumer := kafka.NewConsumer(cfg.KafkaBrokers, cfg.JobsNotifyTopic, cfg.JobsNotifyGroup, log)
+		run("Notification consumer", func(ctx context.Context) error {
+			defer consumer.Close()
+			return consumer.Run(ctx, func(ctx context.Context, value []byte) error {
+				var n jobs.Notification
+				if err := json.Unmarshal(value, &n); err != nil {
+					log.Warn("Skipping malformed bucket notification", "topic", cfg.JobsNotifyTopic, "error", err)
+					return nil
+				}
+				return trigger.Handle(ctx, n)
+			})
+		})
+	}
+
+	internalHttp.NewJobHandler(manager, log).Register(mux)
+	if cfg.JobsNotifyToken != "" {
+		internalHttp.NewNotificationHandler(trigger, cfg.JobsNotifyToken, log).Register(mux)
+	}
+
+	stop := func() {
+		stopRunning()
+		wg.Wait()
+		manager.Shutdown()
+		if err := store.Close(); err != nil {
+			log.Error("Failed to close job store", "error", err)
+		}
+	}
+	return stop, nil
+}
+
+// openJobStore opens the job store at url, either postgres://... or
+// sqlite:<path>.
+func openJobStore(ctx context.Context, url string) (jobs.JobStore, error) {
+	switch {
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return jobs.OpenPostgres(ctx, url)
+	case strings.HasPrefix(url, "sqlite:"):
+		return jobs.OpenSQLite(ctx, strings.TrimPrefix(url, "sqlite:"))
+	default:
+		return nil, errors.New("unsupported job store URL, expected postgres:// or sqlite:")
+	}
+}
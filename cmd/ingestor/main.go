@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -9,16 +12,23 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/raphaelreis/go-event-ingestor/internal/breaker"
 	"github.com/raphaelreis/go-event-ingestor/internal/config"
 	internalHttp "github.com/raphaelreis/go-event-ingestor/internal/http"
 	"github.com/raphaelreis/go-event-ingestor/internal/ingest"
 	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
 	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
 	"github.com/raphaelreis/go-event-ingestor/internal/rate"
+	"github.com/raphaelreis/go-event-ingestor/internal/serde"
+	"github.com/raphaelreis/go-event-ingestor/internal/spool"
 	"github.com/raphaelreis/go-event-ingestor/pkg/logger"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+
 	cfg := config.LoadFromEnv()
 	log := logger.New(cfg.LogLevel)
 
@@ -26,12 +36,17 @@ func main() {
 
 	mets := metrics.New()
 
-	producer := kafka.NewProducer(
-		cfg.KafkaBrokers,
-		cfg.KafkaTopic,
-		cfg.KafkaDLQTopic,
-		cfg.KafkaWriteTimeout,
-	)
+	serializer, err := newSerializer(cfg)
+	if err != nil {
+		log.Error("Failed to initialise serializer", "serializer", cfg.Serializer, "error", err)
+		os.Exit(1)
+	}
+
+	producer, err := newProducer(cfg, serializer, log, mets)
+	if err != nil {
+		log.Error("Failed to create producer", "error", err)
+		os.Exit(1)
+	}
 	defer producer.Close()
 
 	svc := ingest.NewService(
@@ -50,6 +65,15 @@ func main() {
 	mux.HandleFunc("/events", handler.Ingest)
 	mux.Handle("/metrics", promhttp.Handler())
 
+	if cfg.JobsDatabaseURL != "" {
+		stopJobs, err := startJobs(cfg, producer, log, mets, mux)
+		if err != nil {
+			log.Error("Failed to start job API", "error", err)
+			os.Exit(1)
+		}
+		defer stopJobs()
+	}
+
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write([]byte("OK")); err != nil {
@@ -88,3 +112,83 @@ func main() {
 
 	log.Info("Server exited properly")
 }
+
+func newSerializer(cfg *config.Config) (serde.Serializer, error) {
+	var registry serde.Registry
+	switch {
+	case cfg.SchemaRegistryURL != "":
+		registry = serde.NewHTTPRegistry(cfg.SchemaRegistryURL, &http.Client{Timeout: 10 * time.Second})
+	case cfg.SchemaRegistryFile != "":
+		registry = serde.NewFileRegistry(cfg.SchemaRegistryFile)
+	}
+
+	var avroSchema string
+	if cfg.AvroSchemaFile != "" {
+		data, err := os.ReadFile(cfg.AvroSchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		avroSchema = string(data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return serde.New(ctx, cfg.Serializer, registry, serde.SubjectForTopic(cfg.KafkaTopic), avroSchema)
+}
+
+// newProducer builds the Kafka producer described by cfg: transactional when
+// a transactional ID is set, behind the circuit breaker and spool when a
+// spool directory is set.
+func newProducer(cfg *config.Config, serializer serde.Serializer, log *slog.Logger, mets *metrics.Metrics) (kafka.Producer, error) {
+	if cfg.KafkaTransactionalID != "" && cfg.SpoolDir != "" {
+		// Spooled events would be published outside of any transaction, and
+		// without their checkpoint.
+		return nil, errors.New("SPOOL_DIR cannot be used with KAFKA_TRANSACTIONAL_ID")
+	}
+
+	var producer kafka.Producer
+	if cfg.KafkaTransactionalID != "" {
+		txnProducer, err := kafka.NewTransactionalProducer(
+			cfg.KafkaBrokers,
+			cfg.KafkaTopic,
+			cfg.KafkaCheckpointTopic,
+			cfg.KafkaTransactionalID,
+			cfg.KafkaWriteTimeout,
+			serializer,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transactional producer: %w", err)
+		}
+		producer = txnProducer
+	} else {
+		producer = kafka.NewProducer(
+			cfg.KafkaBrokers,
+			cfg.KafkaTopic,
+			cfg.KafkaDLQTopic,
+			cfg.KafkaWriteTimeout,
+			kafka.WithSerializer(serializer),
+			kafka.WithFailover(kafka.FailoverConfig{
+				SecondaryBrokers: cfg.KafkaSecondaryBrokers,
+				FailureThreshold: cfg.KafkaFailoverThreshold,
+				ProbeInterval:    cfg.KafkaFailbackInterval,
+				Metrics:          mets,
+				Logger:           log,
+			}),
+		)
+	}
+
+	if cfg.SpoolDir != "" {
+		sp, err := spool.Open(cfg.SpoolDir, cfg.SpoolMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spool %s: %w", cfg.SpoolDir, err)
+		}
+		producer = kafka.NewCircuitBreakerProducer(producer, sp, breaker.Config{
+			FailureRatio: cfg.BreakerFailureRatio,
+			MinRequests:  cfg.BreakerMinRequests,
+			Window:       cfg.BreakerWindow,
+			OpenTimeout:  cfg.BreakerOpenTimeout,
+		}, log, mets)
+	}
+	return producer, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/config"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProducer_SpoolWithTransactions(t *testing.T) {
+	cfg := &config.Config{KafkaTransactionalID: "ingestor", SpoolDir: t.TempDir()}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	_, err := newProducer(cfg, nil, logger, metrics.New())
+	assert.ErrorContains(t, err, "SPOOL_DIR")
+}
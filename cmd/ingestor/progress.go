@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+)
+
+// progress tracks an import for the command line.
+type progress struct {
+	start     time.Time
+	published atomic.Int64
+	rejected  atomic.Int64
+	failed    atomic.Int64
+	// position is the offset reached in the file, startPos where this run
+	// started reading, and total the file size, 0 when unknown.
+	position atomic.Int64
+	startPos atomic.Int64
+	total    int64
+	// readAhead is the furthest offset read at random, when the file is
+	// parsed in chunks rather than read through.
+	readAhead atomic.Int64
+}
+
+func newProgress() *progress {
+	return &progress{start: time.Now()}
+}
+
+func (p *progress) report(w io.Writer, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p.print(w)
+		}
+	}
+}
+
+func (p *progress) print(w io.Writer) {
+	elapsed := time.Since(p.start)
+	rows := p.published.Load() + p.rejected.Load()
+	line := fmt.Sprintf("rows=%d rate=%.0f/s rejected=%d errors=%d elapsed=%s",
+		rows, float64(rows)/elapsed.Seconds(), p.rejected.Load(), p.failed.Load(), elapsed.Round(time.Second))
+
+	if p.total > 0 {
+		pos := max(p.position.Load(), p.readAhead.Load())
+		line += fmt.Sprintf(" read=%.1f%%", 100*float64(pos)/float64(p.total))
+		if read := pos - p.startPos.Load(); read > 0 && pos < p.total {
+			eta := time.Duration(float64(elapsed) * float64(p.total-pos) / float64(read))
+			line += fmt.Sprintf(" eta=%s", eta.Round(time.Second))
+		}
+	}
+	fmt.Fprintln(w, line)
+}
+
+// progressSource tracks how far into the file at path the pipeline has
+// read. Other files, such as the previous version of a diff, are not
+// tracked.
+type progressSource struct {
+	csv.FileSource
+	progress *progress
+	path     string
+}
+
+func (s *progressSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := s.FileSource.Open(ctx, path)
+	if err != nil || path != s.path {
+		return rc, err
+	}
+	r := &positionReader{ReadCloser: rc, progress: s.progress}
+	// The pipeline seeks to resume when it can, and parses seekable files
+	// in chunks, so keep the file seekable and readable at random.
+	if seeker, ok := rc.(io.Seeker); ok {
+		sr := &seekingPositionReader{positionReader: r, seeker: seeker}
+		if ra, ok := rc.(io.ReaderAt); ok {
+			return &randomPositionReader{seekingPositionReader: sr, ra: ra}, nil
+		}
+		return sr, nil
+	}
+	return r, nil
+}
+
+type positionReader struct {
+	io.ReadCloser
+	progress *progress
+	started  bool
+}
+
+func (r *positionReader) Read(p []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		r.progress.startPos.Store(r.progress.position.Load())
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.progress.position.Add(int64(n))
+	return n, err
+}
+
+type seekingPositionReader struct {
+	*positionReader
+	seeker io.Seeker
+}
+
+func (r *seekingPositionReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.seeker.Seek(offset, whence)
+	if err == nil {
+		r.progress.position.Store(pos)
+	}
+	return pos, err
+}
+
+type randomPositionReader struct {
+	*seekingPositionReader
+	ra io.ReaderAt
+}
+
+// ReadAt leaves the position of Read and Seek alone, only pushing the
+// progress as far as the bytes read.
+func (r *randomPositionReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ra.ReadAt(p, off)
+	for end := off + int64(n); ; {
+		cur := r.progress.readAhead.Load()
+		if end <= cur || r.progress.readAhead.CompareAndSwap(cur, end) {
+			break
+		}
+	}
+	return n, err
+}
+
+// countingRejects counts rejected rows before handing them to the optional
+// sink.
+type countingRejects struct {
+	csv.RejectSink
+	progress *progress
+}
+
+func (c *countingRejects) Reject(ctx context.Context, r csv.Rejection) error {
+	if r.Reason != csv.ReasonPublishFailed {
+		c.progress.rejected.Add(1)
+	}
+	if c.RejectSink == nil {
+		return nil
+	}
+	return c.RejectSink.Reject(ctx, r)
+}
+
+// countProducer counts published events, keeping the transactional and bulk
+// paths of the pipeline available when producer supports them.
+func countProducer(producer kafka.Producer, p *progress) kafka.Producer {
+	counting := &countingProducer{Producer: producer, progress: p}
+	if publisher, ok := producer.(kafka.BatchPublisher); ok {
+		return &countingBatchPublisher{countingProducer: counting, publisher: publisher}
+	}
+	if bulk, ok := producer.(kafka.BulkPublisher); ok {
+		return &countingBulkPublisher{countingProducer: counting, bulk: bulk}
+	}
+	return counting
+}
+
+type countingProducer struct {
+	kafka.Producer
+	progress *progress
+}
+
+func (c *countingProducer) Publish(ctx context.Context, event model.Event) error {
+	if err := c.Producer.Publish(ctx, event); err != nil {
+		c.progress.failed.Add(1)
+		return err
+	}
+	c.progress.published.Add(1)
+	return nil
+}
+
+type countingBatchPublisher struct {
+	*countingProducer
+	publisher kafka.BatchPublisher
+}
+
+func (c *countingBatchPublisher) PublishBatch(ctx context.Context, batch kafka.Batch) error {
+	if err := c.publisher.PublishBatch(ctx, batch); err != nil {
+		c.progress.failed.Add(int64(len(batch.Events)))
+		return err
+	}
+	c.progress.published.Add(int64(len(batch.Events)))
+	return nil
+}
+
+func (c *countingBatchPublisher) LastCheckpoint(ctx context.Context, source string) (kafka.Checkpoint, error) {
+	return c.publisher.LastCheckpoint(ctx, source)
+}
+
+type countingBulkPublisher struct {
+	*countingProducer
+	bulk kafka.BulkPublisher
+}
+
+func (c *countingBulkPublisher) PublishAll(ctx context.Context, events []model.Event) error {
+	if err := c.bulk.PublishAll(ctx, events); err != nil {
+		c.progress.failed.Add(int64(len(events)))
+		return err
+	}
+	c.progress.published.Add(int64(len(events)))
+	return nil
+}
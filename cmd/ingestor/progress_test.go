@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressSource_ParseWorkers(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	b.WriteString("id,name\n")
+	for i := 1; i <= 2000; i++ {
+		fmt.Fprintf(&b, "%d,name %d\n", i, i)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.csv"), []byte(b.String()), 0o644))
+
+	progress := newProgress()
+	progress.total = int64(b.Len())
+	source := &progressSource{FileSource: storage.NewLocalSource(dir), progress: progress, path: "big.csv"}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{FilePath: "big.csv", WorkerCount: 2, BatchSize: 100, ParseWorkers: 4, ParseChunkSize: 1024}
+
+	pipeline := csv.NewPipeline(source, countProducer(discardProducer{}, progress), logger, metrics.New())
+	require.NoError(t, pipeline.Process(context.Background(), cfg))
+
+	assert.Equal(t, int64(2000), progress.published.Load())
+	// Only chunked parsing reads the file at random, and it reads all of it.
+	assert.Equal(t, progress.total, progress.readAhead.Load())
+	assert.Less(t, progress.position.Load(), progress.total)
+}
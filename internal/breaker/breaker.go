@@ -0,0 +1,223 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	// FailureThreshold is the number of consecutive failures that opens
+	// the breaker. Zero disables it when FailureRatio is set.
+	FailureThreshold int
+	// FailureRatio opens the breaker when, within one Window, at least
+	// MinRequests calls were made and this share of them failed.
+	FailureRatio float64
+	MinRequests  int
+	Window       time.Duration
+	// OpenTimeout is how long the breaker stays open before letting a
+	// probe through.
+	OpenTimeout time.Duration
+	// OnStateChange, if set, is called after every transition. It runs
+	// with the breaker unlocked.
+	OnStateChange func(from, to State)
+}
+
+// Breaker is a circuit breaker. While closed every call is allowed; once
+// open, calls are rejected until OpenTimeout elapses, after which a single
+// probe is allowed in the half-open state to decide whether to close again.
+type Breaker struct {
+	cfg      Config
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+	// generation changes with every transition, so that the outcome of a
+	// call allowed in an earlier state is not mistaken for a current one.
+	generation uint64
+
+	windowStart    time.Time
+	windowRequests int
+	windowFailures int
+}
+
+// Ticket is handed out for an allowed call; the call reports its outcome
+// through it. The zero Ticket reports nothing.
+type Ticket struct {
+	b          *Breaker
+	generation uint64
+	probe      bool
+}
+
+func New(cfg Config) *Breaker {
+	if cfg.FailureThreshold <= 0 && cfg.FailureRatio <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	return &Breaker{cfg: cfg, now: time.Now}
+}
+
+// Allow reports whether a call may proceed, and returns the Ticket its
+// outcome must be reported with. In the half-open state only one probe is
+// allowed at a time, and only its outcome closes or reopens the breaker.
+func (b *Breaker) Allow() (Ticket, bool) {
+	b.mu.Lock()
+	allowed, from, to := b.allow()
+	ticket := Ticket{b: b, generation: b.generation, probe: to == HalfOpen}
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	if !allowed {
+		return Ticket{}, false
+	}
+	return ticket, true
+}
+
+func (b *Breaker) allow() (bool, State, State) {
+	switch b.state {
+	case Closed:
+		return true, Closed, Closed
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return false, Open, Open
+		}
+		b.transition(HalfOpen)
+		b.probing = true
+		return true, Open, HalfOpen
+	default:
+		if b.probing {
+			return false, HalfOpen, HalfOpen
+		}
+		b.probing = true
+		return true, HalfOpen, HalfOpen
+	}
+}
+
+// Success reports that the call succeeded. It resets the failure count of a
+// closed breaker and closes a half-open one if the call was its probe; calls
+// allowed before the last transition are ignored.
+func (t Ticket) Success() {
+	b := t.b
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	from := b.state
+	if t.generation == b.generation {
+		switch {
+		case b.state == Closed:
+			b.record(false)
+			b.failures = 0
+		case b.state == HalfOpen && t.probe:
+			b.probing = false
+			b.failures = 0
+			b.transition(Closed)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// Failure reports that the call failed, which may open a closed breaker and
+// reopens a half-open one if the call was its probe. Like Success, it is
+// ignored for calls allowed before the last transition.
+func (t Ticket) Failure() {
+	b := t.b
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	from := b.state
+	if t.generation == b.generation {
+		switch {
+		case b.state == Closed:
+			b.failures++
+			b.record(true)
+			if b.exceeded() {
+				b.trip()
+			}
+		case b.state == HalfOpen && t.probe:
+			b.probing = false
+			b.trip()
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// record counts a call in the current window, starting a new window when
+// the previous one has expired.
+func (b *Breaker) record(failed bool) {
+	if b.cfg.FailureRatio <= 0 {
+		return
+	}
+	now := b.now()
+	if now.Sub(b.windowStart) >= b.cfg.Window {
+		b.windowStart = now
+		b.windowRequests = 0
+		b.windowFailures = 0
+	}
+	b.windowRequests++
+	if failed {
+		b.windowFailures++
+	}
+}
+
+func (b *Breaker) exceeded() bool {
+	if b.cfg.FailureThreshold > 0 && b.failures >= b.cfg.FailureThreshold {
+		return true
+	}
+	if b.cfg.FailureRatio <= 0 || b.windowRequests < b.cfg.MinRequests {
+		return false
+	}
+	return float64(b.windowFailures)/float64(b.windowRequests) >= b.cfg.FailureRatio
+}
+
+func (b *Breaker) trip() {
+	b.transition(Open)
+	b.openedAt = b.now()
+	b.windowRequests = 0
+	b.windowFailures = 0
+}
+
+func (b *Breaker) transition(to State) {
+	b.state = to
+	b.generation++
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,143 @@
+package breaker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// call reports the outcome of one allowed call.
+func call(t *testing.T, b *Breaker, ok bool) {
+	t.Helper()
+	ticket, allowed := b.Allow()
+	require.True(t, allowed)
+	if ok {
+		ticket.Success()
+	} else {
+		ticket.Failure()
+	}
+}
+
+func TestBreaker_Transitions(t *testing.T) {
+	now := time.Unix(0, 0)
+	var transitions []string
+
+	b := New(Config{
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+		OnStateChange: func(from, to State) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	b.now = func() time.Time { return now }
+
+	call(t, b, false)
+	call(t, b, false)
+	call(t, b, true)
+	call(t, b, false)
+	call(t, b, false)
+	assert.Equal(t, Closed, b.State(), "a success resets the consecutive failure count")
+
+	call(t, b, false)
+	assert.Equal(t, Open, b.State())
+	_, allowed := b.Allow()
+	assert.False(t, allowed)
+
+	now = now.Add(time.Minute)
+	probe, allowed := b.Allow()
+	assert.True(t, allowed, "first call after the timeout is the probe")
+	_, allowed = b.Allow()
+	assert.False(t, allowed, "only one probe at a time")
+	probe.Failure()
+	assert.Equal(t, Open, b.State(), "a failed probe reopens immediately")
+
+	now = now.Add(time.Minute)
+	call(t, b, true)
+	assert.Equal(t, Closed, b.State())
+
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half_open",
+		"half_open->open",
+		"open->half_open",
+		"half_open->closed",
+	}, transitions)
+}
+
+func TestBreaker_FailureRatio(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := New(Config{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Window:       10 * time.Second,
+		OpenTimeout:  time.Minute,
+	})
+	b.now = func() time.Time { return now }
+
+	call(t, b, false)
+	call(t, b, false)
+	call(t, b, false)
+	assert.Equal(t, Closed, b.State(), "not enough requests in the window yet")
+
+	now = now.Add(10 * time.Second)
+	call(t, b, true)
+	call(t, b, false)
+	call(t, b, true)
+	assert.Equal(t, Closed, b.State(), "the previous window was discarded")
+
+	call(t, b, false)
+	assert.Equal(t, Open, b.State(), "two failures out of four requests")
+}
+
+func TestBreaker_LateOutcomes(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(0, 0)
+	b := New(Config{FailureThreshold: 1, OpenTimeout: time.Minute})
+	b.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	// Calls allowed while closed, that are still in flight when the breaker
+	// trips.
+	late := make([]Ticket, 50)
+	for i := range late {
+		late[i], _ = b.Allow()
+	}
+	call(t, b, false)
+	require.Equal(t, Open, b.State())
+
+	report := func(tickets []Ticket) {
+		var wg sync.WaitGroup
+		for i, ticket := range tickets {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if i%2 == 0 {
+					ticket.Success()
+				} else {
+					ticket.Failure()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	report(late[:25])
+	assert.Equal(t, Open, b.State(), "late successes do not close an open breaker")
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	probe, allowed := b.Allow()
+	require.True(t, allowed)
+	report(late[25:])
+	assert.Equal(t, HalfOpen, b.State(), "only the probe decides")
+
+	probe.Success()
+	assert.Equal(t, Closed, b.State())
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -8,37 +9,114 @@ import (
 )
 
 type Config struct {
-	HTTPPort          string
-	LogLevel          string
-	KafkaBrokers      []string
-	KafkaTopic        string
-	KafkaDLQTopic     string
-	KafkaMaxRetries   int
-	KafkaRetryBackoff time.Duration
-	KafkaWriteTimeout time.Duration
-	WorkerPoolSize    int
-	QueueSize         int
-	RateLimitRPS      float64
-	RateLimitBurst    int
+	HTTPPort               string
+	LogLevel               string
+	KafkaBrokers           []string
+	KafkaTopic             string
+	KafkaDLQTopic          string
+	KafkaMaxRetries        int
+	KafkaRetryBackoff      time.Duration
+	KafkaWriteTimeout      time.Duration
+	KafkaSecondaryBrokers  []string
+	KafkaFailoverThreshold int
+	KafkaFailbackInterval  time.Duration
+	KafkaTransactionalID   string
+	KafkaCheckpointTopic   string
+	SpoolDir               string
+	SpoolMaxBytes          int64
+	BreakerFailureRatio    float64
+	BreakerMinRequests     int
+	BreakerWindow          time.Duration
+	BreakerOpenTimeout     time.Duration
+	Serializer             string
+	SchemaRegistryURL      string
+	SchemaRegistryFile     string
+	AvroSchemaFile         string
+	WorkerPoolSize         int
+	QueueSize              int
+	RateLimitRPS           float64
+	RateLimitBurst         int
+	S3Endpoint             string
+	S3Region               string
+	S3AccessKey            string
+	S3SecretKey            string
+	S3UseSSL               bool
+	JobsDatabaseURL        string
+	JobsSource             string
+	JobsMaxConcurrent      int
+	JobsStaleAfter         time.Duration
+	JobsWatchInterval      time.Duration
+	JobsWatchPrefix        string
+	JobsWatchStableFor     time.Duration
+	JobsNotifyTopic        string
+	JobsNotifyGroup        string
+	JobsNotifyToken        string
+	JobsNotifyPrefix       string
 }
 
 func LoadFromEnv() *Config {
 	return &Config{
-		HTTPPort:          getEnv("HTTP_PORT", "8080"),
-		LogLevel:          getEnv("LOG_LEVEL", "INFO"),
-		KafkaBrokers:      strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ","),
-		KafkaTopic:        getEnv("KAFKA_TOPIC", "events"),
-		KafkaDLQTopic:     getEnv("KAFKA_DLQ_TOPIC", "events-dlq"),
-		KafkaMaxRetries:   getEnvInt("KAFKA_MAX_RETRIES", 3),
-		KafkaRetryBackoff: getEnvDuration("KAFKA_RETRY_BACKOFF", 100*time.Millisecond),
-		KafkaWriteTimeout: getEnvDuration("KAFKA_WRITE_TIMEOUT", 10*time.Second),
-		WorkerPoolSize:    getEnvInt("WORKER_POOL_SIZE", 10),
-		QueueSize:         getEnvInt("QUEUE_SIZE", 1000),
-		RateLimitRPS:      getEnvFloat("RATE_LIMIT_RPS", 1000.0),
-		RateLimitBurst:    getEnvInt("RATE_LIMIT_BURST", 100),
+		HTTPPort:               getEnv("HTTP_PORT", "8080"),
+		LogLevel:               getEnv("LOG_LEVEL", "INFO"),
+		KafkaBrokers:           strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ","),
+		KafkaTopic:             getEnv("KAFKA_TOPIC", "events"),
+		KafkaDLQTopic:          getEnv("KAFKA_DLQ_TOPIC", "events-dlq"),
+		KafkaMaxRetries:        getEnvInt("KAFKA_MAX_RETRIES", 3),
+		KafkaRetryBackoff:      getEnvDuration("KAFKA_RETRY_BACKOFF", 100*time.Millisecond),
+		KafkaWriteTimeout:      getEnvDuration("KAFKA_WRITE_TIMEOUT", 10*time.Second),
+		KafkaSecondaryBrokers:  getEnvList("KAFKA_SECONDARY_BROKERS"),
+		KafkaFailoverThreshold: getEnvInt("KAFKA_FAILOVER_THRESHOLD", 5),
+		KafkaFailbackInterval:  getEnvDuration("KAFKA_FAILBACK_PROBE_INTERVAL", 30*time.Second),
+		KafkaTransactionalID:   getEnv("KAFKA_TRANSACTIONAL_ID", ""),
+		KafkaCheckpointTopic:   getEnv("KAFKA_CHECKPOINT_TOPIC", "events-checkpoints"),
+		SpoolDir:               getEnv("SPOOL_DIR", ""),
+		SpoolMaxBytes:          int64(getEnvInt("SPOOL_MAX_BYTES", 1<<30)),
+		BreakerFailureRatio:    getEnvFloat("BREAKER_FAILURE_RATIO", 0.5),
+		BreakerMinRequests:     getEnvInt("BREAKER_MIN_REQUESTS", 20),
+		BreakerWindow:          getEnvDuration("BREAKER_WINDOW", 10*time.Second),
+		BreakerOpenTimeout:     getEnvDuration("BREAKER_OPEN_TIMEOUT", 15*time.Second),
+		Serializer:             getEnv("SERIALIZER", "json"),
+		SchemaRegistryURL:      getEnv("SCHEMA_REGISTRY_URL", ""),
+		SchemaRegistryFile:     getEnv("SCHEMA_REGISTRY_FILE", ""),
+		AvroSchemaFile:         getEnv("AVRO_SCHEMA_FILE", ""),
+		WorkerPoolSize:         getEnvInt("WORKER_POOL_SIZE", 10),
+		QueueSize:              getEnvInt("QUEUE_SIZE", 1000),
+		RateLimitRPS:           getEnvFloat("RATE_LIMIT_RPS", 1000.0),
+		RateLimitBurst:         getEnvInt("RATE_LIMIT_BURST", 100),
+		S3Endpoint:             getEnv("S3_ENDPOINT", "s3.amazonaws.com"),
+		S3Region:               getEnv("S3_REGION", ""),
+		S3AccessKey:            getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:            getEnv("S3_SECRET_KEY", ""),
+		S3UseSSL:               getEnvBool("S3_USE_SSL", true),
+		JobsDatabaseURL:        getEnv("JOBS_DATABASE_URL", ""),
+		JobsSource:             getEnv("JOBS_SOURCE", "."),
+		JobsMaxConcurrent:      getEnvInt("JOBS_MAX_CONCURRENT", 2),
+		JobsStaleAfter:         getEnvDuration("JOBS_STALE_AFTER", 2*time.Minute),
+		JobsWatchInterval:      getEnvDuration("JOBS_WATCH_INTERVAL", 0),
+		JobsWatchPrefix:        getEnv("JOBS_WATCH_PREFIX", ""),
+		JobsWatchStableFor:     getEnvDuration("JOBS_WATCH_STABLE_FOR", 0),
+		JobsNotifyTopic:        getEnv("JOBS_NOTIFY_TOPIC", ""),
+		JobsNotifyGroup:        getEnv("JOBS_NOTIFY_GROUP", "ingestor-notifications"),
+		JobsNotifyToken:        getEnv("JOBS_NOTIFY_TOKEN", ""),
+		JobsNotifyPrefix:       getEnv("JOBS_NOTIFY_PREFIX", ""),
 	}
 }
 
+// LogValue keeps credentials out of logs.
+func (c *Config) LogValue() slog.Value {
+	redacted := *c
+	if redacted.S3SecretKey != "" {
+		redacted.S3SecretKey = "REDACTED"
+	}
+	if redacted.JobsDatabaseURL != "" {
+		redacted.JobsDatabaseURL = "REDACTED"
+	}
+	if redacted.JobsNotifyToken != "" {
+		redacted.JobsNotifyToken = "REDACTED"
+	}
+	return slog.AnyValue(redacted)
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -46,6 +124,13 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvList(key string) []string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return strings.Split(value, ",")
+	}
+	return nil
+}
+
 func getEnvInt(key string, fallback int) int {
 	if value, ok := os.LookupEnv(key); ok {
 		if i, err := strconv.Atoi(value); err == nil {
@@ -55,6 +140,15 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
 func getEnvFloat(key string, fallback float64) float64 {
 	if value, ok := os.LookupEnv(key); ok {
 		if f, err := strconv.ParseFloat(value, 64); err == nil {
@@ -11,6 +11,7 @@ import (
 	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
 	"github.com/raphaelreis/go-event-ingestor/internal/model"
 	"github.com/raphaelreis/go-event-ingestor/internal/rate"
+	"github.com/raphaelreis/go-event-ingestor/internal/tracing"
 )
 
 type Handler struct {
@@ -52,7 +53,10 @@ func (h *Handler) Ingest(w http.ResponseWriter, r *http.Request) {
 		event.Timestamp = time.Now()
 	}
 
-	err := h.service.Ingest(r.Context(), event)
+	trace := tracing.Extract(r.Header)
+	ctx := tracing.ContextWith(r.Context(), trace)
+
+	err := h.service.Ingest(ctx, event)
 	if err != nil {
 		if err == ingest.ErrQueueFull {
 			h.metrics.HTTPRequests.WithLabelValues("503").Inc()
@@ -68,6 +72,7 @@ func (h *Handler) Ingest(w http.ResponseWriter, r *http.Request) {
 
 	h.metrics.HTTPRequests.WithLabelValues("202").Inc()
 	w.Header().Set("X-Request-ID", event.ID)
+	w.Header().Set(tracing.TraceParentHeader, trace.TraceParent())
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	if err := json.NewEncoder(w).Encode(map[string]string{"status": "accepted", "id": event.ID}); err != nil {
@@ -77,5 +82,6 @@ func (h *Handler) Ingest(w http.ResponseWriter, r *http.Request) {
 	h.logger.Debug("Request processed",
 		"duration_ms", time.Since(start).Milliseconds(),
 		"event_id", event.ID,
+		"trace_id", trace.TraceID,
 	)
 }
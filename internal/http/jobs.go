@@ -0,0 +1,126 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+)
+
+// JobHandler exposes bulk import jobs over HTTP:
+//
+//	POST /jobs              submit a jobs.Submission
+//	GET  /jobs              list jobs, filtered by customer_id, dataset, status and limit
+//	GET  /jobs/{id}         get a job and its progress
+//	POST /jobs/{id}/cancel  cancel a pending or running job
+type JobHandler struct {
+	manager *jobs.Manager
+	logger  *slog.Logger
+}
+
+func NewJobHandler(manager *jobs.Manager, logger *slog.Logger) *JobHandler {
+	return &JobHandler{manager: manager, logger: logger}
+}
+
+func (h *JobHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /jobs", h.Submit)
+	mux.HandleFunc("GET /jobs", h.List)
+	mux.HandleFunc("GET /jobs/{id}", h.Get)
+	mux.HandleFunc("POST /jobs/{id}/cancel", h.Cancel)
+}
+
+func (h *JobHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	var sub jobs.Submission
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.manager.Submit(r.Context(), sub)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.logger.Info("Ingestion job submitted", "job_id", job.ID, "customer_id", job.CustomerID, "dataset", job.Dataset, "period", job.Period)
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	h.writeJSON(w, http.StatusAccepted, job)
+}
+
+func (h *JobHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := jobs.ListFilter{
+		CustomerID: query.Get("customer_id"),
+		Dataset:    query.Get("dataset"),
+		Status:     jobs.Status(query.Get("status")),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	reports, err := h.manager.List(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, map[string]any{"jobs": reports})
+}
+
+func (h *JobHandler) Get(w http.ResponseWriter, r *http.Request) {
+	report, err := h.manager.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, report)
+}
+
+func (h *JobHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.manager.Cancel(r.Context(), id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.logger.Info("Ingestion job canceled", "job_id", id)
+
+	report, err := h.manager.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, report)
+}
+
+func (h *JobHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrInvalidSubmission):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, jobs.ErrNotFound), errors.Is(err, dataset.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, jobs.ErrLocked), errors.Is(err, jobs.ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, dataset.ErrInvalidManifest):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		h.logger.Error("Job request failed", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *JobHandler) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Error("Failed to write response", "error", err)
+	}
+}
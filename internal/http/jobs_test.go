@@ -0,0 +1,112 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	internalHttp "github.com/raphaelreis/go-event-ingestor/internal/http"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopProducer struct{}
+
+func (nopProducer) Publish(ctx context.Context, event model.Event) error { return nil }
+
+func (nopProducer) Close() error { return nil }
+
+func newJobServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.csv"), []byte("id,qty\n1,2\n2,x\n3,4\n"), 0o644))
+
+	store, err := jobs.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	runner := jobs.NewRunner(store, source, nopProducer{}, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Pipeline: csv.Config{WorkerCount: 1, BatchSize: 1},
+	}, logger)
+	t.Cleanup(manager.Shutdown)
+
+	mux := http.NewServeMux()
+	internalHttp.NewJobHandler(manager, logger).Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestJobHandler(t *testing.T) {
+	srv := newJobServer(t)
+
+	body := `{"customer_id":"123","dataset":"orders","file_path":"orders.csv","period":"2025-01",
+		"options":{"schema":{"columns":[{"name":"qty","type":"int"}]}}}`
+	resp, err := http.Post(srv.URL+"/jobs", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var job jobs.Job
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	assert.Equal(t, "/jobs/"+job.ID, resp.Header.Get("Location"))
+
+	var report jobs.Report
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(srv.URL + "/jobs/" + job.ID)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return json.NewDecoder(resp.Body).Decode(&report) == nil && report.Status == jobs.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(3), report.RowsProcessed)
+	assert.Equal(t, csv.Offset{Bytes: 19, Row: 3}, report.LastOffset)
+
+	resp, err = http.Get(srv.URL + "/jobs?customer_id=123&status=COMPLETED")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var list struct {
+		Jobs []jobs.Report `json:"jobs"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Jobs, 1)
+	assert.Equal(t, job.ID, list.Jobs[0].ID)
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/jobs/" + job.ID + "/cancel", "", http.StatusConflict},
+		{http.MethodPost, "/jobs/missing/cancel", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs/missing", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs?limit=-1", "", http.StatusBadRequest},
+		{http.MethodPost, "/jobs", "{", http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"customer_id":"123"}`, http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"customer_id":"123","dataset":"missing"}`, http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tc.status, resp.StatusCode, "%s %s", tc.method, tc.path)
+	}
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+)
+
+// NotificationHandler receives bucket notifications, as sent by MinIO
+// webhook targets, and submits the jobs they call for:
+//
+//	POST /jobs/notifications  handle a jobs.Notification
+type NotificationHandler struct {
+	trigger *jobs.Trigger
+	token   string
+	logger  *slog.Logger
+}
+
+// NewNotificationHandler requires requests to carry token in their
+// Authorization header, bare or as a bearer token, as MinIO sends its
+// auth_token. An empty token lets no request through.
+func NewNotificationHandler(trigger *jobs.Trigger, token string, logger *slog.Logger) *NotificationHandler {
+	return &NotificationHandler{trigger: trigger, token: token, logger: logger}
+}
+
+func (h *NotificationHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /jobs/notifications", h.Notify)
+	// MinIO checks that a webhook target is up with HEAD requests.
+	mux.HandleFunc("HEAD /jobs/notifications", func(w http.ResponseWriter, r *http.Request) {})
+}
+
+func (h *NotificationHandler) Notify(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var n jobs.Notification
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if err := h.trigger.Handle(r.Context(), n); err != nil {
+		// The sender delivers the notification again.
+		h.logger.Error("Failed to handle bucket notification", "error", err)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *NotificationHandler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(h.token)) == 1
+}
@@ -0,0 +1,91 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	internalHttp "github.com/raphaelreis/go-event-ingestor/internal/http"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationHandler(t *testing.T) {
+	dir := t.TempDir()
+	partition := filepath.Join(dir, "customer_id=123", "dataset=orders", "year=2025", "month=01")
+	require.NoError(t, os.MkdirAll(partition, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(partition, "orders.csv"), []byte("id\n1\n2\n"), 0o644))
+
+	store, err := jobs.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	runner := jobs.NewRunner(store, source, nopProducer{}, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Pipeline: csv.Config{WorkerCount: 1, BatchSize: 1},
+	}, logger)
+	t.Cleanup(manager.Shutdown)
+	trigger := jobs.NewTrigger(source, manager, jobs.TriggerConfig{}, logger)
+
+	mux := http.NewServeMux()
+	internalHttp.NewNotificationHandler(trigger, "secret", logger).Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	notification := `{"EventName":"s3:ObjectCreated:Put","Records":[{"eventName":"s3:ObjectCreated:Put",
+		"s3":{"bucket":{"name":"datasets"},"object":{"key":"customer_id%3D123%2Fdataset%3Dorders%2Fyear%3D2025%2Fmonth%3D01%2Forders.csv"}}}]}`
+	for _, tc := range []struct {
+		name, method, token, body string
+		status                    int
+	}{
+		{"health check", http.MethodHead, "", "", http.StatusOK},
+		{"missing token", http.MethodPost, "", notification, http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "Bearer other", notification, http.StatusUnauthorized},
+		{"malformed", http.MethodPost, "Bearer secret", "{", http.StatusBadRequest},
+		{"bearer token", http.MethodPost, "Bearer secret", notification, http.StatusNoContent},
+		{"bare token", http.MethodPost, "secret", notification, http.StatusNoContent},
+	} {
+		req, err := http.NewRequest(tc.method, srv.URL+"/jobs/notifications", strings.NewReader(tc.body))
+		require.NoError(t, err)
+		if tc.token != "" {
+			req.Header.Set("Authorization", tc.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tc.status, resp.StatusCode, tc.name)
+	}
+
+	require.Eventually(t, func() bool {
+		list, err := manager.List(context.Background(), jobs.ListFilter{Status: jobs.StatusCompleted})
+		return err == nil && len(list) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	list, err := manager.List(context.Background(), jobs.ListFilter{})
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+func TestNotificationHandler_EmptyToken(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	mux := http.NewServeMux()
+	internalHttp.NewNotificationHandler(nil, "", logger).Register(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/notifications", strings.NewReader("{}"))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
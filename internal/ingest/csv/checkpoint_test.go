@@ -0,0 +1,160 @@
+package csv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memSource serves one in-memory file and keeps its checkpoints.
+type memSource struct {
+	content  []byte
+	seekable bool
+
+	mu         sync.Mutex
+	checkpoint csv.Offset
+	completed  bool
+}
+
+type seekableFile struct{ *bytes.Reader }
+
+func (seekableFile) Close() error { return nil }
+
+func (s *memSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	if s.seekable {
+		return seekableFile{bytes.NewReader(s.content)}, nil
+	}
+	return io.NopCloser(bytes.NewReader(s.content)), nil
+}
+
+func (s *memSource) Checkpoint(ctx context.Context, path string, offset csv.Offset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoint = offset
+	return nil
+}
+
+func (s *memSource) ResumeOffset(ctx context.Context, path string) (csv.Offset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoint, nil
+}
+
+func (s *memSource) MarkCompleted(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed = true
+	return nil
+}
+
+// crashingProducer records published rows and fails every publish once
+// crashAfter rows went through, as if the broker connection died.
+type crashingProducer struct {
+	mu         sync.Mutex
+	published  map[string]int
+	count      int
+	crashAfter int
+}
+
+func (c *crashingProducer) Publish(ctx context.Context, event model.Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.crashAfter > 0 && c.count >= c.crashAfter {
+		return errors.New("broker unavailable")
+	}
+	c.count++
+	c.published[event.Payload["id"].(string)]++
+	return nil
+}
+
+func (c *crashingProducer) Close() error { return nil }
+
+func TestPipeline_Process_ResumeAfterCrash(t *testing.T) {
+	for _, seekable := range []bool{true, false} {
+		t.Run(fmt.Sprintf("seekable=%v", seekable), func(t *testing.T) {
+			lines := []string{"id,value"}
+			for i := 1; i <= 1000; i++ {
+				lines = append(lines, fmt.Sprintf("%d,value-%d", i, i))
+			}
+			source := &memSource{content: []byte(strings.Join(lines, "\n") + "\n"), seekable: seekable}
+			producer := &crashingProducer{published: map[string]int{}, crashAfter: 400}
+			logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+			cfg := csv.Config{FilePath: "big.csv", WorkerCount: 8, BatchSize: 16}
+
+			err := csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg)
+			require.Error(t, err)
+			assert.False(t, source.completed)
+
+			// Workers finish rows out of order, so the checkpoint may stop
+			// anywhere below the 400 rows that made it out.
+			checkpoint := source.checkpoint
+			assert.LessOrEqual(t, checkpoint.Row, int64(400))
+			for i := int64(1); i <= checkpoint.Row; i++ {
+				require.Equal(t, 1, producer.published[fmt.Sprint(i)], "row %d is below the checkpoint", i)
+			}
+
+			producer.crashAfter = 0
+			err = csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg)
+			require.NoError(t, err)
+			assert.True(t, source.completed)
+			assert.Equal(t, int64(1000), source.checkpoint.Row)
+			assert.Equal(t, int64(len(source.content)), source.checkpoint.Bytes)
+
+			for i := 1; i <= 1000; i++ {
+				count := producer.published[fmt.Sprint(i)]
+				require.NotZero(t, count, "row %d was never published", i)
+				if int64(i) <= checkpoint.Row {
+					require.Equal(t, 1, count, "row %d was re-published after resume", i)
+				}
+			}
+		})
+	}
+}
+
+// blockingProducer holds every publish until ctx is done.
+type blockingProducer struct{}
+
+func (blockingProducer) Publish(ctx context.Context, event model.Event) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (blockingProducer) Close() error { return nil }
+
+func TestPipeline_Process_HeartbeatFailureStops(t *testing.T) {
+	errLost := errors.New("lease lost")
+	source := &memSource{content: []byte("id\n1\n2\n")}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	beats := 0
+	cfg := csv.Config{
+		FilePath:          "stuck.csv",
+		WorkerCount:       1,
+		BatchSize:         1,
+		HeartbeatInterval: 5 * time.Millisecond,
+		Heartbeat: func(ctx context.Context) error {
+			beats++
+			if beats == 3 {
+				return errLost
+			}
+			return nil
+		},
+	}
+
+	err := csv.NewPipeline(source, blockingProducer{}, logger, metrics.New()).Process(context.Background(), cfg)
+	assert.ErrorIs(t, err, errLost)
+	assert.Equal(t, 3, beats)
+	assert.False(t, source.completed)
+}
@@ -0,0 +1,290 @@
+package csv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const defaultParseChunkSize = 4 << 20
+
+// chunkedReader parses delimited text in chunks of about chunkSize bytes, a
+// few at a time, and returns their records in file order.
+//
+// A chunk is parsed from the first line break at or after its nominal
+// start, speculating that the line break ends a record rather than being
+// quoted. Parsing goes on past the nominal end up to the end of the record
+// being read there, which is where the next chunk really starts. Chunks are
+// returned in order, and one whose speculative start turns out to differ
+// from where the previous one really ended is parsed again from there, so
+// quoted line breaks cost time but never correctness: records, offsets and
+// line numbers are those a sequential read finds.
+type chunkedReader struct {
+	d         *delimitedReader
+	ra        io.ReaderAt
+	size      int64
+	width     int
+	chunkSize int64
+	// lines is false when resuming, line numbers being unknown then.
+	lines bool
+
+	chunks chan chan chunkResult
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	current []chunkRecord
+	// next is where the next chunk starts, and line the line it starts at.
+	next int64
+	line int64
+}
+
+// chunkResult is what parsing a chunk found.
+type chunkResult struct {
+	// start is where parsing started and stop the first record boundary at
+	// or after the nominal end of the chunk.
+	start, stop int64
+	end         int64
+	records     []chunkRecord
+	// lines counts the line breaks between start and stop.
+	lines int64
+	// complete is false when a record ran past the bytes read for the
+	// chunk, or when no line break was found to start from.
+	complete bool
+	err      error
+}
+
+// chunkRecord is a record, or a malformed one along with its error, with
+// its line relative to the start of the chunk.
+type chunkRecord struct {
+	rec record
+	err error
+}
+
+// newChunkedReader reads the header of r like newDelimitedReader and parses
+// the rest of it with workers goroutines when r is an io.ReaderAt and
+// io.Seeker holding at least two chunks. Other files are read sequentially.
+func newChunkedReader(r io.Reader, format Format, noHeader bool, mapping *Mapping, resume Offset, workers int, chunkSize int64) (recordReader, []string, error) {
+	d, header, err := newDelimitedReader(r, format, noHeader, mapping, resume)
+	if err != nil || header == nil {
+		return d, header, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultParseChunkSize
+	}
+
+	start := d.base + d.reader.InputOffset()
+	if d.pending != nil {
+		// The first row of a headerless file is data.
+		start = 0
+	}
+	ra, size, ok := sizedReaderAt(r)
+	if !ok || size-start < 2*chunkSize {
+		return d, header, nil
+	}
+
+	c := &chunkedReader{
+		d:         d,
+		ra:        ra,
+		size:      size,
+		width:     d.reader.FieldsPerRecord,
+		chunkSize: chunkSize,
+		lines:     !d.seeked,
+		chunks:    make(chan chan chunkResult, workers),
+		done:      make(chan struct{}),
+		next:      start,
+		line:      1,
+	}
+	if c.lines {
+		head := make([]byte, start)
+		if _, err := ra.ReadAt(head, 0); err != nil {
+			return nil, nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		c.line += int64(bytes.Count(head, []byte{'\n'}))
+	}
+
+	c.wg.Add(1)
+	go c.split(start)
+	return c, header, nil
+}
+
+// sizedReaderAt returns r as an io.ReaderAt along with its size, leaving its
+// position unchanged.
+func sizedReaderAt(r io.Reader) (io.ReaderAt, int64, bool) {
+	ra, ok := r.(io.ReaderAt)
+	seeker, seekable := r.(io.Seeker)
+	if !ok || !seekable {
+		return nil, 0, false
+	}
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if _, seekErr := seeker.Seek(pos, io.SeekStart); err != nil || seekErr != nil {
+		return nil, 0, false
+	}
+	return ra, size, true
+}
+
+// split parses the chunks from start onwards, handing their results over in
+// order. At most cap(c.chunks) results wait to be read.
+func (c *chunkedReader) split(start int64) {
+	defer c.wg.Done()
+	defer close(c.chunks)
+	for from := start; from < c.size; from += c.chunkSize {
+		end := min(from+c.chunkSize, c.size)
+		result := make(chan chunkResult, 1)
+		select {
+		case c.chunks <- result:
+		case <-c.done:
+			return
+		}
+		c.wg.Add(1)
+		go func(first bool) {
+			defer c.wg.Done()
+			result <- c.parse(from, end, first)
+		}(from == start)
+	}
+}
+
+// parse parses the chunk from its nominal start to end, speculating on where
+// its first record starts unless it is the first chunk.
+func (c *chunkedReader) parse(from, end int64, first bool) chunkResult {
+	if first {
+		return c.parseFrom(from, end, c.chunkSize/4)
+	}
+
+	// The line break may be the byte just before the chunk.
+	limit := min(end+c.chunkSize/4, c.size)
+	buf := make([]byte, limit-from+1)
+	if _, err := c.ra.ReadAt(buf, from-1); err != nil && err != io.EOF {
+		return chunkResult{err: fmt.Errorf("failed to read CSV: %w", err)}
+	}
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return chunkResult{end: end}
+	}
+	start := from + int64(i)
+	return c.parseBuffer(buf[i+1:], start, end, limit == c.size)
+}
+
+// parseFrom parses the records starting from start before end, reading
+// overflow bytes past end at first and more if a record needs them.
+func (c *chunkedReader) parseFrom(start, end, overflow int64) chunkResult {
+	for {
+		limit := min(max(end, start)+max(overflow, 1), c.size)
+		buf := make([]byte, limit-start)
+		if _, err := c.ra.ReadAt(buf, start); err != nil && err != io.EOF {
+			return chunkResult{err: fmt.Errorf("failed to read CSV: %w", err)}
+		}
+		result := c.parseBuffer(buf, start, end, limit == c.size)
+		if result.complete || result.err != nil {
+			return result
+		}
+		overflow *= 2
+	}
+}
+
+// parseBuffer parses the records of buf, which starts at start in the file,
+// that start before end.
+func (c *chunkedReader) parseBuffer(buf []byte, start, end int64, last bool) chunkResult {
+	result := chunkResult{start: start, end: end}
+	reader := c.d.newReader(bytes.NewReader(buf))
+	reader.FieldsPerRecord = c.width
+
+	for {
+		offset := reader.InputOffset()
+		if start+offset >= end {
+			result.stop = start + offset
+			break
+		}
+		fields, err := reader.Read()
+		if err == io.EOF {
+			result.stop = start + offset
+			break
+		}
+		if !last && reader.InputOffset() >= int64(len(buf)) {
+			// The record may go on past the bytes read.
+			return result
+		}
+
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			result.records = append(result.records, chunkRecord{
+				rec: record{fields: c.d.unswap(fields), line: int64(parseErr.StartLine)},
+				err: err,
+			})
+		case err != nil:
+			result.err = fmt.Errorf("failed to read CSV: %w", err)
+			return result
+		default:
+			line, _ := reader.FieldPos(0)
+			result.records = append(result.records, chunkRecord{
+				rec: record{fields: c.d.unswap(fields), end: start + reader.InputOffset(), line: int64(line)},
+			})
+		}
+	}
+
+	result.lines = int64(bytes.Count(buf[:result.stop-start], []byte{'\n'}))
+	result.complete = true
+	return result
+}
+
+func (c *chunkedReader) Read() (record, error) {
+	for len(c.current) == 0 {
+		future, ok := <-c.chunks
+		if !ok {
+			return record{}, io.EOF
+		}
+		result := <-future
+		if result.err != nil {
+			return record{}, result.err
+		}
+		if !result.complete || result.start != c.next {
+			// The speculative start was wrong, or a record went past the
+			// bytes read.
+			result = c.parseFrom(c.next, result.end, c.chunkSize/4)
+			if result.err != nil {
+				return record{}, result.err
+			}
+		}
+		c.current = c.locate(result)
+		c.next = result.stop
+		c.line += result.lines
+	}
+
+	cr := c.current[0]
+	c.current = c.current[1:]
+	return cr.rec, cr.err
+}
+
+// locate turns the line numbers of the records of result, relative to its
+// start, into line numbers in the file.
+func (c *chunkedReader) locate(result chunkResult) []chunkRecord {
+	for i := range result.records {
+		cr := &result.records[i]
+		line := c.line + cr.rec.line - 1
+		var parseErr *csv.ParseError
+		if errors.As(cr.err, &parseErr) {
+			shifted := *parseErr
+			shifted.StartLine += int(c.line - 1)
+			shifted.Line += int(c.line - 1)
+			cr.err = &malformedError{err: &shifted}
+		}
+		cr.rec.line = 0
+		if c.lines {
+			cr.rec.line = line
+		}
+	}
+	return result.records
+}
+
+func (c *chunkedReader) Close() error {
+	close(c.done)
+	c.wg.Wait()
+	return nil
+}
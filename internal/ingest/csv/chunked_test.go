@@ -0,0 +1,97 @@
+package csv_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trickyCSV returns rows with quoted line breaks, some spanning several
+// chunks, along with malformed rows, blank lines and CRLF line endings, and
+// the offset just after each data row.
+func trickyCSV(rows int) (string, []int64) {
+	rnd := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	b.WriteString("id,note\n")
+	var offsets []int64
+	for i := 1; i <= rows; i++ {
+		note := fmt.Sprintf("note %d", i)
+		switch rnd.Intn(8) {
+		case 0:
+			note = fmt.Sprintf("\"line one\nline, two\n\"\"quoted\"\" %d\"", i)
+		case 1:
+			note = "\"" + strings.Repeat("long\n", 60) + "\""
+		case 2:
+			b.WriteString("\n")
+		}
+		end := "\n"
+		if rnd.Intn(4) == 0 {
+			end = "\r\n"
+		}
+		if rnd.Intn(10) == 0 {
+			b.WriteString("malformed\n")
+		}
+		fmt.Fprintf(&b, "%d,%s%s", i, note, end)
+		offsets = append(offsets, int64(b.Len()))
+	}
+	return b.String(), offsets
+}
+
+type chunkedRun struct {
+	payloads   map[string]map[string]any
+	rejections []csv.Rejection
+	checkpoint csv.Offset
+}
+
+func processChunked(t *testing.T, content string, resume csv.Offset, cfg csv.Config) chunkedRun {
+	t.Helper()
+	source := &memSource{content: []byte(content), seekable: true, checkpoint: resume}
+	producer := &bulkProducer{}
+	quarantine := &memQuarantine{}
+	cfg.FilePath = "big.csv"
+	cfg.WorkerCount = 4
+	cfg.BatchSize = 8
+	cfg.Rejects = quarantine
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg))
+	assert.True(t, source.completed)
+
+	run := chunkedRun{payloads: map[string]map[string]any{}, checkpoint: source.checkpoint}
+	for _, batch := range producer.batches {
+		for _, event := range batch {
+			run.payloads[event.Headers[csv.HeaderRowNumber]] = event.Payload
+		}
+	}
+	run.rejections = quarantine.rejections
+	sort.Slice(run.rejections, func(i, j int) bool {
+		return strings.Join(run.rejections[i].Violations, "") < strings.Join(run.rejections[j].Violations, "")
+	})
+	return run
+}
+
+func TestPipeline_Process_ParseWorkers(t *testing.T) {
+	content, offsets := trickyCSV(400)
+	for _, resume := range []csv.Offset{{}, {Bytes: offsets[149], Row: 150}} {
+		sequential := processChunked(t, content, resume, csv.Config{})
+		require.Len(t, sequential.payloads, 400-int(resume.Row))
+		require.NotEmpty(t, sequential.rejections)
+
+		for _, chunkSize := range []int64{16, 64, 1000} {
+			t.Run(fmt.Sprintf("resume=%d/chunk=%d", resume.Row, chunkSize), func(t *testing.T) {
+				chunked := processChunked(t, content, resume, csv.Config{ParseWorkers: 4, ParseChunkSize: chunkSize})
+				assert.Equal(t, sequential, chunked)
+			})
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package csv
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+)
+
+// Operations of change events.
+const (
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+var ErrDiffKeyRequired = errors.New("snapshot diff requires a key column")
+
+// change is a row that differs from the previous version of the file.
+type change struct {
+	op      string
+	key     string
+	payload map[string]interface{}
+}
+
+// newChangeEvent wraps the payload of a change along with its operation.
+// Deletes carry the row as it was in the previous version.
+func newChangeEvent(cfg Config, row int64, c *change) model.Event {
+	event := newRowEvent(cfg, row, c.key, map[string]interface{}{"op": c.op, "row": c.payload})
+	event.Type = "bulk_change"
+	return event
+}
+
+// rowEvent maps row to its event, or returns its schema violations.
+func rowEvent(cfg Config, mapper *rowMapper, row csvRow) (model.Event, []string) {
+	if row.change != nil {
+		return newChangeEvent(cfg, row.offset.Row, row.change), nil
+	}
+	payload, violations := mapper.payload(row.record, row.values)
+	if len(violations) > 0 {
+		messages := make([]string, len(violations))
+		for i, v := range violations {
+			messages[i] = v.Error()
+		}
+		return model.Event{}, messages
+	}
+	return newRowEvent(cfg, row.offset.Row, mapper.keyOf(row.record), payload), nil
+}
+
+// openRows opens path and reads its rows as cfg describes, from the start.
+// Archives are not supported.
+func (p *Pipeline) openRows(ctx context.Context, cfg Config) (*rowReader, func(), error) {
+	rc, err := p.source.Open(ctx, cfg.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	in, err := openInput(rc, cfg.FilePath)
+	if err != nil {
+		rc.Close()
+		return nil, nil, err
+	}
+	if in.archive != nil {
+		in.Close()
+		rc.Close()
+		return nil, nil, fmt.Errorf("cannot diff against archive %s", cfg.FilePath)
+	}
+	reader, err := newRowReader(in.r, cfg, Offset{})
+	if err != nil {
+		in.Close()
+		rc.Close()
+		return nil, nil, err
+	}
+	return reader, func() {
+		reader.Close()
+		in.Close()
+		rc.Close()
+	}, nil
+}
+
+// newChangeReader reads the rows of r that changed since cfg.Previous,
+// followed by the rows it no longer has. Unchanged rows are skipped, so
+// rows are numbered by change rather than by position in the file; they do
+// not have byte offsets, and resuming reads both files again up to the
+// resume row.
+func (p *Pipeline) newChangeReader(ctx context.Context, cfg Config, r io.Reader, resume Offset) (*rowReader, error) {
+	if cfg.KeyColumn == "" {
+		return nil, ErrDiffKeyRequired
+	}
+	current, err := newRowReader(r, cfg, Offset{})
+	if err != nil {
+		return nil, err
+	}
+
+	previousCfg := cfg
+	previousCfg.FilePath = cfg.Previous
+	c := &changeReader{
+		current: current,
+		skip:    resume.Row,
+		openPrevious: func() (*rowReader, func(), error) {
+			return p.openRows(ctx, previousCfg)
+		},
+	}
+	if err := c.buildIndex(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &rowReader{records: c, mapper: current.mapper, start: resume, row: resume.Row}, nil
+}
+
+// changeReader compares a file with its previous version through an on-disk
+// index of the digests of the previous rows by key. Rows are compared by
+// their mapped payload, so changes to dropped columns or to the order of
+// columns go unnoticed.
+type changeReader struct {
+	current      *rowReader
+	previous     *rowReader
+	closePrev    func()
+	openPrevious func() (*rowReader, func(), error)
+	index        *diffIndex
+	// skip counts the changes left to skip before the resume row.
+	skip int64
+}
+
+func (c *changeReader) buildIndex() error {
+	previous, closePrevious, err := c.openPrevious()
+	if err != nil {
+		return fmt.Errorf("failed to open previous version: %w", err)
+	}
+	defer closePrevious()
+
+	if c.index, err = newDiffIndex(); err != nil {
+		return err
+	}
+	if previous.mapper.key < 0 {
+		// The previous version is empty: every row is an insert.
+		return nil
+	}
+	for {
+		row, err := previous.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !isMalformed(err) {
+			return fmt.Errorf("failed to read previous version: %w", err)
+		}
+		if err != nil {
+			continue
+		}
+		_, key, digest, ok := digestRow(previous.mapper, row)
+		if !ok {
+			continue
+		}
+		if err := c.index.put(key, digest); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *changeReader) Read() (record, error) {
+	for {
+		rec, err := c.next()
+		if c.skip > 0 && (err == nil || isMalformed(err)) {
+			// Rows before the resume row were handled by a previous run.
+			if err == nil {
+				c.skip--
+			}
+			continue
+		}
+		return rec, err
+	}
+}
+
+func (c *changeReader) next() (record, error) {
+	for c.previous == nil {
+		row, err := c.current.Read()
+		if err == io.EOF {
+			if c.previous, c.closePrev, err = c.openPrevious(); err != nil {
+				return record{}, fmt.Errorf("failed to open previous version: %w", err)
+			}
+			break
+		}
+		rec := record{fields: row.record, values: row.values, line: row.line}
+		if err != nil {
+			return rec, err
+		}
+
+		payload, key, digest, ok := digestRow(c.current.mapper, row)
+		if !ok {
+			// Invalid rows go through unchanged to be rejected.
+			return rec, nil
+		}
+		found, err := c.index.find(key)
+		if err != nil {
+			return record{}, err
+		}
+		op := OpInsert
+		if found != nil {
+			if err := c.index.markSeen(found); err != nil {
+				return record{}, err
+			}
+			if found.digest == digest {
+				continue
+			}
+			op = OpUpdate
+		}
+		rec.change = &change{op: op, key: c.current.mapper.keyOf(row.record), payload: payload}
+		return rec, nil
+	}
+
+	for {
+		row, err := c.previous.Read()
+		if err == io.EOF {
+			return record{}, io.EOF
+		}
+		if err != nil && !isMalformed(err) {
+			return record{}, fmt.Errorf("failed to read previous version: %w", err)
+		}
+		if err != nil || c.previous.mapper.key < 0 {
+			continue
+		}
+		payload, key, _, ok := digestRow(c.previous.mapper, row)
+		if !ok {
+			continue
+		}
+		found, err := c.index.find(key)
+		if err != nil {
+			return record{}, err
+		}
+		if found == nil || found.seen {
+			continue
+		}
+		// Marking the row seen deletes duplicate keys only once.
+		if err := c.index.markSeen(found); err != nil {
+			return record{}, err
+		}
+		return record{fields: row.record, change: &change{op: OpDelete, key: c.previous.mapper.keyOf(row.record), payload: payload}}, nil
+	}
+}
+
+func (c *changeReader) Close() error {
+	if c.closePrev != nil {
+		c.closePrev()
+	}
+	if c.index != nil {
+		c.index.Close()
+	}
+	return c.current.Close()
+}
+
+// digestRow returns the payload of a valid row along with the digests of
+// its key and of the payload.
+func digestRow(mapper *rowMapper, row csvRow) (payload map[string]interface{}, key, digest [16]byte, ok bool) {
+	payload, violations := mapper.payload(row.record, row.values)
+	if len(violations) > 0 {
+		return nil, key, digest, false
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, key, digest, false
+	}
+	keySum := sha256.Sum256([]byte(mapper.keyOf(row.record)))
+	digestSum := sha256.Sum256(data)
+	copy(key[:], keySum[:])
+	copy(digest[:], digestSum[:])
+	return payload, key, digest, true
+}
+
+const (
+	// diffSlotSize holds a key digest, a row digest and flags.
+	diffSlotSize     = 33
+	diffInitialSlots = 1 << 16
+	slotUsed         = 1
+	slotSeen         = 2
+)
+
+// diffIndex is an open addressing hash table of row digests by key digest,
+// kept in a temporary file so that snapshots of any size can be compared in
+// constant memory. It doubles once half full.
+type diffIndex struct {
+	file  *os.File
+	slots int64
+	count int64
+}
+
+type diffSlot struct {
+	pos    int64
+	key    [16]byte
+	digest [16]byte
+	seen   bool
+}
+
+func newDiffIndex() (*diffIndex, error) {
+	return newDiffIndexSize(diffInitialSlots)
+}
+
+func newDiffIndexSize(slots int64) (*diffIndex, error) {
+	file, err := os.CreateTemp("", "ingest-diff-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create diff index: %w", err)
+	}
+	if err := file.Truncate(slots * diffSlotSize); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to create diff index: %w", err)
+	}
+	return &diffIndex{file: file, slots: slots}, nil
+}
+
+// probe returns the slot holding key, or the empty slot it would go to.
+func (x *diffIndex) probe(key [16]byte) (*diffSlot, bool, error) {
+	buf := make([]byte, diffSlotSize)
+	pos := int64(binary.BigEndian.Uint64(key[:8]) % uint64(x.slots))
+	for {
+		if _, err := x.file.ReadAt(buf, pos*diffSlotSize); err != nil {
+			return nil, false, fmt.Errorf("failed to read diff index: %w", err)
+		}
+		if buf[32]&slotUsed == 0 {
+			return &diffSlot{pos: pos, key: key}, false, nil
+		}
+		if [16]byte(buf[:16]) == key {
+			return &diffSlot{pos: pos, key: key, digest: [16]byte(buf[16:32]), seen: buf[32]&slotSeen != 0}, true, nil
+		}
+		pos = (pos + 1) % x.slots
+	}
+}
+
+func (x *diffIndex) write(s *diffSlot, flags byte) error {
+	buf := make([]byte, 0, diffSlotSize)
+	buf = append(append(append(buf, s.key[:]...), s.digest[:]...), flags)
+	if _, err := x.file.WriteAt(buf, s.pos*diffSlotSize); err != nil {
+		return fmt.Errorf("failed to write diff index: %w", err)
+	}
+	return nil
+}
+
+// put sets the digest of key, the last row winning for duplicate keys.
+func (x *diffIndex) put(key, digest [16]byte) error {
+	if 2*(x.count+1) > x.slots {
+		if err := x.grow(); err != nil {
+			return err
+		}
+	}
+	s, found, err := x.probe(key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		x.count++
+	}
+	s.digest = digest
+	return x.write(s, slotUsed)
+}
+
+// find returns the slot of key, nil when absent.
+func (x *diffIndex) find(key [16]byte) (*diffSlot, error) {
+	s, found, err := x.probe(key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (x *diffIndex) markSeen(s *diffSlot) error {
+	s.seen = true
+	return x.write(s, slotUsed|slotSeen)
+}
+
+func (x *diffIndex) grow() error {
+	bigger, err := newDiffIndexSize(2 * x.slots)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(x.file, 0, x.slots*diffSlotSize), 1<<16)
+	buf := make([]byte, diffSlotSize)
+	for {
+		if _, err := io.ReadFull(r, buf); err == io.EOF {
+			break
+		} else if err != nil {
+			bigger.Close()
+			return fmt.Errorf("failed to read diff index: %w", err)
+		}
+		if buf[32]&slotUsed == 0 {
+			continue
+		}
+		if err := bigger.put([16]byte(buf[:16]), [16]byte(buf[16:32])); err != nil {
+			bigger.Close()
+			return err
+		}
+	}
+	x.Close()
+	*x = *bigger
+	return nil
+}
+
+func (x *diffIndex) Close() error {
+	x.file.Close()
+	return os.Remove(x.file.Name())
+}
@@ -0,0 +1,150 @@
+package csv_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// filesSource serves a file per path and keeps the state of each.
+type filesSource struct {
+	*pathSource
+	files map[string]string
+}
+
+func newFilesSource(files map[string]string) *filesSource {
+	return &filesSource{pathSource: newPathSource(nil), files: files}
+}
+
+func (s *filesSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	content, ok := s.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+// changes lists events as op, key and row number.
+func changes(events []model.Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, fmt.Sprintf("%s:%s:%s", e.Payload["op"], e.Key, e.Headers[csv.HeaderRowNumber]))
+	}
+	return out
+}
+
+func TestPipeline_Process_Diff(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		current  string
+		schema   *csv.Schema
+		want     []string
+		rejected []csv.Rejection
+	}{
+		{
+			name:     "inserts updates and deletes",
+			previous: "id,total\n1,10\n2,20\n3,30\n",
+			current:  "id,total\n1,10\n2,25\n4,40\n",
+			want:     []string{"update:2:1", "insert:4:2", "delete:3:3"},
+		},
+		{
+			name:     "column order does not matter",
+			previous: "id,total\n1,10\n",
+			current:  "total,id\n10,1\n",
+		},
+		{
+			name:     "duplicate keys are deleted once",
+			previous: "id,total\n1,10\n1,11\n2,20\n",
+			current:  "id,total\n2,20\n",
+			want:     []string{"delete:1:1"},
+		},
+		{
+			name:     "empty previous version",
+			previous: "",
+			current:  "id,total\n1,10\n2,20\n",
+			want:     []string{"insert:1:1", "insert:2:2"},
+		},
+		{
+			name:     "invalid rows are rejected",
+			previous: "id,total\n1,10\n2,x\n",
+			current:  "id,total\n1,y\n3,30\n",
+			schema:   &csv.Schema{Columns: []csv.Column{{Name: "total", Type: csv.TypeInt}}},
+			want:     []string{"insert:3:2", "delete:1:3"},
+			rejected: []csv.Rejection{{Reason: csv.ReasonInvalid, File: "orders_2025_02.csv", Row: 1, Line: 2, Record: []string{"1", "y"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newFilesSource(map[string]string{"orders_2025_01.csv": tt.previous, "orders_2025_02.csv": tt.current})
+			quarantine := &memQuarantine{}
+			cfg := csv.Config{FilePath: "orders_2025_02.csv", Previous: "orders_2025_01.csv", KeyColumn: "id", Schema: tt.schema, Rejects: quarantine}
+
+			events, err := processFormat(t, source, cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, changes(events))
+			for _, e := range events {
+				assert.Equal(t, "bulk_change", e.Type)
+			}
+
+			for i := range quarantine.rejections {
+				quarantine.rejections[i].Violations = nil
+			}
+			assert.Equal(t, tt.rejected, quarantine.rejections)
+			assert.True(t, source.completed["orders_2025_02.csv"])
+		})
+	}
+}
+
+func TestPipeline_Process_DiffPayload(t *testing.T) {
+	source := newFilesSource(map[string]string{
+		"prev.csv": "id,total\n1,10\n2,20\n",
+		"cur.csv":  "id,total\n1,15\n",
+	})
+	events, err := processFormat(t, source, csv.Config{FilePath: "cur.csv", Previous: "prev.csv", KeyColumn: "id"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, map[string]interface{}{"op": csv.OpUpdate, "row": map[string]interface{}{"id": "1", "total": "15"}}, events[0].Payload)
+	assert.Equal(t, map[string]interface{}{"op": csv.OpDelete, "row": map[string]interface{}{"id": "2", "total": "20"}}, events[1].Payload)
+}
+
+func TestPipeline_Process_DiffResume(t *testing.T) {
+	var previous, current strings.Builder
+	previous.WriteString("id,total\n")
+	current.WriteString("id,total\n")
+	// Enough rows for the index to outgrow its initial size.
+	for i := 0; i < 40000; i++ {
+		fmt.Fprintf(&previous, "%d,%d\n", i, i)
+		total := i
+		if i%10000 == 1 {
+			total = -i
+		}
+		fmt.Fprintf(&current, "%d,%d\n", i, total)
+	}
+	source := newFilesSource(map[string]string{"prev.csv": previous.String(), "cur.csv": current.String()})
+	// A previous run published the first two changes.
+	source.checkpoints["cur.csv"] = csv.Offset{Row: 2}
+
+	events, err := processFormat(t, source, csv.Config{FilePath: "cur.csv", Previous: "prev.csv", KeyColumn: "id"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update:20001:3", "update:30001:4"}, changes(events))
+	assert.Equal(t, csv.Offset{Row: 4}, source.checkpoints["cur.csv"])
+}
+
+func TestPipeline_Process_DiffErrors(t *testing.T) {
+	source := newFilesSource(map[string]string{"cur.csv": "id\n1\n", "prev.csv": "id\n1\n"})
+
+	_, err := processFormat(t, source, csv.Config{FilePath: "cur.csv", Previous: "prev.csv"})
+	assert.ErrorIs(t, err, csv.ErrDiffKeyRequired)
+
+	_, err = processFormat(t, source, csv.Config{FilePath: "cur.csv", Previous: "missing.csv", KeyColumn: "id"})
+	assert.ErrorContains(t, err, "previous version")
+}
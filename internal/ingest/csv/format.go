@@ -0,0 +1,301 @@
+package csv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats of bulk files.
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+var ErrInvalidFormat = errors.New("invalid file format")
+
+// Format describes how records are laid out in a file.
+type Format struct {
+	// Type is FormatCSV, FormatJSONL or FormatParquet. When empty it follows
+	// the extension of the file: .jsonl and .ndjson are JSON Lines, .parquet
+	// is Parquet, anything else is delimited text.
+	Type string `json:"type,omitempty"`
+	// Delimiter separates the fields of delimited text. Defaults to a comma,
+	// or a tab for .tsv and .tab files.
+	Delimiter string `json:"delimiter,omitempty"`
+	// Quote encloses fields of delimited text. Defaults to a double quote.
+	Quote string `json:"quote,omitempty"`
+	// Comment starts lines of delimited text that are ignored.
+	Comment string `json:"comment,omitempty"`
+	// LazyQuotes accepts quotes in unquoted fields and unescaped quotes in
+	// quoted ones.
+	LazyQuotes bool `json:"lazy_quotes,omitempty"`
+}
+
+// resolve fills in what the format leaves to the extension of name.
+func (f Format) resolve(name string) (Format, error) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	ext := strings.ToLower(path.Ext(name))
+	if f.Type == "" {
+		switch ext {
+		case ".jsonl", ".ndjson":
+			f.Type = FormatJSONL
+		case ".parquet":
+			f.Type = FormatParquet
+		default:
+			f.Type = FormatCSV
+		}
+	}
+	if f.Type == FormatCSV && f.Delimiter == "" && (ext == ".tsv" || ext == ".tab") {
+		f.Delimiter = "\t"
+	}
+	return f, f.Validate()
+}
+
+// Validate checks the type and the delimited text characters, if any.
+func (f Format) Validate() error {
+	switch f.Type {
+	case FormatJSONL, FormatParquet:
+		return nil
+	case FormatCSV, "":
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidFormat, f.Type)
+	}
+
+	delimiter, quote, comment := f.runes()
+	switch {
+	case delimiter == utf8.RuneError:
+		return fmt.Errorf("%w: delimiter must be a single character", ErrInvalidFormat)
+	case quote == utf8.RuneError || quote >= utf8.RuneSelf:
+		return fmt.Errorf("%w: quote must be a single ASCII character", ErrInvalidFormat)
+	case comment == utf8.RuneError:
+		return fmt.Errorf("%w: comment must be a single character", ErrInvalidFormat)
+	case delimiter == quote || (comment != 0 && (comment == delimiter || comment == quote)):
+		return fmt.Errorf("%w: delimiter, quote and comment must differ", ErrInvalidFormat)
+	case strings.ContainsAny(string([]rune{delimiter, quote, comment}), "\r\n"):
+		return fmt.Errorf("%w: delimiter, quote and comment cannot be line breaks", ErrInvalidFormat)
+	}
+	return nil
+}
+
+// runes returns the delimiter, quote and comment characters, RuneError for
+// those that are not a single character and 0 for no comment.
+func (f Format) runes() (delimiter, quote, comment rune) {
+	single := func(s string, def rune) rune {
+		if s == "" {
+			return def
+		}
+		if r, size := utf8.DecodeRuneInString(s); size == len(s) {
+			return r
+		}
+		return utf8.RuneError
+	}
+	return single(f.Delimiter, ','), single(f.Quote, '"'), single(f.Comment, 0)
+}
+
+// record is one record of a file: its fields as text, the native values
+// they hold for typed formats, the byte offset just after it, 0 when
+// offsets are unknown, and the line it starts at, 0 when unknown. Records
+// of a snapshot diff carry their change.
+type record struct {
+	fields []string
+	values []any
+	end    int64
+	line   int64
+	change *change
+}
+
+// recordReader reads the records of a file in one format, having consumed
+// or inferred its header and moved past the resume offset. Read returns
+// io.EOF after the last record. A record that cannot be parsed comes with
+// a *malformedError; it is rejected and reading goes on. Any other error
+// ends the ingestion.
+type recordReader interface {
+	Read() (record, error)
+	Close() error
+}
+
+type malformedError struct {
+	err error
+}
+
+func (e *malformedError) Error() string { return e.err.Error() }
+
+func (e *malformedError) Unwrap() error { return e.err }
+
+// isMalformed tells malformed records, which are skipped, from failures of
+// the underlying reader, which end the ingestion.
+func isMalformed(err error) bool {
+	var malformed *malformedError
+	return errors.As(err, &malformed)
+}
+
+// delimitedReader reads CSV, TSV and other delimited text.
+type delimitedReader struct {
+	reader  *csv.Reader
+	format  Format
+	pending []string
+	// base is the file offset the csv reader started at.
+	base int64
+	// seeked is set once the reader seeked past the start of the file, from
+	// which point line numbers are unknown.
+	seeked bool
+	// quote is swapped with the double quote encoding/csv expects, when it
+	// is another character. Swapping single bytes keeps offsets intact.
+	quote byte
+}
+
+// newDelimitedReader reads the header of r, or names the columns after
+// mapping when the file has none, and positions the reader just after the
+// resume offset. It returns a nil header for an empty file.
+func newDelimitedReader(r io.Reader, format Format, noHeader bool, mapping *Mapping, resume Offset) (*delimitedReader, []string, error) {
+	d := &delimitedReader{format: format}
+	if _, quote, _ := format.runes(); quote != '"' {
+		d.quote = byte(quote)
+	}
+	d.reader = d.newReader(r)
+
+	first, err := d.reader.Read()
+	if err == io.EOF {
+		return d, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read first CSV row: %w", err)
+	}
+	first = d.unswap(first)
+
+	header := first
+	if noHeader {
+		d.pending = first
+		if header, err = positionalHeader(len(first), mapping); err != nil {
+			return nil, nil, err
+		}
+	} else if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	if resume.Bytes > 0 {
+		if err := d.skipTo(r, resume, len(first)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return d, header, nil
+}
+
+func (d *delimitedReader) newReader(r io.Reader) *csv.Reader {
+	if d.quote != 0 {
+		r = &swapReader{r: r, a: d.quote, b: '"'}
+	}
+	reader := csv.NewReader(r)
+	delimiter, _, comment := d.format.runes()
+	reader.Comma = swapRune(delimiter, d.quote)
+	reader.Comment = swapRune(comment, d.quote)
+	reader.LazyQuotes = d.format.LazyQuotes
+	return reader
+}
+
+// skipTo moves past the rows before resume, seeking when the source allows
+// it and reading through them otherwise.
+func (d *delimitedReader) skipTo(src io.Reader, resume Offset, width int) error {
+	d.pending = nil
+
+	if seeker, ok := src.(io.Seeker); ok {
+		if _, err := seeker.Seek(resume.Bytes, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to resume offset: %w", err)
+		}
+		d.reader = d.newReader(src)
+		d.reader.FieldsPerRecord = width
+		d.base = resume.Bytes
+		d.seeked = true
+		return nil
+	}
+
+	for d.reader.InputOffset() < resume.Bytes {
+		_, err := d.reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.As(err, new(*csv.ParseError)) {
+			return fmt.Errorf("failed to skip to resume offset: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *delimitedReader) Read() (record, error) {
+	fields := d.pending
+	if fields != nil {
+		d.pending = nil
+	} else {
+		var err error
+		if fields, err = d.reader.Read(); err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return record{fields: d.unswap(fields), line: d.line(parseErr.StartLine)}, &malformedError{err: err}
+			}
+			return record{}, err
+		}
+		fields = d.unswap(fields)
+	}
+
+	line, _ := d.reader.FieldPos(0)
+	return record{fields: fields, end: d.base + d.reader.InputOffset(), line: d.line(line)}, nil
+}
+
+func (d *delimitedReader) line(line int) int64 {
+	if d.seeked {
+		return 0
+	}
+	return int64(line)
+}
+
+func (d *delimitedReader) unswap(fields []string) []string {
+	if d.quote == 0 {
+		return fields
+	}
+	for i, field := range fields {
+		fields[i] = strings.Map(func(r rune) rune { return swapRune(r, d.quote) }, field)
+	}
+	return fields
+}
+
+func (d *delimitedReader) Close() error {
+	return nil
+}
+
+// swapRune exchanges quote and the double quote, leaving other runes alone.
+func swapRune(r rune, quote byte) rune {
+	switch {
+	case quote == 0:
+		return r
+	case r == rune(quote):
+		return '"'
+	case r == '"':
+		return rune(quote)
+	}
+	return r
+}
+
+// swapReader exchanges two bytes in everything it reads.
+type swapReader struct {
+	r    io.Reader
+	a, b byte
+}
+
+func (s *swapReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i, c := range p[:n] {
+		switch c {
+		case s.a:
+			p[i] = s.b
+		case s.b:
+			p[i] = s.a
+		}
+	}
+	return n, err
+}
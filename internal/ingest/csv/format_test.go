@@ -0,0 +1,242 @@
+package csv_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type parquetOrder struct {
+	ID    int64    `parquet:"id"`
+	SKU   string   `parquet:"sku"`
+	Price float64  `parquet:"price"`
+	Paid  bool     `parquet:"paid"`
+	Note  *string  `parquet:"note,optional"`
+	Tags  []string `parquet:"tags,list"`
+}
+
+func parquetFile(t *testing.T, rows []parquetOrder, options ...parquet.WriterOption) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, parquet.Write(&buf, rows, options...))
+	return buf.Bytes()
+}
+
+func payloads(events []model.Event) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, e := range events {
+		out = append(out, e.Payload)
+	}
+	return out
+}
+
+func processFormat(t *testing.T, source csv.FileSource, cfg csv.Config) ([]model.Event, error) {
+	t.Helper()
+
+	producer := &bulkProducer{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg.WorkerCount = 1
+	cfg.BatchSize = 10
+	err := csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg)
+
+	var events []model.Event
+	for _, batch := range producer.batches {
+		events = append(events, batch...)
+	}
+	return events, err
+}
+
+func TestPipeline_Process_Formats(t *testing.T) {
+	note := "gift"
+
+	tests := []struct {
+		name      string
+		file      string
+		format    csv.Format
+		schema    *csv.Schema
+		content   func(t *testing.T) []byte
+		want      []map[string]interface{}
+		malformed []string
+	}{
+		{
+			name:    "tsv by extension",
+			file:    "orders.tsv",
+			content: func(t *testing.T) []byte { return []byte("id\tname\n1\ta,b\n") },
+			want:    []map[string]interface{}{{"id": "1", "name": "a,b"}},
+		},
+		{
+			name:    "custom delimiter",
+			file:    "orders.csv",
+			format:  csv.Format{Delimiter: ";"},
+			content: func(t *testing.T) []byte { return []byte("id;name\n1;a,b\n") },
+			want:    []map[string]interface{}{{"id": "1", "name": "a,b"}},
+		},
+		{
+			name:    "custom quote",
+			file:    "orders.csv",
+			format:  csv.Format{Quote: "'"},
+			content: func(t *testing.T) []byte { return []byte("id,name\n1,'a,\"b\" ''c'''\n") },
+			want:    []map[string]interface{}{{"id": "1", "name": `a,"b" 'c'`}},
+		},
+		{
+			name:    "comment lines",
+			file:    "orders.csv",
+			format:  csv.Format{Comment: "#"},
+			content: func(t *testing.T) []byte { return []byte("# exported\nid,name\n1,x\n# note\n2,y\n") },
+			want:    []map[string]interface{}{{"id": "1", "name": "x"}, {"id": "2", "name": "y"}},
+		},
+		{
+			name:    "lazy quotes",
+			file:    "orders.csv",
+			format:  csv.Format{LazyQuotes: true},
+			content: func(t *testing.T) []byte { return []byte("id,name\n1,a \"b\" c\n") },
+			want:    []map[string]interface{}{{"id": "1", "name": `a "b" c`}},
+		},
+		{
+			name: "jsonl native values",
+			file: "orders.jsonl",
+			content: func(t *testing.T) []byte {
+				return []byte(`{"id":1,"sku":"A","price":2.5,"paid":true,"tags":["x"]}` + "\n\n" + `{"id":2,"sku":"B","price":3,"paid":false,"tags":null}` + "\n")
+			},
+			want: []map[string]interface{}{
+				{"id": int64(1), "sku": "A", "price": 2.5, "paid": true, "tags": []interface{}{"x"}},
+				{"id": int64(2), "sku": "B", "price": int64(3), "paid": false, "tags": nil},
+			},
+		},
+		{
+			name:   "jsonl with schema",
+			file:   "orders.ndjson",
+			schema: &csv.Schema{Columns: []csv.Column{{Name: "id", Type: csv.TypeString}, {Name: "price", Type: csv.TypeDecimal}}},
+			content: func(t *testing.T) []byte {
+				return []byte(`{"id":1,"price":2.5}` + "\n" + `{"id":2,"price":"n/a"}` + "\n")
+			},
+			want: []map[string]interface{}{{"id": "1", "price": json.Number("2.5")}},
+		},
+		{
+			name:   "jsonl malformed lines",
+			file:   "orders.json",
+			format: csv.Format{Type: csv.FormatJSONL},
+			content: func(t *testing.T) []byte {
+				return []byte(`{"id":1}` + "\n" + "not json\n" + `{"id":2,"extra":true}` + "\n" + `{"id":3}` + "\n")
+			},
+			want:      []map[string]interface{}{{"id": int64(1)}, {"id": int64(3)}},
+			malformed: []string{"not json", `{"id":2,"extra":true}`},
+		},
+		{
+			name: "parquet",
+			file: "orders.parquet",
+			content: func(t *testing.T) []byte {
+				return parquetFile(t, []parquetOrder{
+					{ID: 1, SKU: "A", Price: 2.5, Paid: true, Note: &note, Tags: []string{"x", "y"}},
+					{ID: 2, SKU: "B", Price: 3},
+				})
+			},
+			want: []map[string]interface{}{
+				{"id": int64(1), "sku": "A", "price": 2.5, "paid": true, "note": "gift", "tags.list.element": []interface{}{"x", "y"}},
+				{"id": int64(2), "sku": "B", "price": 3.0, "paid": false, "note": nil, "tags.list.element": []interface{}{}},
+			},
+		},
+		{
+			name:   "gzipped parquet with schema",
+			file:   "orders.parquet.gz",
+			schema: &csv.Schema{Columns: []csv.Column{{Name: "id", Type: csv.TypeString}, {Name: "note", Type: csv.TypeString, Nullable: true}}},
+			content: func(t *testing.T) []byte {
+				return gzipped(t, parquetFile(t, []parquetOrder{{ID: 7, SKU: "A", Note: &note}}))
+			},
+			want: []map[string]interface{}{
+				{"id": "7", "sku": "A", "price": 0.0, "paid": false, "note": "gift", "tags.list.element": []interface{}{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quarantine := &memQuarantine{}
+			cfg := csv.Config{FilePath: tt.file, Format: tt.format, Schema: tt.schema, Rejects: quarantine}
+			events, err := processFormat(t, newPathSource(tt.content(t)), cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, payloads(events))
+
+			var malformed []string
+			for _, r := range quarantine.rejections {
+				if r.Reason == csv.ReasonMalformed {
+					malformed = append(malformed, r.Record...)
+				}
+			}
+			assert.Equal(t, tt.malformed, malformed)
+		})
+	}
+}
+
+func TestPipeline_Process_InvalidFormat(t *testing.T) {
+	for _, format := range []csv.Format{{Type: "xlsx"}, {Delimiter: ";;"}, {Quote: "é"}, {Delimiter: "\n"}, {Quote: ","}} {
+		_, err := processFormat(t, newPathSource([]byte("id\n1\n")), csv.Config{FilePath: "orders.csv", Format: format})
+		assert.ErrorIs(t, err, csv.ErrInvalidFormat, "%+v", format)
+	}
+}
+
+func TestPipeline_Process_FormatResume(t *testing.T) {
+	jsonl := `{"id":1}` + "\n" + `{"id":2}` + "\n" + `{"id":3}` + "\n"
+	var orders []parquetOrder
+	for i := int64(1); i <= 5; i++ {
+		orders = append(orders, parquetOrder{ID: i, SKU: "A"})
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		content  []byte
+		seekable bool
+		resume   csv.Offset
+		want     []interface{}
+	}{
+		{
+			name:    "jsonl read through",
+			file:    "orders.jsonl",
+			content: []byte(jsonl),
+			resume:  csv.Offset{Bytes: int64(len(`{"id":1}` + "\n")), Row: 1},
+			want:    []interface{}{int64(2), int64(3)},
+		},
+		{
+			name:     "jsonl seek",
+			file:     "orders.jsonl",
+			content:  []byte(jsonl),
+			seekable: true,
+			resume:   csv.Offset{Bytes: int64(len(`{"id":1}` + "\n" + `{"id":2}` + "\n")), Row: 2},
+			want:     []interface{}{int64(3)},
+		},
+		{
+			name:     "parquet across row groups",
+			file:     "orders.parquet",
+			content:  parquetFile(t, orders, parquet.MaxRowsPerRowGroup(2)),
+			seekable: true,
+			resume:   csv.Offset{Row: 3},
+			want:     []interface{}{int64(4), int64(5)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &memSource{content: tt.content, seekable: tt.seekable, checkpoint: tt.resume}
+			events, err := processFormat(t, source, csv.Config{FilePath: tt.file})
+			require.NoError(t, err)
+
+			var ids []interface{}
+			for _, e := range events {
+				ids = append(ids, e.Payload["id"])
+			}
+			assert.Equal(t, tt.want, ids)
+			assert.True(t, source.completed)
+			assert.Equal(t, tt.resume.Row+int64(len(tt.want)), source.checkpoint.Row)
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package csv
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// memberSeparator joins the path of an archive and the name of one of its
+// members into the path the member is checkpointed under.
+const memberSeparator = "!/"
+
+// MemberPath returns the path a member of an archive is ingested as.
+func MemberPath(archive, member string) string {
+	return archive + memberSeparator + member
+}
+
+// SplitMemberPath splits a path returned by MemberPath.
+func SplitMemberPath(p string) (archive, member string, ok bool) {
+	return strings.Cut(p, memberSeparator)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte{'P', 'K', 0x03, 0x04}
+	// zipEmptyMagic starts the end of central directory of an empty zip.
+	zipEmptyMagic = []byte{'P', 'K', 0x05, 0x06}
+)
+
+// headerSize covers the magic bytes of every supported format, the ustar
+// magic of tar headers being the furthest at offset 257.
+const headerSize = 262
+
+// input is an opened file: either one CSV stream or an archive of them.
+type input struct {
+	r       io.Reader
+	archive archive
+	// closer releases the decompressor of r, if any.
+	closer io.Closer
+}
+
+func (in *input) Close() error {
+	if in.archive != nil {
+		return in.archive.Close()
+	}
+	if in.closer != nil {
+		return in.closer.Close()
+	}
+	return nil
+}
+
+// archive iterates the CSV members of an archive. Next returns io.EOF after
+// the last one.
+type archive interface {
+	Next() (name string, r io.Reader, err error)
+	Close() error
+}
+
+// openInput detects from magic bytes, or the extension of name, whether rc
+// is compressed with gzip or zstd and whether it is a zip or tar archive.
+// An uncompressed file keeps its io.Seeker, if any, so it can still be
+// resumed by seeking.
+func openInput(rc io.Reader, name string) (*input, error) {
+	head, err := readHead(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(head, zipMagic) || bytes.HasPrefix(head, zipEmptyMagic) {
+		a, err := openZip(rc, head)
+		if err != nil {
+			return nil, err
+		}
+		return &input{archive: a}, nil
+	}
+
+	if !isCompressed(head) {
+		if isTar(head, name) {
+			return &input{archive: newTarArchive(io.MultiReader(bytes.NewReader(head), rc))}, nil
+		}
+		return &input{r: rewind(rc, head)}, nil
+	}
+
+	dec, err := decompress(head, io.MultiReader(bytes.NewReader(head), rc))
+	if err != nil {
+		return nil, err
+	}
+	if head, err = readHead(dec); err != nil {
+		dec.Close()
+		return nil, err
+	}
+	r := io.MultiReader(bytes.NewReader(head), dec)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	if isTar(head, name) || strings.HasSuffix(name, ".tgz") {
+		a := newTarArchive(r)
+		a.closer = dec
+		return &input{archive: a}, nil
+	}
+	return &input{r: r, closer: dec}, nil
+}
+
+func readHead(r io.Reader) ([]byte, error) {
+	head := make([]byte, headerSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+	return head[:n], nil
+}
+
+// rewind returns a reader of the whole of rc, whose head was read already.
+func rewind(rc io.Reader, head []byte) io.Reader {
+	if seeker, ok := rc.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err == nil {
+			return rc
+		}
+	}
+	return io.MultiReader(bytes.NewReader(head), rc)
+}
+
+func isCompressed(head []byte) bool {
+	return bytes.HasPrefix(head, gzipMagic) || bytes.HasPrefix(head, zstdMagic)
+}
+
+// decompress reads r, starting with head, with the decompressor head calls
+// for.
+func decompress(head []byte, r io.Reader) (io.ReadCloser, error) {
+	if bytes.HasPrefix(head, zstdMagic) {
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd stream: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gzip stream: %w", err)
+	}
+	return gz, nil
+}
+
+func isTar(head []byte, name string) bool {
+	if len(head) >= headerSize && string(head[257:262]) == "ustar" {
+		return true
+	}
+	return strings.HasSuffix(name, ".tar")
+}
+
+// isMember tells files worth ingesting from the metadata archivers leave
+// behind.
+func isMember(name string) bool {
+	return !strings.HasPrefix(name, "__MACOSX/") && !strings.HasPrefix(path.Base(name), ".")
+}
+
+// openMember decompresses a member that is itself gzip or zstd compressed.
+func openMember(r io.Reader) (io.ReadCloser, error) {
+	head, err := readHead(r)
+	if err != nil {
+		return nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(head), r)
+	if isCompressed(head) {
+		return decompress(head, r)
+	}
+	return io.NopCloser(r), nil
+}
+
+// zipArchive reads members in the order of the central directory.
+type zipArchive struct {
+	reader *zip.Reader
+	next   int
+	// current holds the readers of the member being read.
+	current []io.Closer
+	cleanup func()
+}
+
+func openZip(rc io.Reader, head []byte) (*zipArchive, error) {
+	ra, size, cleanup, err := randomAccess(rc, head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	reader, err := zip.NewReader(ra, size)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	return &zipArchive{reader: reader, cleanup: cleanup}, nil
+}
+
+// randomAccess returns r as an io.ReaderAt along with its size. Zip and
+// Parquet need random access, so files that cannot provide it are spooled,
+// starting with the head already read from r, to a temporary file which
+// cleanup removes.
+func randomAccess(r io.Reader, head []byte) (io.ReaderAt, int64, func(), error) {
+	ra, ok := r.(io.ReaderAt)
+	if seeker, seekable := r.(io.Seeker); ok && seekable {
+		size, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to size file: %w", err)
+		}
+		return ra, size, func() {}, nil
+	}
+
+	spool, err := os.CreateTemp("", "ingest-*")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to spool file: %w", err)
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	size, err := io.Copy(spool, io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("failed to spool file: %w", err)
+	}
+	return spool, size, cleanup, nil
+}
+
+func (a *zipArchive) Next() (string, io.Reader, error) {
+	a.closeCurrent()
+	for a.next < len(a.reader.File) {
+		f := a.reader.File[a.next]
+		a.next++
+		if !f.Mode().IsRegular() || !isMember(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to open %s in zip archive: %w", f.Name, err)
+		}
+		a.current = append(a.current, rc)
+		r, err := openMember(rc)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to open %s in zip archive: %w", f.Name, err)
+		}
+		a.current = append(a.current, r)
+		return f.Name, r, nil
+	}
+	return "", nil, io.EOF
+}
+
+func (a *zipArchive) closeCurrent() {
+	for _, c := range a.current {
+		c.Close()
+	}
+	a.current = nil
+}
+
+func (a *zipArchive) Close() error {
+	a.closeCurrent()
+	a.cleanup()
+	return nil
+}
+
+// tarArchive streams members in file order.
+type tarArchive struct {
+	r       io.Reader
+	reader  *tar.Reader
+	current io.Closer
+	// closer releases the decompressor of a compressed archive.
+	closer io.Closer
+}
+
+func newTarArchive(r io.Reader) *tarArchive {
+	return &tarArchive{r: r, reader: tar.NewReader(r)}
+}
+
+func (a *tarArchive) Next() (string, io.Reader, error) {
+	if a.current != nil {
+		a.current.Close()
+		a.current = nil
+	}
+	for {
+		header, err := a.reader.Next()
+		if errors.Is(err, io.EOF) {
+			// Read the padding after the last member too, so that readers
+			// verifying the whole file see all of it.
+			if _, err := io.Copy(io.Discard, a.r); err != nil {
+				return "", nil, fmt.Errorf("failed to read tar archive: %w", err)
+			}
+			return "", nil, io.EOF
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !isMember(header.Name) {
+			continue
+		}
+		r, err := openMember(a.reader)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to open %s in tar archive: %w", header.Name, err)
+		}
+		a.current = r
+		return header.Name, r, nil
+	}
+}
+
+func (a *tarArchive) Close() error {
+	if a.current != nil {
+		a.current.Close()
+	}
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// countBytes counts the bytes read from r, keeping the io.Seeker and
+// io.ReaderAt it implements so that resuming and random access still work.
+func countBytes(r io.Reader, counter prometheus.Counter) io.Reader {
+	c := &byteCounter{r: r, counter: counter}
+	seeker, seekable := r.(io.Seeker)
+	at, ok := r.(io.ReaderAt)
+	switch {
+	case seekable && ok:
+		return &seekableByteCounter{byteCounter: c, Seeker: seeker, at: at}
+	case seekable:
+		return struct {
+			*byteCounter
+			io.Seeker
+		}{c, seeker}
+	}
+	return c
+}
+
+type byteCounter struct {
+	r       io.Reader
+	counter prometheus.Counter
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.counter.Add(float64(n))
+	return n, err
+}
+
+type seekableByteCounter struct {
+	*byteCounter
+	io.Seeker
+	at io.ReaderAt
+}
+
+func (c *seekableByteCounter) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.at.ReadAt(p, off)
+	c.counter.Add(float64(n))
+	return n, err
+}
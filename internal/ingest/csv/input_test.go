@@ -0,0 +1,231 @@
+package csv_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pathSource serves one file and keeps the state of every path, as archive
+// members are checkpointed on their own.
+type pathSource struct {
+	content []byte
+
+	mu          sync.Mutex
+	checkpoints map[string]csv.Offset
+	completed   map[string]bool
+}
+
+func newPathSource(content []byte) *pathSource {
+	return &pathSource{content: content, checkpoints: make(map[string]csv.Offset), completed: make(map[string]bool)}
+}
+
+func (s *pathSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.content)), nil
+}
+
+func (s *pathSource) Checkpoint(ctx context.Context, path string, offset csv.Offset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[path] = offset
+	return nil
+}
+
+func (s *pathSource) ResumeOffset(ctx context.Context, path string) (csv.Offset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoints[path], nil
+}
+
+func (s *pathSource) MarkCompleted(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed[path] = true
+	return nil
+}
+
+type archiveFile struct {
+	name, content string
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdCompressed(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := w.Create(f.name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(f.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func tarred(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, f := range files {
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}))
+		_, err := w.Write([]byte(f.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// published lists the events as file path and row number, in row order
+// within each file.
+func published(events []model.Event) map[string][]string {
+	rows := make(map[string][]string)
+	for _, e := range events {
+		file := e.Headers[csv.HeaderFilePath]
+		rows[file] = append(rows[file], e.Headers[csv.HeaderRowNumber]+":"+e.Payload["sku"].(string))
+	}
+	return rows
+}
+
+func TestPipeline_Process_CompressedAndArchived(t *testing.T) {
+	orders := "id,sku\n1,A\n2,B\n"
+	refunds := "id,sku\n1,R\n"
+
+	tests := []struct {
+		name    string
+		file    string
+		content func(t *testing.T) []byte
+		want    map[string][]string
+	}{
+		{
+			name:    "plain",
+			file:    "orders.csv",
+			content: func(t *testing.T) []byte { return []byte(orders) },
+			want:    map[string][]string{"orders.csv": {"1:A", "2:B"}},
+		},
+		{
+			name:    "gzip",
+			file:    "orders.csv.gz",
+			content: func(t *testing.T) []byte { return gzipped(t, []byte(orders)) },
+			want:    map[string][]string{"orders.csv.gz": {"1:A", "2:B"}},
+		},
+		{
+			name:    "zstd detected without extension",
+			file:    "orders.csv",
+			content: func(t *testing.T) []byte { return zstdCompressed(t, []byte(orders)) },
+			want:    map[string][]string{"orders.csv": {"1:A", "2:B"}},
+		},
+		{
+			name: "zip",
+			file: "bundle.zip",
+			content: func(t *testing.T) []byte {
+				return zipped(t,
+					archiveFile{"orders.csv", orders},
+					archiveFile{"__MACOSX/._orders.csv", "junk"},
+					archiveFile{"2025/refunds.csv.gz", string(gzipped(t, []byte(refunds)))},
+				)
+			},
+			want: map[string][]string{
+				"bundle.zip!/orders.csv":          {"1:A", "2:B"},
+				"bundle.zip!/2025/refunds.csv.gz": {"1:R"},
+			},
+		},
+		{
+			name: "tar",
+			file: "bundle.tar",
+			content: func(t *testing.T) []byte {
+				return tarred(t, archiveFile{"orders.csv", orders}, archiveFile{".DS_Store", "junk"}, archiveFile{"refunds.csv", refunds})
+			},
+			want: map[string][]string{
+				"bundle.tar!/orders.csv":  {"1:A", "2:B"},
+				"bundle.tar!/refunds.csv": {"1:R"},
+			},
+		},
+		{
+			name: "gzipped tar",
+			file: "bundle.tgz",
+			content: func(t *testing.T) []byte {
+				return gzipped(t, tarred(t, archiveFile{"orders.csv", orders}, archiveFile{"refunds.csv", refunds}))
+			},
+			want: map[string][]string{
+				"bundle.tgz!/orders.csv":  {"1:A", "2:B"},
+				"bundle.tgz!/refunds.csv": {"1:R"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newPathSource(tt.content(t))
+			producer := &bulkProducer{}
+			logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+			cfg := csv.Config{FilePath: tt.file, WorkerCount: 1, BatchSize: 10}
+			require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg))
+
+			var events []model.Event
+			for _, batch := range producer.batches {
+				events = append(events, batch...)
+			}
+			assert.Equal(t, tt.want, published(events))
+			assert.True(t, source.completed[tt.file])
+			for file := range tt.want {
+				assert.True(t, source.completed[file], file)
+			}
+		})
+	}
+}
+
+func TestPipeline_Process_ArchiveResume(t *testing.T) {
+	orders := "id,sku\n1,A\n2,B\n"
+	refunds := "id,sku\n1,R\n2,S\n3,T\n"
+	source := newPathSource(zipped(t, archiveFile{"orders.csv", orders}, archiveFile{"refunds.csv", refunds}))
+
+	// A previous run finished orders.csv and got through the first refund.
+	source.checkpoints["bundle.zip!/orders.csv"] = csv.Offset{Bytes: int64(len(orders)), Row: 2}
+	source.completed["bundle.zip!/orders.csv"] = true
+	source.checkpoints["bundle.zip!/refunds.csv"] = csv.Offset{Bytes: int64(len("id,sku\n1,R\n")), Row: 1}
+
+	producer := &bulkProducer{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{FilePath: "bundle.zip", WorkerCount: 2, BatchSize: 1}
+	require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg))
+
+	var events []model.Event
+	for _, batch := range producer.batches {
+		events = append(events, batch...)
+	}
+	rows := published(events)
+	assert.ElementsMatch(t, []string{"2:S", "3:T"}, rows["bundle.zip!/refunds.csv"])
+	assert.Empty(t, rows["bundle.zip!/orders.csv"])
+	assert.Equal(t, csv.Offset{Bytes: int64(len(refunds)), Row: 3}, source.checkpoints["bundle.zip!/refunds.csv"])
+}
@@ -0,0 +1,216 @@
+package csv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// jsonlReader reads JSON Lines: one object per line, blank lines ignored.
+// Its columns are the mapping columns or else the keys of the first object,
+// sorted; objects with other keys are malformed.
+type jsonlReader struct {
+	reader  *bufio.Reader
+	columns map[string]int
+	pending *record
+	// offset is the file offset reached, and line the last line read.
+	offset int64
+	line   int64
+	// seeked is set once the reader seeked past the start of the file, from
+	// which point line numbers are unknown.
+	seeked bool
+}
+
+// newJSONLReader reads the first object of r to name the columns, unless
+// mapping does, and positions the reader just after the resume offset. It
+// returns a nil header for an empty file.
+func newJSONLReader(r io.Reader, mapping *Mapping, resume Offset) (*jsonlReader, []string, error) {
+	j := &jsonlReader{reader: bufio.NewReader(r)}
+
+	var header []string
+	if mapping != nil && len(mapping.Columns) > 0 {
+		header = mapping.Columns
+		j.index(header)
+	} else {
+		line, err := j.next()
+		if err == io.EOF {
+			return j, nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read first JSON line: %w", err)
+		}
+		object, err := decodeObject(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read first JSON line: %w", err)
+		}
+		for key := range object {
+			header = append(header, key)
+		}
+		slices.Sort(header)
+		j.index(header)
+
+		rec, _ := j.record(line)
+		j.pending = &rec
+	}
+
+	if resume.Bytes > 0 {
+		if err := j.skipTo(r, resume); err != nil {
+			return nil, nil, err
+		}
+	}
+	return j, header, nil
+}
+
+func (j *jsonlReader) index(header []string) {
+	j.columns = make(map[string]int, len(header))
+	for i, column := range header {
+		j.columns[column] = i
+	}
+}
+
+// skipTo moves past the lines before resume, seeking when the source allows
+// it and reading through them otherwise.
+func (j *jsonlReader) skipTo(src io.Reader, resume Offset) error {
+	j.pending = nil
+
+	if seeker, ok := src.(io.Seeker); ok {
+		if _, err := seeker.Seek(resume.Bytes, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to resume offset: %w", err)
+		}
+		j.reader = bufio.NewReader(src)
+		j.offset = resume.Bytes
+		j.seeked = true
+		return nil
+	}
+
+	for j.offset < resume.Bytes {
+		if _, err := j.next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to skip to resume offset: %w", err)
+		}
+	}
+	return nil
+}
+
+// next returns the next line that is not blank.
+func (j *jsonlReader) next() ([]byte, error) {
+	for {
+		line, err := j.reader.ReadBytes('\n')
+		j.offset += int64(len(line))
+		j.line++
+		if len(line) == 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+func (j *jsonlReader) Read() (record, error) {
+	if j.pending != nil {
+		rec := *j.pending
+		j.pending = nil
+		return rec, nil
+	}
+
+	line, err := j.next()
+	if err != nil {
+		return record{}, err
+	}
+	return j.record(line)
+}
+
+func (j *jsonlReader) record(line []byte) (record, error) {
+	rec := record{end: j.offset}
+	if !j.seeked {
+		rec.line = j.line
+	}
+
+	object, err := decodeObject(line)
+	if err != nil {
+		rec.fields = []string{string(line)}
+		return rec, &malformedError{err: fmt.Errorf("line %d: %w", j.line, err)}
+	}
+
+	rec.fields = make([]string, len(j.columns))
+	rec.values = make([]any, len(j.columns))
+	for key, value := range object {
+		i, ok := j.columns[key]
+		if !ok {
+			rec.fields = []string{string(line)}
+			rec.values = nil
+			return rec, &malformedError{err: fmt.Errorf("line %d: unexpected field %q", j.line, key)}
+		}
+		rec.fields[i], rec.values[i] = jsonText(value), jsonValue(value)
+	}
+	return rec, nil
+}
+
+func (j *jsonlReader) Close() error {
+	return nil
+}
+
+func decodeObject(line []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %w", err)
+	}
+	if object == nil {
+		return nil, fmt.Errorf("invalid JSON object: null")
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid JSON object: trailing data")
+	}
+	return object, nil
+}
+
+// jsonText is the text of a JSON value as a schema coerces it: strings
+// as is, other scalars as written, null as an empty string, and objects
+// and arrays as JSON.
+func jsonText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// jsonValue turns the numbers of a decoded JSON value into int64 when they
+// are integers and float64 otherwise.
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+	}
+	return value
+}
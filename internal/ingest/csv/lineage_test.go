@@ -0,0 +1,39 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline_Process_Lineage(t *testing.T) {
+	content := "order_id,customer\n100,acme\n101,acme\n"
+	cfg := csv.Config{JobID: "job-1", KeyColumn: "customer"}
+
+	events, err := processWith(t, content, cfg)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	for i, event := range events {
+		assert.Equal(t, "acme", event.Key)
+		assert.Equal(t, map[string]string{
+			csv.HeaderJobID:     "job-1",
+			csv.HeaderFilePath:  "users.csv",
+			csv.HeaderRowNumber: []string{"1", "2"}[i],
+		}, event.Headers)
+	}
+	assert.NotEqual(t, events[0].ID, events[1].ID)
+	assert.Equal(t, csv.RowEventID("job-1", "users.csv", 1), events[0].ID)
+
+	again, err := processWith(t, content, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, events[0].ID, again[0].ID, "IDs are stable across runs")
+	assert.NotEqual(t, csv.RowEventID("job-2", "users.csv", 1), events[0].ID)
+}
+
+func TestPipeline_Process_MissingKeyColumn(t *testing.T) {
+	_, err := processWith(t, "order_id\n100\n", csv.Config{KeyColumn: "customer"})
+	assert.ErrorIs(t, err, csv.ErrHeaderMismatch)
+}
@@ -0,0 +1,253 @@
+package csv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+var ErrHeaderMismatch = errors.New("csv header does not match the expected columns")
+
+// Mapping describes how CSV columns become payload fields.
+type Mapping struct {
+	// Columns is the expected set of header columns, in any order. Files
+	// whose header differs are rejected. When the file has no header row,
+	// Columns names the columns in file order instead.
+	Columns []string `json:"columns"`
+	// Rename maps a column name to the payload field it is published as.
+	Rename map[string]string `json:"rename"`
+	// Drop lists columns left out of the payload.
+	Drop []string `json:"drop"`
+}
+
+// LoadMapping reads a JSON mapping file.
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var m Mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping file: %w", err)
+	}
+	return &m, nil
+}
+
+// rowMapper turns records into payloads keyed by field name.
+type rowMapper struct {
+	// fields holds the payload field of each column, "" for dropped ones.
+	fields []string
+	// columns holds the schema of each column, nil for untyped ones.
+	columns []*Column
+	// key is the index of the key column, -1 when there is none.
+	key int
+}
+
+// newRowMapper validates header against mapping and schema and resolves the
+// field name and type of every column. mapping and schema may be nil, as may
+// keyColumn be empty.
+func newRowMapper(header []string, mapping *Mapping, schema *Schema, keyColumn string) (*rowMapper, error) {
+	if mapping == nil {
+		mapping = &Mapping{}
+	}
+
+	seen := make(map[string]bool, len(header))
+	for _, column := range header {
+		if column == "" {
+			return nil, fmt.Errorf("%w: empty column name", ErrHeaderMismatch)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrHeaderMismatch, column)
+		}
+		seen[column] = true
+	}
+
+	if len(mapping.Columns) > 0 {
+		var missing, unexpected []string
+		for _, column := range mapping.Columns {
+			if !seen[column] {
+				missing = append(missing, column)
+			}
+		}
+		for _, column := range header {
+			if !slices.Contains(mapping.Columns, column) {
+				unexpected = append(unexpected, column)
+			}
+		}
+		if len(missing) > 0 || len(unexpected) > 0 {
+			return nil, fmt.Errorf("%w: missing [%s], unexpected [%s]", ErrHeaderMismatch,
+				strings.Join(missing, ", "), strings.Join(unexpected, ", "))
+		}
+	}
+
+	if schema != nil {
+		for _, c := range schema.Columns {
+			if c.Required && !seen[c.Name] {
+				return nil, fmt.Errorf("%w: missing required column %q", ErrHeaderMismatch, c.Name)
+			}
+		}
+	}
+
+	m := &rowMapper{fields: make([]string, len(header)), columns: make([]*Column, len(header)), key: -1}
+	if keyColumn != "" {
+		if m.key = slices.Index(header, keyColumn); m.key < 0 {
+			return nil, fmt.Errorf("%w: missing key column %q", ErrHeaderMismatch, keyColumn)
+		}
+	}
+	for i, column := range header {
+		if slices.Contains(mapping.Drop, column) {
+			continue
+		}
+		m.columns[i] = schema.column(column)
+		field := column
+		if renamed, ok := mapping.Rename[column]; ok {
+			field = renamed
+		}
+		m.fields[i] = field
+	}
+	return m, nil
+}
+
+// positionalHeader names the columns of a headerless file after the mapping,
+// or column_1, column_2, ... when there is none.
+func positionalHeader(width int, mapping *Mapping) ([]string, error) {
+	if mapping != nil && len(mapping.Columns) > 0 {
+		if len(mapping.Columns) != width {
+			return nil, fmt.Errorf("%w: file has %d columns, mapping has %d", ErrHeaderMismatch, width, len(mapping.Columns))
+		}
+		return mapping.Columns, nil
+	}
+
+	header := make([]string, width)
+	for i := range header {
+		header[i] = fmt.Sprintf("column_%d", i+1)
+	}
+	return header, nil
+}
+
+// payload maps record to typed payload fields. Untyped columns keep the
+// native values of typed formats, if any. It returns the schema violations
+// of the record, if any, instead of a payload.
+func (m *rowMapper) payload(record []string, values []any) (map[string]interface{}, []*violation) {
+	payload := make(map[string]interface{}, len(m.fields))
+	var violations []*violation
+	for i, field := range m.fields {
+		if field == "" || i >= len(record) {
+			continue
+		}
+		if m.columns[i] == nil {
+			if values != nil {
+				payload[field] = values[i]
+			} else {
+				payload[field] = record[i]
+			}
+			continue
+		}
+		value, v := m.columns[i].coerce(record[i])
+		if v != nil {
+			violations = append(violations, v)
+			continue
+		}
+		payload[field] = value
+	}
+	if len(violations) > 0 {
+		return nil, violations
+	}
+	return payload, nil
+}
+
+// rowReader reads data records in any format and knows how to map them,
+// having consumed or inferred the header.
+type rowReader struct {
+	records recordReader
+	mapper  *rowMapper
+	// start is where reading resumed.
+	start Offset
+	row   int64
+}
+
+// newRowReader reads the header of r and positions the reader just after
+// the resume offset.
+func newRowReader(r io.Reader, cfg Config, resume Offset) (*rowReader, error) {
+	if cfg.Schema != nil {
+		if err := cfg.Schema.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	format, err := cfg.Format.resolve(cfg.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		records recordReader
+		header  []string
+	)
+	switch format.Type {
+	case FormatJSONL:
+		records, header, err = newJSONLReader(r, cfg.Mapping, resume)
+	case FormatParquet:
+		records, header, err = newParquetReader(r, resume)
+	default:
+		if cfg.ParseWorkers > 1 {
+			records, header, err = newChunkedReader(r, format, cfg.NoHeader, cfg.Mapping, resume, cfg.ParseWorkers, cfg.ParseChunkSize)
+			break
+		}
+		records, header, err = newDelimitedReader(r, format, cfg.NoHeader, cfg.Mapping, resume)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rr := &rowReader{records: records, start: resume, row: resume.Row}
+	if header == nil {
+		rr.mapper = &rowMapper{key: -1}
+		return rr, nil
+	}
+	if rr.mapper, err = newRowMapper(header, cfg.Mapping, cfg.Schema, cfg.KeyColumn); err != nil {
+		records.Close()
+		return nil, err
+	}
+	return rr, nil
+}
+
+// Read returns the next data record with its number and end offset. Along
+// with a malformed record error, it returns whatever could be made of the
+// record.
+func (r *rowReader) Read() (csvRow, error) {
+	rec, err := r.records.Read()
+	if err != nil {
+		return csvRow{line: rec.line, record: rec.fields}, err
+	}
+
+	r.row++
+	return csvRow{
+		offset: Offset{Bytes: rec.end, Row: r.row},
+		line:   rec.line,
+		record: rec.fields,
+		values: rec.values,
+		change: rec.change,
+	}, nil
+}
+
+// malformed describes a row that failed to parse.
+func (r *rowReader) malformed(row csvRow, err error) Rejection {
+	return Rejection{Reason: ReasonMalformed, Line: row.line, Record: row.record, Violations: []string{err.Error()}}
+}
+
+func (r *rowReader) Close() error {
+	return r.records.Close()
+}
+
+// keyOf returns the value of the key column of record, or "" without one.
+func (m *rowMapper) keyOf(record []string) string {
+	if m.key < 0 || m.key >= len(record) {
+		return ""
+	}
+	return record[m.key]
+}
@@ -0,0 +1,80 @@
+package csv_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func processWith(t *testing.T, content string, cfg csv.Config) ([]model.Event, error) {
+	t.Helper()
+
+	mockSource := new(MockFileSource)
+	mockSource.On("ResumeOffset", mock.Anything, "users.csv").Return(csv.Offset{}, nil)
+	mockSource.On("Open", mock.Anything, "users.csv").Return(io.NopCloser(strings.NewReader(content)), nil)
+	mockSource.On("Checkpoint", mock.Anything, "users.csv", mock.Anything).Return(nil).Maybe()
+	mockSource.On("MarkCompleted", mock.Anything, "users.csv").Return(nil).Maybe()
+
+	var events []model.Event
+	mockProducer := new(MockProducer)
+	mockProducer.On("Publish", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(1).(model.Event))
+	}).Return(nil)
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg.FilePath = "users.csv"
+	cfg.WorkerCount = 1
+	err := csv.NewPipeline(mockSource, mockProducer, logger, metrics.New()).Process(context.Background(), cfg)
+	return events, err
+}
+
+func TestPipeline_Process_Mapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"columns": ["id", "email", "password"],
+		"rename": {"email": "contact_email"},
+		"drop": ["password"]
+	}`), 0o644))
+	mapping, err := csv.LoadMapping(path)
+	require.NoError(t, err)
+
+	events, err := processWith(t, "email,id,password\na@example.com,1,secret\n", csv.Config{Mapping: mapping})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, map[string]interface{}{"id": "1", "contact_email": "a@example.com"}, events[0].Payload)
+}
+
+func TestPipeline_Process_HeaderMismatch(t *testing.T) {
+	mapping := &csv.Mapping{Columns: []string{"id", "email"}}
+
+	events, err := processWith(t, "id,mail\n1,a@example.com\n", csv.Config{Mapping: mapping})
+	assert.ErrorIs(t, err, csv.ErrHeaderMismatch)
+	assert.Empty(t, events)
+
+	_, err = processWith(t, "id,id\n1,2\n", csv.Config{})
+	assert.ErrorIs(t, err, csv.ErrHeaderMismatch)
+}
+
+func TestPipeline_Process_NoHeader(t *testing.T) {
+	events, err := processWith(t, "1,a@example.com\n", csv.Config{NoHeader: true})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, map[string]interface{}{"column_1": "1", "column_2": "a@example.com"}, events[0].Payload)
+
+	mapping := &csv.Mapping{Columns: []string{"id", "email"}}
+	events, err = processWith(t, "1,a@example.com\n", csv.Config{NoHeader: true, Mapping: mapping})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, map[string]interface{}{"id": "1", "email": "a@example.com"}, events[0].Payload)
+}
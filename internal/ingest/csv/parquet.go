@@ -0,0 +1,170 @@
+package csv
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowBuffer is the number of rows read from a row group at once.
+const parquetRowBuffer = 128
+
+// parquetReader reads the rows of a Parquet file, row group by row group.
+// Its columns are the leaf columns of the schema, nested ones named by their
+// dotted path. Records have no byte offset: resuming skips the row groups
+// before the resume row and seeks within the next one.
+type parquetReader struct {
+	groups  []parquet.RowGroup
+	group   int
+	rows    parquet.Rows
+	buf     []parquet.Row
+	pending []parquet.Row
+	// repeated tells the leaf columns that hold lists.
+	repeated []bool
+	// seek is the row to seek to in the next row group opened.
+	seek    int64
+	cleanup func()
+}
+
+// newParquetReader opens the Parquet file r and positions it at the resume
+// row. It returns a nil header for a file without rows.
+func newParquetReader(r io.Reader, resume Offset) (*parquetReader, []string, error) {
+	ra, size, cleanup, err := randomAccess(r, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read Parquet file: %w", err)
+	}
+	file, err := parquet.OpenFile(ra, size)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to read Parquet file: %w", err)
+	}
+
+	p := &parquetReader{
+		groups:  file.RowGroups(),
+		buf:     make([]parquet.Row, parquetRowBuffer),
+		seek:    resume.Row,
+		cleanup: cleanup,
+	}
+	var header []string
+	for _, path := range file.Schema().Columns() {
+		leaf, _ := file.Schema().Lookup(path...)
+		header = append(header, strings.Join(path, "."))
+		p.repeated = append(p.repeated, leaf.MaxRepetitionLevel > 0)
+	}
+	for p.group < len(p.groups) && p.groups[p.group].NumRows() <= p.seek {
+		p.seek -= p.groups[p.group].NumRows()
+		p.group++
+	}
+	if file.NumRows() == 0 {
+		header = nil
+	}
+	return p, header, nil
+}
+
+func (p *parquetReader) Read() (record, error) {
+	for len(p.pending) == 0 {
+		if p.rows == nil {
+			if p.group == len(p.groups) {
+				return record{}, io.EOF
+			}
+			p.rows = p.groups[p.group].Rows()
+			p.group++
+			if p.seek > 0 {
+				if err := p.rows.SeekToRow(p.seek); err != nil {
+					return record{}, fmt.Errorf("failed to seek to resume row: %w", err)
+				}
+				p.seek = 0
+			}
+		}
+
+		n, err := p.rows.ReadRows(p.buf)
+		p.pending = p.buf[:n]
+		if err == io.EOF {
+			p.rows.Close()
+			p.rows = nil
+		} else if err != nil {
+			return record{}, fmt.Errorf("failed to read Parquet rows: %w", err)
+		}
+	}
+
+	row := p.pending[0]
+	p.pending = p.pending[1:]
+	return p.record(row), nil
+}
+
+// record converts a row while the values it references are still valid.
+// Repeated columns become lists.
+func (p *parquetReader) record(row parquet.Row) record {
+	rec := record{fields: make([]string, len(p.repeated)), values: make([]any, len(p.repeated))}
+	for _, v := range row {
+		i := v.Column()
+		if !p.repeated[i] {
+			rec.fields[i], rec.values[i] = parquetText(v), parquetValue(v)
+			continue
+		}
+		list, _ := rec.values[i].([]any)
+		if list == nil {
+			list = []any{}
+		}
+		if !v.IsNull() {
+			list = append(list, parquetValue(v))
+		}
+		rec.values[i] = list
+	}
+	for i, repeated := range p.repeated {
+		if repeated {
+			rec.fields[i] = jsonText(rec.values[i])
+		}
+	}
+	return rec
+}
+
+func (p *parquetReader) Close() error {
+	if p.rows != nil {
+		p.rows.Close()
+	}
+	p.cleanup()
+	return nil
+}
+
+// parquetValue returns the Go value of v by physical type, strings for byte
+// arrays.
+func parquetValue(v parquet.Value) any {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return int64(v.Int32())
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Float:
+		return float64(v.Float())
+	case parquet.Double:
+		return v.Double()
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	}
+	return v.String()
+}
+
+func parquetText(v parquet.Value) string {
+	switch value := parquetValue(v).(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return v.String()
+}
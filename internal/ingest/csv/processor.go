@@ -2,15 +2,19 @@ package csv
 
 import (
 	"context"
-	"encoding/csv"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
 	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
 	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/rate"
 )
 
 type Pipeline struct {
@@ -29,79 +33,462 @@ func NewPipeline(source FileSource, producer kafka.Producer, logger *slog.Logger
 	}
 }
 
+const (
+	defaultCheckpointInterval = time.Second
+	defaultHeartbeatInterval  = 10 * time.Second
+)
+
+// Process publishes every row of cfg.FilePath, resuming after the offset
+// saved by the last run, and marks the file completed once all rows are
+// published.
 func (p *Pipeline) Process(ctx context.Context, cfg Config) error {
+	started := time.Now().UTC()
+	stats := &runStats{maxErrors: int64(cfg.MaxErrors), started: started, bulk: p.metrics.Bulk(cfg.Dataset)}
+	if cfg.ValidateOnly {
+		stats.validation = &Validation{ErrorsByColumn: make(map[string]int64)}
+	}
+	resume, err := p.process(ctx, cfg, stats)
+	stats.finish(err)
+
+	if cfg.Reports != nil {
+		report := stats.report(cfg, started, resume, err)
+		if err := cfg.Reports.WriteReport(context.WithoutCancel(ctx), report); err != nil {
+			p.logger.Warn("Failed to write ingestion report", "file", cfg.FilePath, "error", err)
+		}
+	}
+	return err
+}
+
+// process runs Process and returns the offset it resumed from.
+func (p *Pipeline) process(ctx context.Context, cfg Config, stats *runStats) (Offset, error) {
 	p.logger.Info("Starting bulk CSV ingestion", "file", cfg.FilePath, "workers", cfg.WorkerCount)
 
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if cfg.Heartbeat != nil {
+		stop := p.heartbeat(ctx, cfg, cancel)
+		defer stop()
+	}
+
 	rc, err := p.source.Open(ctx, cfg.FilePath)
 	if err != nil {
-		return err
+		return Offset{}, err
 	}
 	defer rc.Close()
 
-	reader := csv.NewReader(rc)
+	in, err := openInput(countBytes(rc, stats.bulk.BytesRead), cfg.FilePath)
+	if err != nil {
+		return Offset{}, err
+	}
+	defer in.Close()
+
+	if in.archive == nil {
+		return p.processFile(ctx, cfg, stats, in.r)
+	}
+	if cfg.Previous != "" && !cfg.ValidateOnly {
+		return Offset{}, fmt.Errorf("cannot diff archive %s", cfg.FilePath)
+	}
+	if err := p.processArchive(ctx, cfg, stats, in.archive); err != nil {
+		return Offset{}, err
+	}
+	if cfg.ValidateOnly {
+		return Offset{}, nil
+	}
+	if err := p.source.MarkCompleted(ctx, cfg.FilePath); err != nil {
+		return Offset{}, fmt.Errorf("failed to mark file completed: %w", err)
+	}
+	return Offset{}, nil
+}
+
+// processArchive ingests every member of an archive as a file of its own,
+// with its own checkpoints and row numbers, under its MemberPath.
+func (p *Pipeline) processArchive(ctx context.Context, cfg Config, stats *runStats, a archive) error {
+	for {
+		name, r, err := a.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		member := cfg
+		member.FilePath = MemberPath(cfg.FilePath, name)
+		if _, err := p.processFile(ctx, member, stats, r); err != nil {
+			return err
+		}
+	}
+}
+
+// processFile publishes the rows of one CSV stream and returns the offset it
+// resumed from.
+func (p *Pipeline) processFile(ctx context.Context, cfg Config, stats *runStats, r io.Reader) (Offset, error) {
+	if cfg.ValidateOnly {
+		return Offset{}, p.validateFile(ctx, cfg, stats, r)
+	}
+
+	resume, err := p.source.ResumeOffset(ctx, cfg.FilePath)
+	if err != nil {
+		return resume, fmt.Errorf("failed to load resume offset: %w", err)
+	}
+	if resume.Row > 0 {
+		p.logger.Info("Resuming bulk CSV ingestion", "file", cfg.FilePath, "row", resume.Row, "bytes", resume.Bytes)
+	}
+
+	var reader *rowReader
+	if cfg.Previous != "" {
+		reader, err = p.newChangeReader(ctx, cfg, r, resume)
+	} else {
+		reader, err = newRowReader(r, cfg, resume)
+	}
+	if err != nil {
+		return resume, err
+	}
+	defer reader.Close()
+
+	limiter := newLimiter(cfg)
+	if publisher, ok := p.producer.(kafka.BatchPublisher); ok {
+		err = p.processTransactional(ctx, cfg, stats, reader, publisher, limiter)
+	} else {
+		err = p.processConcurrent(ctx, cfg, stats, reader, limiter)
+	}
+	if cause := context.Cause(ctx); err != nil && cause != nil {
+		// Report why processing was interrupted, such as a lost heartbeat,
+		// rather than the cancellation it caused.
+		return resume, cause
+	}
+	if err != nil {
+		return resume, err
+	}
+
+	if err := p.source.MarkCompleted(ctx, cfg.FilePath); err != nil {
+		return resume, fmt.Errorf("failed to mark file completed: %w", err)
+	}
+
+	p.logger.Info("Bulk ingestion completed successfully", "file", cfg.FilePath, "rows", reader.row,
+		"published", stats.published.Load(), "rejected", stats.rejected.Load(), "malformed", stats.malformed.Load())
+	return resume, nil
+}
+
+// heartbeat calls cfg.Heartbeat until the returned function is called, and
+// cancels ctx with the first error it returns.
+func (p *Pipeline) heartbeat(ctx context.Context, cfg Config, fail context.CancelCauseFunc) func() {
+	interval := cfg.HeartbeatInterval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := cfg.Heartbeat(ctx); err != nil {
+					p.logger.Error("Heartbeat failed, stopping ingestion", "file", cfg.FilePath, "error", err)
+					fail(fmt.Errorf("heartbeat failed: %w", err))
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
 
-	jobs := make(chan []string, cfg.BatchSize)
+// processConcurrent publishes rows in batches of cfg.BatchSize spread over
+// cfg.WorkerCount workers. Batches complete out of order, so checkpoints
+// follow a watermark below which every row is published; a restart
+// re-publishes at most the rows above it.
+func (p *Pipeline) processConcurrent(ctx context.Context, cfg Config, stats *runStats, reader *rowReader, limiter *rate.TokenLimiter) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	wm := newWatermark(reader.start)
+	stats.progress(reader.start)
+	batchSize := max(cfg.BatchSize, 1)
+	batches := make(chan []csvRow, cfg.WorkerCount)
 
 	var wg sync.WaitGroup
 
 	for i := 0; i < cfg.WorkerCount; i++ {
 		wg.Add(1)
-		go p.worker(ctx, i, jobs, &wg)
+		go p.worker(ctx, i, cfg, stats, reader.mapper, batches, wm, cancel, &wg)
 	}
 
-	var readErr error
 	go func() {
-		defer close(jobs)
-		lineNum := 0
-		for {
+		defer close(batches)
+		send := func(batch []csvRow) bool {
 			select {
+			case batches <- batch:
+				return true
 			case <-ctx.Done():
-				return
-			default:
+				return false
 			}
+		}
 
-			record, err := reader.Read()
+		batch := make([]csvRow, 0, batchSize)
+		for {
+			row, err := reader.Read()
 			if err == io.EOF {
 				break
 			}
+			if err != nil && !isMalformed(err) {
+				p.logger.Error("Ingestion failed with read errors", "file", cfg.FilePath, "error", err)
+				cancel(fmt.Errorf("failed to read CSV: %w", err))
+				return
+			}
+			stats.bulk.RowsRead.Inc()
 			if err != nil {
-				p.logger.Error("CSV parse error", "line", lineNum, "error", err)
+				if err := p.reject(ctx, cfg, stats, reader.malformed(row, err)); err != nil {
+					cancel(err)
+					return
+				}
 				continue
 			}
-			lineNum++
 
+			if err := throttle(ctx, limiter); err != nil {
+				cancel(err)
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) == batchSize {
+				if !send(batch) {
+					return
+				}
+				batch = make([]csvRow, 0, batchSize)
+			}
+		}
+		if len(batch) > 0 {
+			send(batch)
+		}
+	}()
+
+	stopCheckpoints := make(chan struct{})
+	checkpointsDone := make(chan struct{})
+	last := reader.start
+	go func() {
+		defer close(checkpointsDone)
+		interval := cfg.CheckpointInterval
+		if interval <= 0 {
+			interval = defaultCheckpointInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
 			select {
-			case jobs <- record:
-			case <-ctx.Done():
+			case <-stopCheckpoints:
 				return
+			case <-ticker.C:
+				last = p.checkpoint(ctx, cfg, stats, wm, last)
 			}
 		}
 	}()
 
 	wg.Wait()
+	close(stopCheckpoints)
+	<-checkpointsDone
 
-	if readErr != nil {
-		p.logger.Error("Ingestion failed with read errors", "error", readErr)
-		return readErr
-	}
+	// Whatever stopped the workers, the watermark only covers published
+	// rows, so it is saved even when ctx is done.
+	p.checkpoint(context.WithoutCancel(ctx), cfg, stats, wm, last)
+
+	return context.Cause(ctx)
+}
 
-	p.logger.Info("Bulk ingestion completed successfully", "file", cfg.FilePath)
+// throttle waits for limiter to allow another row, when there is one. It
+// fails with the cause of ctx once done, and also before then when the wait
+// would last past the deadline of ctx.
+func throttle(ctx context.Context, limiter *rate.TokenLimiter) error {
+	if limiter == nil {
+		return context.Cause(ctx)
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		return fmt.Errorf("failed to wait for rate limit: %w", err)
+	}
 	return nil
 }
 
-func (p *Pipeline) worker(ctx context.Context, id int, jobs <-chan []string, wg *sync.WaitGroup) {
+// newLimiter returns the limiter enforcing cfg.RateLimit, or nil without
+// one. It lets through a tenth of a second worth of rows at once, so that
+// high rates are not slowed down by the granularity of timers.
+func newLimiter(cfg Config) *rate.TokenLimiter {
+	if cfg.RateLimit <= 0 {
+		return nil
+	}
+	return rate.NewTokenLimiter(cfg.RateLimit, max(1, int(math.Ceil(cfg.RateLimit/10))))
+}
+
+// checkpoint saves the watermark when it moved past last and returns the
+// offset saved last.
+func (p *Pipeline) checkpoint(ctx context.Context, cfg Config, stats *runStats, wm *watermark, last Offset) Offset {
+	offset := wm.get()
+	stats.progress(offset)
+	if offset == last {
+		return last
+	}
+	if err := p.source.Checkpoint(ctx, cfg.FilePath, offset); err != nil {
+		p.logger.Warn("Failed to save checkpoint", "file", cfg.FilePath, "row", offset.Row, "error", err)
+		return last
+	}
+	return offset
+}
+
+// worker publishes batches until batches is closed. A row that can be
+// neither published nor rejected stops the whole pipeline, since the
+// watermark cannot move past it.
+func (p *Pipeline) worker(ctx context.Context, id int, cfg Config, stats *runStats, mapper *rowMapper, batches <-chan []csvRow, wm *watermark, fail context.CancelCauseFunc, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	for record := range jobs {
-		event := model.Event{
-			ID:        "csv-row",
-			Type:      "bulk_import",
-			Timestamp: time.Now(),
-			Payload:   map[string]interface{}{"data": record},
+	for batch := range batches {
+		if ctx.Err() != nil {
+			continue
+		}
+		if err := p.publishBatch(ctx, id, cfg, stats, mapper, batch, wm); err != nil {
+			fail(err)
 		}
+	}
+}
 
+// publishBatch rejects the invalid rows of batch and publishes the others
+// together.
+func (p *Pipeline) publishBatch(ctx context.Context, id int, cfg Config, stats *runStats, mapper *rowMapper, batch []csvRow, wm *watermark) error {
+	rows := make([]csvRow, 0, len(batch))
+	events := make([]model.Event, 0, len(batch))
+	for _, row := range batch {
+		event, violations := rowEvent(cfg, mapper, row)
+		if len(violations) > 0 {
+			if err := p.reject(ctx, cfg, stats, row.rejection(ReasonInvalid, violations...)); err != nil {
+				p.logger.Error("Failed to reject row", "worker", id, "row", row.offset.Row, "error", err)
+				return err
+			}
+			wm.publish(row.offset)
+			continue
+		}
+		rows = append(rows, row)
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	published, err := p.publish(ctx, events)
+	stats.publish(published)
+	for _, row := range rows[:published] {
+		wm.publish(row.offset)
+	}
+	if err == nil {
+		return nil
+	}
+
+	failed := rows[published]
+	p.logger.Error("Failed to publish events", "worker", id, "row", failed.offset.Row, "error", err)
+	if ctx.Err() == nil {
+		for _, row := range rows[published:] {
+			if err := p.reject(ctx, cfg, stats, row.rejection(ReasonPublishFailed, err.Error())); err != nil {
+				p.logger.Error("Failed to reject row", "worker", id, "row", row.offset.Row, "error", err)
+			}
+		}
+	}
+	return fmt.Errorf("failed to publish row %d: %w", failed.offset.Row, err)
+}
+
+// publish writes events in one request when the producer is a
+// kafka.BulkPublisher, and one by one otherwise. It returns how many events
+// were published, in order, before an error.
+func (p *Pipeline) publish(ctx context.Context, events []model.Event) (int, error) {
+	if bulk, ok := p.producer.(kafka.BulkPublisher); ok {
+		if err := bulk.PublishAll(ctx, events); err != nil {
+			return 0, err
+		}
+		return len(events), nil
+	}
+	for i, event := range events {
 		if err := p.producer.Publish(ctx, event); err != nil {
-			p.logger.Error("Failed to publish event", "worker", id, "error", err)
+			return i, err
 		}
 	}
+	return len(events), nil
+}
+
+// csvRow is a data record with the offset just after it and the line it
+// starts at, 0 when unknown. values holds the native values of typed
+// formats, and change the change a snapshot diff publishes instead.
+type csvRow struct {
+	offset Offset
+	line   int64
+	record []string
+	values []any
+	change *change
+}
+
+func (r csvRow) rejection(reason string, violations ...string) Rejection {
+	return Rejection{
+		Reason:     reason,
+		Row:        r.offset.Row,
+		Line:       r.line,
+		Record:     r.record,
+		Violations: violations,
+	}
+}
+
+// reject hands a row that is not published to cfg.Rejects, and fails once
+// cfg.MaxErrors is exceeded.
+func (p *Pipeline) reject(ctx context.Context, cfg Config, stats *runStats, r Rejection) error {
+	r.File = cfg.FilePath
+	if r.Reason != ReasonPublishFailed {
+		p.metrics.CSVRowsRejected.Inc()
+		p.logger.Warn("Rejected CSV row", "file", cfg.FilePath, "reason", r.Reason, "row", r.Row, "line", r.Line, "violations", r.Violations)
+	}
+	if cfg.Rejects != nil {
+		if err := cfg.Rejects.Reject(ctx, r); err != nil {
+			return fmt.Errorf("failed to reject row %d: %w", r.Row, err)
+		}
+	}
+	return stats.count(r.Reason)
+}
+
+// Lineage headers identifying where an imported event comes from. Consumers
+// can deduplicate on (ingest_job_id, ingest_row_number).
+const (
+	HeaderJobID     = "ingest_job_id"
+	HeaderFilePath  = "ingest_file_path"
+	HeaderRowNumber = "ingest_row_number"
+)
+
+// rowIDNamespace is the UUIDv5 namespace of row event IDs.
+var rowIDNamespace = uuid.MustParse("8f4b0c3e-5d2a-4e61-9b7f-2a6c1d9e0f35")
+
+// RowEventID returns the deterministic ID of the event for a row.
+func RowEventID(jobID, filePath string, row int64) string {
+	name := jobID + "\x00" + filePath + "\x00" + strconv.FormatInt(row, 10)
+	return uuid.NewSHA1(rowIDNamespace, []byte(name)).String()
+}
+
+func newRowEvent(cfg Config, row int64, key string, payload map[string]interface{}) model.Event {
+	return model.Event{
+		ID:        RowEventID(cfg.JobID, cfg.FilePath, row),
+		Type:      "bulk_import",
+		Timestamp: time.Now(),
+		Payload:   payload,
+		Key:       key,
+		Headers: map[string]string{
+			HeaderJobID:     cfg.JobID,
+			HeaderFilePath:  cfg.FilePath,
+			HeaderRowNumber: strconv.FormatInt(row, 10),
+		},
+	}
 }
@@ -1,17 +1,25 @@
 package csv_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
 	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
 	"github.com/raphaelreis/go-event-ingestor/internal/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockFileSource struct {
@@ -23,14 +31,14 @@ func (m *MockFileSource) Open(ctx context.Context, path string) (io.ReadCloser,
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
-func (m *MockFileSource) Checkpoint(ctx context.Context, path string, offset int64) error {
+func (m *MockFileSource) Checkpoint(ctx context.Context, path string, offset csv.Offset) error {
 	args := m.Called(ctx, path, offset)
 	return args.Error(0)
 }
 
-func (m *MockFileSource) ResumeOffset(ctx context.Context, path string) (int64, error) {
+func (m *MockFileSource) ResumeOffset(ctx context.Context, path string) (csv.Offset, error) {
 	args := m.Called(ctx, path)
-	return args.Get(0).(int64), args.Error(1)
+	return args.Get(0).(csv.Offset), args.Error(1)
 }
 
 func (m *MockFileSource) MarkCompleted(ctx context.Context, path string) error {
@@ -63,11 +71,17 @@ func TestPipeline_Process(t *testing.T) {
 	csvContent := "col1,col2\nval1,val2\nval3,val4"
 	rc := io.NopCloser(strings.NewReader(csvContent))
 
+	mockSource.On("ResumeOffset", mock.Anything, "test.csv").Return(csv.Offset{}, nil)
 	mockSource.On("Open", mock.Anything, "test.csv").Return(rc, nil)
+	mockSource.On("Checkpoint", mock.Anything, "test.csv", mock.Anything).Return(nil).Maybe()
+	mockSource.On("MarkCompleted", mock.Anything, "test.csv").Return(nil)
 
 	mockProducer.On("Publish", mock.Anything, mock.MatchedBy(func(e model.Event) bool {
-		return e.Type == "bulk_import"
-	})).Return(nil).Times(3)
+		return e.Type == "bulk_import" && e.Payload["col1"] == "val1" && e.Payload["col2"] == "val2"
+	})).Return(nil).Once()
+	mockProducer.On("Publish", mock.Anything, mock.MatchedBy(func(e model.Event) bool {
+		return e.Type == "bulk_import" && e.Payload["col1"] == "val3" && e.Payload["col2"] == "val4"
+	})).Return(nil).Once()
 
 	cfg := csv.Config{
 		FilePath:    "test.csv",
@@ -81,3 +95,193 @@ func TestPipeline_Process(t *testing.T) {
 	mockSource.AssertExpectations(t)
 	mockProducer.AssertExpectations(t)
 }
+
+// bulkProducer records the events of each PublishAll call.
+type bulkProducer struct {
+	mu       sync.Mutex
+	batches  [][]model.Event
+	attempts int
+	err      error
+}
+
+func (b *bulkProducer) Publish(ctx context.Context, event model.Event) error {
+	return b.PublishAll(ctx, []model.Event{event})
+}
+
+func (b *bulkProducer) PublishAll(ctx context.Context, events []model.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts++
+	if b.err != nil {
+		return b.err
+	}
+	b.batches = append(b.batches, events)
+	return nil
+}
+
+func (b *bulkProducer) Close() error { return nil }
+
+func (b *bulkProducer) sizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sizes []int
+	for _, batch := range b.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+// brokenSource serves content followed by a read error.
+type brokenSource struct {
+	*memSource
+	err error
+}
+
+func (s *brokenSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return io.NopCloser(io.MultiReader(bytes.NewReader(s.content), iotest.ErrReader(s.err))), nil
+}
+
+func csvRows(n int) string {
+	var b strings.Builder
+	b.WriteString("id\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+func TestPipeline_Process_BatchSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      int
+		batchSize int
+		want      []int
+	}{
+		{name: "full batches", rows: 6, batchSize: 3, want: []int{3, 3}},
+		{name: "partial last batch", rows: 5, batchSize: 2, want: []int{2, 2, 1}},
+		{name: "batch larger than file", rows: 4, batchSize: 10, want: []int{4}},
+		{name: "zero batch size publishes rows one by one", rows: 2, batchSize: 0, want: []int{1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &bulkProducer{}
+			source := &memSource{content: []byte(csvRows(tt.rows))}
+			logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+			cfg := csv.Config{FilePath: "ids.csv", WorkerCount: 1, BatchSize: tt.batchSize}
+			require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg))
+
+			assert.Equal(t, tt.want, producer.sizes())
+			assert.Equal(t, csv.Offset{Bytes: int64(len(source.content)), Row: int64(tt.rows)}, source.checkpoint)
+		})
+	}
+}
+
+func TestPipeline_Process_RateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		rateLimit float64
+		rows      int
+		min, max  time.Duration
+	}{
+		{name: "unlimited", rateLimit: 0, rows: 200, max: 200 * time.Millisecond},
+		// A burst of 5 rows, then 25 more at 50 rows per second.
+		{name: "limited", rateLimit: 50, rows: 30, min: 450 * time.Millisecond, max: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, workers := range []int{1, 4} {
+				producer := &bulkProducer{}
+				source := &memSource{content: []byte(csvRows(tt.rows))}
+				logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+				cfg := csv.Config{FilePath: "ids.csv", WorkerCount: workers, BatchSize: 2, RateLimit: tt.rateLimit}
+				started := time.Now()
+				require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg))
+				elapsed := time.Since(started)
+
+				assert.GreaterOrEqual(t, elapsed, tt.min, "workers=%d", workers)
+				assert.Less(t, elapsed, tt.max, "workers=%d", workers)
+			}
+		})
+	}
+}
+
+func TestPipeline_Process_RateLimitPastDeadline(t *testing.T) {
+	// The limiter refuses the second row right away, as waiting for it
+	// would outlast the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	source := &memSource{content: []byte(csvRows(10))}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{FilePath: "ids.csv", WorkerCount: 2, BatchSize: 1, RateLimit: 1}
+
+	err := csv.NewPipeline(source, &bulkProducer{}, logger, metrics.New()).Process(ctx, cfg)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, source.completed)
+	assert.LessOrEqual(t, source.checkpoint.Row, int64(1))
+}
+
+func TestPipeline_Process_FatalErrors(t *testing.T) {
+	errRead := errors.New("connection reset")
+	errPublish := errors.New("broker unavailable")
+
+	tests := []struct {
+		name        string
+		readErr     error
+		publishErr  error
+		wantErr     error
+		maxAttempts int
+	}{
+		{name: "read error", readErr: errRead, wantErr: errRead},
+		// Workers stop at the first failure instead of trying every
+		// remaining batch.
+		{name: "publish error", publishErr: errPublish, wantErr: errPublish, maxAttempts: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := &memSource{content: []byte(csvRows(10_000))}
+			var source csv.FileSource = mem
+			if tt.readErr != nil {
+				source = &brokenSource{memSource: mem, err: tt.readErr}
+			}
+			producer := &bulkProducer{err: tt.publishErr}
+			logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+			cfg := csv.Config{FilePath: "ids.csv", WorkerCount: 4, BatchSize: 10}
+			err := csv.NewPipeline(source, producer, logger, metrics.New()).Process(context.Background(), cfg)
+			require.ErrorIs(t, err, tt.wantErr)
+
+			assert.False(t, mem.completed)
+			if tt.maxAttempts > 0 {
+				assert.LessOrEqual(t, producer.attempts, tt.maxAttempts)
+			}
+		})
+	}
+}
+
+func TestPipeline_Process_Metrics(t *testing.T) {
+	content := "id,n\n1,2\nx,3\n4\n"
+	schema := &csv.Schema{Columns: []csv.Column{{Name: "id", Type: csv.TypeInt}}}
+	source := &memSource{content: []byte(content)}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	mets := metrics.New()
+
+	cfg := csv.Config{FilePath: "ids.csv", WorkerCount: 2, BatchSize: 10, Schema: schema, Dataset: "metrics-test"}
+	require.NoError(t, csv.NewPipeline(source, &bulkProducer{}, logger, mets).Process(context.Background(), cfg))
+
+	bulk := mets.Bulk("metrics-test")
+	assert.Equal(t, 3.0, testutil.ToFloat64(bulk.RowsRead))
+	assert.Equal(t, 1.0, testutil.ToFloat64(bulk.RowsPublished))
+	assert.Equal(t, 1.0, testutil.ToFloat64(bulk.RowsRejected.WithLabelValues(csv.ReasonInvalid)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(bulk.RowsRejected.WithLabelValues(csv.ReasonMalformed)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(bulk.ParseErrors))
+	assert.Equal(t, float64(len(content)), testutil.ToFloat64(bulk.BytesRead))
+	assert.Equal(t, float64(source.checkpoint.Row), testutil.ToFloat64(bulk.OffsetRows))
+	assert.Equal(t, float64(source.checkpoint.Bytes), testutil.ToFloat64(bulk.OffsetBytes))
+	assert.Positive(t, testutil.ToFloat64(bulk.Duration))
+}
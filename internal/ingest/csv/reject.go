@@ -0,0 +1,89 @@
+package csv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Reasons a row is rejected.
+const (
+	// ReasonInvalid rows failed schema or mapping validation.
+	ReasonInvalid = "invalid_row"
+	// ReasonMalformed rows could not be parsed as CSV.
+	ReasonMalformed = "malformed_row"
+	// ReasonDuplicateKey rows repeat the key of an earlier row. Only
+	// validate-only runs look for them.
+	ReasonDuplicateKey = "duplicate_key"
+	// ReasonPublishFailed rows could not be published. The run fails with
+	// them, so they are published again when it is resumed.
+	ReasonPublishFailed = "publish_failed"
+)
+
+// Rejection is a row that was not published.
+type Rejection struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+	// Row is the 1-based number of the data row, header excluded. Malformed
+	// rows are not numbered.
+	Row int64 `json:"row,omitempty"`
+	// Line is the 1-based line the row starts at, unknown after resuming by
+	// seeking into the file.
+	Line       int64    `json:"line,omitempty"`
+	Record     []string `json:"record,omitempty"`
+	Violations []string `json:"violations"`
+}
+
+// RejectSink receives rows that are not published.
+type RejectSink interface {
+	Reject(ctx context.Context, r Rejection) error
+}
+
+// TeeRejects hands rejections to every non-nil sink, in order.
+func TeeRejects(sinks ...RejectSink) RejectSink {
+	var tee teeRejects
+	for _, sink := range sinks {
+		if sink != nil {
+			tee = append(tee, sink)
+		}
+	}
+	return tee
+}
+
+type teeRejects []RejectSink
+
+func (t teeRejects) Reject(ctx context.Context, r Rejection) error {
+	for _, sink := range t {
+		if err := sink.Reject(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONRejectWriter writes rejections as JSON lines.
+type JSONRejectWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONRejectWriter(w io.Writer) *JSONRejectWriter {
+	return &JSONRejectWriter{w: w}
+}
+
+func (j *JSONRejectWriter) Reject(ctx context.Context, r Rejection) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rejection: %w", err)
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write rejection: %w", err)
+	}
+	return nil
+}
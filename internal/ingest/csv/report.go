@@ -0,0 +1,155 @@
+package csv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+)
+
+// ErrTooManyErrors fails a run once more rows than Config.MaxErrors were
+// rejected.
+var ErrTooManyErrors = errors.New("too many rejected rows")
+
+// Report statuses.
+const (
+	ReportCompleted = "completed"
+	ReportFailed    = "failed"
+)
+
+// Report summarises one run of the pipeline over a file. Counts only cover
+// that run; a resumed file gets a report per run.
+type Report struct {
+	File       string    `json:"file"`
+	JobID      string    `json:"job_id,omitempty"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// ResumedFrom is where the run started reading.
+	ResumedFrom   Offset `json:"resumed_from"`
+	RowsPublished int64  `json:"rows_published"`
+	RowsRejected  int64  `json:"rows_rejected"`
+	RowsMalformed int64  `json:"rows_malformed"`
+	RowsFailed    int64  `json:"rows_failed"`
+	// Validation details the findings of a validate-only run.
+	Validation *Validation `json:"validation,omitempty"`
+}
+
+// maxValidationSamples bounds the failing rows a Validation describes.
+const maxValidationSamples = 20
+
+// Validation is what a validate-only run found in a file. It locates and
+// explains failing rows without quoting their values, so that it can be
+// shared without exposing the data.
+type Validation struct {
+	RowsRead      int64 `json:"rows_read"`
+	RowsValid     int64 `json:"rows_valid"`
+	DuplicateKeys int64 `json:"duplicate_keys"`
+	// ErrorsByColumn counts schema violations by column.
+	ErrorsByColumn map[string]int64   `json:"errors_by_column"`
+	Samples        []ValidationSample `json:"samples"`
+}
+
+// ValidationSample is one of the first failing rows of a file.
+type ValidationSample struct {
+	Row    int64    `json:"row,omitempty"`
+	Line   int64    `json:"line,omitempty"`
+	Reason string   `json:"reason"`
+	Errors []string `json:"errors"`
+}
+
+func (v *Validation) sample(s ValidationSample) {
+	if len(v.Samples) < maxValidationSamples {
+		v.Samples = append(v.Samples, s)
+	}
+}
+
+// ReportSink receives the report of a run when it ends, successfully or not.
+type ReportSink interface {
+	WriteReport(ctx context.Context, r Report) error
+}
+
+// runStats counts the rows of a run.
+type runStats struct {
+	published atomic.Int64
+	rejected  atomic.Int64
+	malformed atomic.Int64
+	failed    atomic.Int64
+	maxErrors int64
+	started   time.Time
+	// bulk is the series of the dataset the run imports.
+	bulk *metrics.Bulk
+	// validation is only set for validate-only runs, which read rows from
+	// one goroutine.
+	validation *Validation
+}
+
+// count records a rejection and reports when it crosses the error
+// threshold. Publish failures end the run by themselves and are not counted
+// against it.
+func (s *runStats) count(reason string) error {
+	s.bulk.RowsRejected.WithLabelValues(reason).Inc()
+	var errors int64
+	switch reason {
+	case ReasonInvalid, ReasonDuplicateKey:
+		errors = s.rejected.Add(1) + s.malformed.Load()
+	case ReasonMalformed:
+		s.bulk.ParseErrors.Inc()
+		errors = s.malformed.Add(1) + s.rejected.Load()
+	case ReasonPublishFailed:
+		s.failed.Add(1)
+		return nil
+	}
+	if s.maxErrors > 0 && errors > s.maxErrors {
+		return fmt.Errorf("%w: more than %d", ErrTooManyErrors, s.maxErrors)
+	}
+	return nil
+}
+
+func (s *runStats) publish(n int) {
+	s.published.Add(int64(n))
+	s.bulk.RowsPublished.Add(float64(n))
+}
+
+// progress records offset as the position of the run.
+func (s *runStats) progress(offset Offset) {
+	s.bulk.OffsetRows.Set(float64(offset.Row))
+	s.bulk.OffsetBytes.Set(float64(offset.Bytes))
+	s.bulk.Duration.Set(time.Since(s.started).Seconds())
+}
+
+// finish records the duration of the run and whether it failed.
+func (s *runStats) finish(err error) {
+	status := ReportCompleted
+	if err != nil {
+		status = ReportFailed
+	}
+	elapsed := time.Since(s.started).Seconds()
+	s.bulk.Duration.Set(elapsed)
+	s.bulk.Completion.WithLabelValues(status).Observe(elapsed)
+}
+
+func (s *runStats) report(cfg Config, started time.Time, resumed Offset, err error) Report {
+	r := Report{
+		File:          cfg.FilePath,
+		JobID:         cfg.JobID,
+		Status:        ReportCompleted,
+		StartedAt:     started,
+		FinishedAt:    time.Now().UTC(),
+		ResumedFrom:   resumed,
+		RowsPublished: s.published.Load(),
+		RowsRejected:  s.rejected.Load(),
+		RowsMalformed: s.malformed.Load(),
+		RowsFailed:    s.failed.Load(),
+		Validation:    s.validation,
+	}
+	if err != nil {
+		r.Status = ReportFailed
+		r.Error = err.Error()
+	}
+	return r
+}
@@ -0,0 +1,83 @@
+package csv_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memQuarantine struct {
+	mu         sync.Mutex
+	rejections []csv.Rejection
+	reports    []csv.Report
+}
+
+func (m *memQuarantine) Reject(ctx context.Context, r csv.Rejection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejections = append(m.rejections, r)
+	return nil
+}
+
+func (m *memQuarantine) WriteReport(ctx context.Context, r csv.Report) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reports = append(m.reports, r)
+	return nil
+}
+
+func TestPipeline_Process_Quarantine(t *testing.T) {
+	content := "id,qty\n1,2\n2,x\n3\n4,5\n"
+	schema := &csv.Schema{Columns: []csv.Column{{Name: "qty", Type: csv.TypeInt}}}
+	quarantine := &memQuarantine{}
+
+	events, err := processWith(t, content, csv.Config{Schema: schema, JobID: "job-1", Rejects: quarantine, Reports: quarantine})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	require.Len(t, quarantine.rejections, 2)
+	// Malformed rows are rejected while reading, ahead of the workers.
+	invalid, malformed := quarantine.rejections[0], quarantine.rejections[1]
+	if invalid.Reason == csv.ReasonMalformed {
+		invalid, malformed = malformed, invalid
+	}
+	assert.Equal(t, csv.ReasonInvalid, invalid.Reason)
+	assert.Equal(t, "users.csv", invalid.File)
+	assert.Equal(t, int64(2), invalid.Row)
+	assert.Equal(t, int64(3), invalid.Line)
+	assert.Equal(t, []string{"2", "x"}, invalid.Record)
+
+	assert.Equal(t, csv.ReasonMalformed, malformed.Reason)
+	assert.Zero(t, malformed.Row)
+	assert.Equal(t, int64(4), malformed.Line)
+	assert.Equal(t, []string{"3"}, malformed.Record)
+	require.Len(t, malformed.Violations, 1)
+	assert.Contains(t, malformed.Violations[0], "wrong number of fields")
+
+	require.Len(t, quarantine.reports, 1)
+	report := quarantine.reports[0]
+	assert.Equal(t, csv.ReportCompleted, report.Status)
+	assert.Equal(t, "job-1", report.JobID)
+	assert.Equal(t, int64(2), report.RowsPublished)
+	assert.Equal(t, int64(1), report.RowsRejected)
+	assert.Equal(t, int64(1), report.RowsMalformed)
+	assert.False(t, report.FinishedAt.Before(report.StartedAt))
+}
+
+func TestPipeline_Process_MaxErrors(t *testing.T) {
+	content := "id,qty\n1,x\n2\n3,4\n"
+	schema := &csv.Schema{Columns: []csv.Column{{Name: "qty", Type: csv.TypeInt}}}
+	quarantine := &memQuarantine{}
+
+	_, err := processWith(t, content, csv.Config{Schema: schema, MaxErrors: 1, Rejects: quarantine, Reports: quarantine})
+	require.ErrorIs(t, err, csv.ErrTooManyErrors)
+
+	assert.Len(t, quarantine.rejections, 2, "the row crossing the threshold is quarantined too")
+	require.Len(t, quarantine.reports, 1)
+	assert.Equal(t, csv.ReportFailed, quarantine.reports[0].Status)
+	assert.Contains(t, quarantine.reports[0].Error, "too many rejected rows")
+}
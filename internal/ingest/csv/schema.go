@@ -0,0 +1,198 @@
+package csv
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ColumnType string
+
+const (
+	TypeString  ColumnType = "string"
+	TypeInt     ColumnType = "int"
+	TypeDecimal ColumnType = "decimal"
+	TypeBool    ColumnType = "bool"
+	TypeDate    ColumnType = "date"
+	TypeEnum    ColumnType = "enum"
+)
+
+const defaultDateLayout = "2006-01-02"
+
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+// Schema declares the type and constraints of dataset columns. Columns it
+// does not mention are published as strings, or as their native values in
+// JSON Lines and Parquet files.
+type Schema struct {
+	Columns []Column `json:"columns"`
+
+	compileOnce sync.Once
+	compileErr  error
+}
+
+// Column describes one source column, by its name in the file header.
+type Column struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+	// Layout is the Go time layout of date columns, 2006-01-02 by default.
+	Layout string `json:"layout,omitempty"`
+	// Values lists the allowed values of enum columns.
+	Values []string `json:"values,omitempty"`
+	// Required columns must be present in the header.
+	Required bool `json:"required,omitempty"`
+	// Nullable columns accept empty values, published as null.
+	Nullable bool `json:"nullable,omitempty"`
+	// Pattern is a regular expression the raw value must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// LoadSchema reads and compiles a JSON schema file.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
+	}
+
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema file: %w", err)
+	}
+	if err := s.Compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Compile checks the schema definition and prepares its patterns. The
+// pipeline compiles its schema itself; calling Compile early only surfaces
+// definition errors sooner.
+func (s *Schema) Compile() error {
+	s.compileOnce.Do(func() {
+		s.compileErr = s.compile()
+	})
+	return s.compileErr
+}
+
+func (s *Schema) compile() error {
+	seen := make(map[string]bool, len(s.Columns))
+	for i := range s.Columns {
+		c := &s.Columns[i]
+		if c.Name == "" {
+			return fmt.Errorf("schema column %d has no name", i)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("schema column %q is declared twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		switch c.Type {
+		case "":
+			c.Type = TypeString
+		case TypeString, TypeInt, TypeDecimal, TypeBool:
+		case TypeDate:
+			if c.Layout == "" {
+				c.Layout = defaultDateLayout
+			}
+		case TypeEnum:
+			if len(c.Values) == 0 {
+				return fmt.Errorf("enum column %q has no values", c.Name)
+			}
+		default:
+			return fmt.Errorf("column %q has unknown type %q", c.Name, c.Type)
+		}
+
+		if c.Pattern != "" {
+			re, err := regexp.Compile(c.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern for column %q: %w", c.Name, err)
+			}
+			c.pattern = re
+		}
+	}
+	return nil
+}
+
+func (s *Schema) column(name string) *Column {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Columns {
+		if s.Columns[i].Name == name {
+			return &s.Columns[i]
+		}
+	}
+	return nil
+}
+
+// violation is a value a column rejects.
+type violation struct {
+	column  string
+	value   string
+	problem string
+}
+
+// Error quotes the value, which validation reports leave out.
+func (v *violation) Error() string {
+	if v.value == "" {
+		return fmt.Sprintf("column %q: %s", v.column, v.problem)
+	}
+	return fmt.Sprintf("column %q: %q %s", v.column, v.value, v.problem)
+}
+
+// coerce converts a raw value to the column type, or explains why it
+// cannot.
+func (c *Column) coerce(raw string) (interface{}, *violation) {
+	if raw == "" {
+		if c.Nullable {
+			return nil, nil
+		}
+		return nil, &violation{column: c.Name, problem: "value is required"}
+	}
+	if c.pattern != nil && !c.pattern.MatchString(raw) {
+		return nil, &violation{column: c.Name, value: raw, problem: "does not match " + c.Pattern}
+	}
+
+	switch c.Type {
+	case TypeInt:
+		v, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, &violation{column: c.Name, value: raw, problem: "is not an int"}
+		}
+		return v, nil
+	case TypeDecimal:
+		v := strings.TrimSpace(raw)
+		if !decimalPattern.MatchString(v) {
+			return nil, &violation{column: c.Name, value: raw, problem: "is not a decimal"}
+		}
+		// json.Number keeps every digit instead of rounding through float64.
+		return json.Number(v), nil
+	case TypeBool:
+		v, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, &violation{column: c.Name, value: raw, problem: "is not a bool"}
+		}
+		return v, nil
+	case TypeDate:
+		v, err := time.Parse(c.Layout, strings.TrimSpace(raw))
+		if err != nil {
+			return nil, &violation{column: c.Name, value: raw, problem: "does not match layout " + c.Layout}
+		}
+		return v, nil
+	case TypeEnum:
+		if !slices.Contains(c.Values, raw) {
+			return nil, &violation{column: c.Name, value: raw, problem: "is not one of " + strings.Join(c.Values, ", ")}
+		}
+		return raw, nil
+	default:
+		return raw, nil
+	}
+}
@@ -0,0 +1,71 @@
+package csv_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ordersSchema = `{"columns": [
+	{"name": "id", "type": "int", "required": true},
+	{"name": "amount", "type": "decimal"},
+	{"name": "paid", "type": "bool"},
+	{"name": "placed_on", "type": "date", "layout": "02/01/2006"},
+	{"name": "status", "type": "enum", "values": ["open", "closed"]},
+	{"name": "coupon", "type": "string", "nullable": true, "pattern": "^[A-Z]{4}$"}
+]}`
+
+func TestPipeline_Process_Schema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(path, []byte(ordersSchema), 0o644))
+	schema, err := csv.LoadSchema(path)
+	require.NoError(t, err)
+
+	var rejects bytes.Buffer
+	content := "id,amount,paid,placed_on,status,coupon,note\n" +
+		"1,19.90,true,31/01/2025,open,,first\n" +
+		"x,1.2.3,maybe,2025-01-31,lost,abc,second\n" +
+		"3,0.10,false,01/02/2025,closed,SAVE,third\n"
+
+	events, err := processWith(t, content, csv.Config{Schema: schema, Rejects: csv.NewJSONRejectWriter(&rejects)})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	first := events[0].Payload
+	assert.Equal(t, int64(1), first["id"])
+	assert.Equal(t, json.Number("19.90"), first["amount"])
+	assert.Equal(t, true, first["paid"])
+	assert.Equal(t, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), first["placed_on"])
+	assert.Equal(t, "open", first["status"])
+	assert.Nil(t, first["coupon"])
+	assert.Equal(t, "first", first["note"], "columns outside the schema stay strings")
+
+	var rejection csv.Rejection
+	require.NoError(t, json.Unmarshal(rejects.Bytes(), &rejection))
+	assert.Equal(t, int64(2), rejection.Row)
+	assert.Equal(t, "users.csv", rejection.File)
+	assert.Equal(t, "x", rejection.Record[0])
+	assert.Len(t, rejection.Violations, 6)
+}
+
+func TestPipeline_Process_SchemaRequiredColumn(t *testing.T) {
+	schema := &csv.Schema{Columns: []csv.Column{{Name: "id", Type: csv.TypeInt, Required: true}}}
+
+	_, err := processWith(t, "name\nalice\n", csv.Config{Schema: schema})
+	assert.ErrorIs(t, err, csv.ErrHeaderMismatch)
+}
+
+func TestSchema_Compile(t *testing.T) {
+	schema := &csv.Schema{Columns: []csv.Column{{Name: "status", Type: csv.TypeEnum}}}
+	assert.Error(t, schema.Compile())
+
+	schema = &csv.Schema{Columns: []csv.Column{{Name: "id", Type: "uuid"}}}
+	assert.Error(t, schema.Compile())
+}
@@ -0,0 +1,135 @@
+package csv
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/rate"
+)
+
+// processTransactional publishes rows in batches of cfg.BatchSize, each one
+// committed atomically with the number of rows read so far. Rows covered by
+// the last committed checkpoint are skipped, so restarting after a crash
+// neither loses nor duplicates rows. Batches have to commit in file order,
+// therefore rows are published sequentially whatever cfg.WorkerCount is.
+// Rejections are not part of the transaction: rows covered by the committed
+// checkpoint are not rejected again on resume, but the ones rejected since
+// are, as the batch following them never committed.
+//
+// Kafka holds the authoritative checkpoint, under CheckpointSource, and the
+// last one marks the file completed. Each committed batch is also saved
+// through FileSource.Checkpoint, only so that a restart can seek close to it
+// instead of reading the file from the start.
+func (p *Pipeline) processTransactional(ctx context.Context, cfg Config, stats *runStats, reader *rowReader, publisher kafka.BatchPublisher, limiter *rate.TokenLimiter) error {
+	source := CheckpointSource(cfg.JobID, cfg.FilePath)
+	committed, err := publisher.LastCheckpoint(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to load committed checkpoint: %w", err)
+	}
+	if committed.Offset > 0 {
+		p.logger.Info("Resuming from committed checkpoint", "file", cfg.FilePath, "row", committed.Offset, "completed", committed.Completed)
+	}
+
+	stats.progress(reader.start)
+	batchSize := max(cfg.BatchSize, 1)
+	var (
+		last   = reader.start
+		events = make([]model.Event, 0, batchSize)
+		rows   = make([]csvRow, 0, batchSize)
+	)
+
+	flush := func(completed bool) error {
+		if len(events) == 0 && !completed {
+			return nil
+		}
+		batch := kafka.Batch{
+			Events:     events,
+			Checkpoint: kafka.Checkpoint{Source: source, Offset: max(last.Row, committed.Offset), Completed: completed},
+		}
+		if err := publisher.PublishBatch(ctx, batch); err != nil {
+			if ctx.Err() == nil {
+				for _, row := range rows {
+					if err := p.reject(ctx, cfg, stats, row.rejection(ReasonPublishFailed, err.Error())); err != nil {
+						p.logger.Error("Failed to reject row", "row", row.offset.Row, "error", err)
+					}
+				}
+			}
+			return fmt.Errorf("failed to publish batch ending at row %d: %w", last.Row, err)
+		}
+		stats.publish(len(events))
+		stats.progress(last)
+		events = make([]model.Event, 0, batchSize)
+		rows = rows[:0]
+
+		if err := p.source.Checkpoint(ctx, cfg.FilePath, last); err != nil {
+			p.logger.Warn("Failed to save checkpoint", "file", cfg.FilePath, "row", last.Row, "error", err)
+		}
+		return nil
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !isMalformed(err) {
+			return fmt.Errorf("failed to read CSV: %w", err)
+		}
+		stats.bulk.RowsRead.Inc()
+		covered := row.offset.Row <= committed.Offset
+		if err != nil {
+			// Malformed records are not numbered; this one comes before
+			// the next row.
+			covered = reader.row < committed.Offset
+		}
+		if covered {
+			continue
+		}
+		if err != nil {
+			if err := p.reject(ctx, cfg, stats, reader.malformed(row, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := throttle(ctx, limiter); err != nil {
+			return err
+		}
+		last = row.offset
+
+		event, violations := rowEvent(cfg, reader.mapper, row)
+		if len(violations) > 0 {
+			if err := p.reject(ctx, cfg, stats, row.rejection(ReasonInvalid, violations...)); err != nil {
+				return err
+			}
+			continue
+		}
+		events = append(events, event)
+		rows = append(rows, row)
+		if len(events) == batchSize {
+			if err := flush(false); err != nil {
+				return err
+			}
+		}
+	}
+
+	if committed.Completed && len(events) == 0 {
+		return nil
+	}
+	return flush(true)
+}
+
+// CheckpointSource names the Kafka checkpoints of the ingestion of path by
+// the run jobID, so that another job over the same file starts afresh.
+func CheckpointSource(jobID, path string) string {
+	if jobID == "" {
+		return path
+	}
+	return jobID + "/" + path
+}
@@ -0,0 +1,158 @@
+package csv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errCrash = errors.New("injected crash")
+
+// txnPublisher mimics a transactional Kafka producer: events of a batch only
+// become visible together with its checkpoint once the batch commits.
+type txnPublisher struct {
+	mu          sync.Mutex
+	committed   []model.Event
+	checkpoints map[string]kafka.Checkpoint
+	batches     int
+	// crashOnBatch and crashAfter make that batch fail after staging
+	// crashAfter events, as if the process died half way through it.
+	crashOnBatch int
+	crashAfter   int
+}
+
+func (t *txnPublisher) PublishBatch(ctx context.Context, batch kafka.Batch) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.batches++
+	var staged []model.Event
+	for _, event := range batch.Events {
+		if t.batches == t.crashOnBatch && len(staged) == t.crashAfter {
+			return errCrash
+		}
+		staged = append(staged, event)
+	}
+
+	t.committed = append(t.committed, staged...)
+	t.checkpoints[batch.Checkpoint.Source] = batch.Checkpoint
+	return nil
+}
+
+func (t *txnPublisher) LastCheckpoint(ctx context.Context, source string) (kafka.Checkpoint, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.checkpoints[source], nil
+}
+
+func (t *txnPublisher) Publish(ctx context.Context, event model.Event) error {
+	return t.PublishBatch(ctx, kafka.Batch{Events: []model.Event{event}})
+}
+
+func (t *txnPublisher) Close() error { return nil }
+
+func TestPipeline_Process_TransactionalResumeAfterCrash(t *testing.T) {
+	lines := []string{"name,amount"}
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("row-%d,%d", i, i))
+	}
+	content := strings.Join(lines, "\n")
+
+	mockSource := new(MockFileSource)
+	mockSource.On("ResumeOffset", mock.Anything, "billing.csv").Return(csv.Offset{}, nil)
+	mockSource.On("Checkpoint", mock.Anything, "billing.csv", mock.Anything).Return(nil)
+	mockSource.On("MarkCompleted", mock.Anything, "billing.csv").Return(nil).Once()
+	mockSource.On("Open", mock.Anything, "billing.csv").
+		Return(io.NopCloser(strings.NewReader(content)), nil).Once()
+	mockSource.On("Open", mock.Anything, "billing.csv").
+		Return(io.NopCloser(strings.NewReader(content)), nil).Once()
+
+	publisher := &txnPublisher{checkpoints: map[string]kafka.Checkpoint{}, crashOnBatch: 2, crashAfter: 2}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{FilePath: "billing.csv", WorkerCount: 4, BatchSize: 4}
+
+	err := csv.NewPipeline(mockSource, publisher, logger, metrics.New()).Process(context.Background(), cfg)
+	require.ErrorIs(t, err, errCrash)
+
+	checkpoint, err := publisher.LastCheckpoint(context.Background(), "billing.csv")
+	require.NoError(t, err)
+	assert.Equal(t, kafka.Checkpoint{Source: "billing.csv", Offset: 4}, checkpoint)
+
+	err = csv.NewPipeline(mockSource, publisher, logger, metrics.New()).Process(context.Background(), cfg)
+	require.NoError(t, err)
+
+	var rows []string
+	for _, event := range publisher.committed {
+		rows = append(rows, event.Payload["name"].(string))
+	}
+	assert.Equal(t, []string{
+		"row-1", "row-2", "row-3", "row-4", "row-5",
+		"row-6", "row-7", "row-8", "row-9", "row-10",
+	}, rows)
+	assert.Equal(t, kafka.Checkpoint{Source: "billing.csv", Offset: 10, Completed: true}, publisher.checkpoints["billing.csv"])
+	mockSource.AssertExpectations(t)
+}
+
+func TestPipeline_Process_TransactionalCheckpointsPerJob(t *testing.T) {
+	source := &memSource{content: []byte(csvRows(3))}
+	publisher := &txnPublisher{checkpoints: map[string]kafka.Checkpoint{}}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	process := func(jobID string) {
+		t.Helper()
+		source.checkpoint = csv.Offset{}
+		cfg := csv.Config{FilePath: "ids.csv", JobID: jobID, BatchSize: 2}
+		require.NoError(t, csv.NewPipeline(source, publisher, logger, metrics.New()).Process(context.Background(), cfg))
+	}
+
+	process("job-1")
+	assert.Len(t, publisher.committed, 3)
+	assert.Equal(t, kafka.Checkpoint{Source: "job-1/ids.csv", Offset: 3, Completed: true}, publisher.checkpoints["job-1/ids.csv"])
+
+	// The completed job has nothing left to publish, another job over the
+	// same file starts afresh.
+	process("job-1")
+	assert.Len(t, publisher.committed, 3)
+	process("job-2")
+	assert.Len(t, publisher.committed, 6)
+}
+
+func TestPipeline_Process_TransactionalResumeSkipsCommittedRejections(t *testing.T) {
+	content := "name,amount\nrow-1,1\nrow-2\nrow-3,x\nrow-4,4\nrow-5,5\nrow-6,6\nrow-7,7\n"
+	source := &memSource{content: []byte(content)}
+	publisher := &txnPublisher{checkpoints: map[string]kafka.Checkpoint{}, crashOnBatch: 2, crashAfter: 1}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	schema := &csv.Schema{Columns: []csv.Column{{Name: "name"}, {Name: "amount", Type: csv.TypeInt}}}
+	var rejects bytes.Buffer
+	cfg := csv.Config{FilePath: "billing.csv", BatchSize: 2, Schema: schema, Rejects: csv.NewJSONRejectWriter(&rejects)}
+
+	err := csv.NewPipeline(source, publisher, logger, metrics.New()).Process(context.Background(), cfg)
+	require.ErrorIs(t, err, errCrash)
+	assert.Equal(t, kafka.Checkpoint{Source: "billing.csv", Offset: 3}, publisher.checkpoints["billing.csv"])
+	// The malformed and invalid rows, then the two of the failed batch.
+	assert.Equal(t, 4, strings.Count(rejects.String(), "\n"))
+
+	// Resuming from the start of the file does not reject the rows the
+	// committed batch covers again.
+	source.checkpoint = csv.Offset{}
+	require.NoError(t, csv.NewPipeline(source, publisher, logger, metrics.New()).Process(context.Background(), cfg))
+	assert.Equal(t, 4, strings.Count(rejects.String(), "\n"))
+	var rows []string
+	for _, event := range publisher.committed {
+		rows = append(rows, event.Payload["name"].(string))
+	}
+	assert.Equal(t, []string{"row-1", "row-4", "row-5", "row-6", "row-7"}, rows)
+}
@@ -3,20 +3,86 @@ package csv
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type FileSource interface {
 	Open(ctx context.Context, path string) (io.ReadCloser, error)
-	Checkpoint(ctx context.Context, path string, offset int64) error
-	ResumeOffset(ctx context.Context, path string) (int64, error)
+	Checkpoint(ctx context.Context, path string, offset Offset) error
+	ResumeOffset(ctx context.Context, path string) (Offset, error)
 	MarkCompleted(ctx context.Context, path string) error
 }
 
+// Offset is a position in a CSV file just after a data row: its byte offset
+// and the number of data rows up to and including that row.
+type Offset struct {
+	Bytes int64 `json:"bytes"`
+	Row   int64 `json:"row"`
+}
+
 type Config struct {
 	FilePath    string
 	WorkerCount int
-	BatchSize   int
-	RateLimit   float64
+	// BatchSize is the number of rows published together.
+	BatchSize int
+	// ParseWorkers parses seekable delimited files in chunks of
+	// ParseChunkSize bytes, that many at a time, when above one. Other
+	// inputs, S3 objects among them, and files of less than two chunks are
+	// read sequentially.
+	ParseWorkers int
+	// ParseChunkSize defaults to 4 MiB.
+	ParseChunkSize int64
+	// RateLimit bounds the rows published or rejected as invalid per
+	// second. Zero is unlimited.
+	RateLimit float64
+	// Format is the layout of the file; its zero value follows the file
+	// extension.
+	Format Format
+	// NoHeader treats the first row of delimited text as data instead of
+	// column names.
+	NoHeader bool
+	// Mapping renames, drops and validates columns; nil publishes every
+	// column under its header name.
+	Mapping *Mapping
+	// Schema types and validates columns; nil publishes values as strings,
+	// or native values for typed formats.
+	Schema *Schema
+	// Rejects receives rows that are not published: invalid, malformed, or
+	// failing to publish. When nil they are only logged.
+	Rejects RejectSink
+	// MaxErrors fails the run with ErrTooManyErrors once more rows were
+	// rejected as invalid or malformed. Zero allows any number.
+	MaxErrors int
+	// Reports receives the report of the run when it ends.
+	Reports ReportSink
+	// CheckpointInterval is how often the published watermark is saved
+	// through FileSource.Checkpoint. Defaults to one second.
+	CheckpointInterval time.Duration
+	// JobID identifies the ingestion run. Together with FilePath and the row
+	// number it derives event IDs, so re-publishing a row after a resume
+	// yields the same ID.
+	JobID string
+	// Dataset labels the metrics of the run; it is "unknown" when empty.
+	Dataset string
+	// KeyColumn names the source column used as Kafka key, so rows sharing
+	// a value land on the same partition. Defaults to the event ID.
+	KeyColumn string
+	// ValidateOnly reads every row from the start of the file and validates
+	// it, including checking that KeyColumn values are unique, without
+	// publishing, checkpointing or marking the file completed. Failing rows
+	// go to Rejects as usual, and the report of the run details the
+	// findings in Validation. Previous is ignored.
+	ValidateOnly bool
+	// Previous is the path of the previous version of the file. When set,
+	// only rows inserted, updated or deleted since are published, as change
+	// events keyed by KeyColumn, which is then required.
+	Previous string
+	// Heartbeat, when set, is called every HeartbeatInterval while the file
+	// is processed. An error stops processing with that error; it is how an
+	// owner that lost its job to another one is fenced out.
+	Heartbeat func(ctx context.Context) error
+	// HeartbeatInterval defaults to ten seconds.
+	HeartbeatInterval time.Duration
 }
 
 type Processor interface {
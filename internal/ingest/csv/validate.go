@@ -0,0 +1,105 @@
+package csv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// validateFile reads every row of r and validates it without publishing,
+// recording the findings in stats.validation.
+func (p *Pipeline) validateFile(ctx context.Context, cfg Config, stats *runStats, r io.Reader) error {
+	reader, err := newRowReader(r, cfg, Offset{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// keys holds the row number of the first row of each key.
+	var keys *diffIndex
+	if reader.mapper.key >= 0 {
+		if keys, err = newDiffIndex(); err != nil {
+			return err
+		}
+		defer keys.Close()
+	}
+
+	v := stats.validation
+	for {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !isMalformed(err) {
+			return fmt.Errorf("failed to read CSV: %w", err)
+		}
+		v.RowsRead++
+		stats.bulk.RowsRead.Inc()
+
+		if err != nil {
+			v.sample(ValidationSample{Line: row.line, Reason: ReasonMalformed, Errors: []string{err.Error()}})
+			if err := p.reject(ctx, cfg, stats, reader.malformed(row, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, violations := reader.mapper.payload(row.record, row.values); len(violations) > 0 {
+			messages := make([]string, len(violations))
+			problems := make([]string, len(violations))
+			for i, violation := range violations {
+				v.ErrorsByColumn[violation.column]++
+				messages[i] = violation.Error()
+				problems[i] = fmt.Sprintf("column %q: %s", violation.column, violation.problem)
+			}
+			v.sample(ValidationSample{Row: row.offset.Row, Line: row.line, Reason: ReasonInvalid, Errors: problems})
+			if err := p.reject(ctx, cfg, stats, row.rejection(ReasonInvalid, messages...)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if keys != nil {
+			first, err := firstRowOfKey(keys, reader.mapper.keyOf(row.record), row.offset.Row)
+			if err != nil {
+				return err
+			}
+			if first > 0 {
+				v.DuplicateKeys++
+				problem := fmt.Sprintf("column %q: duplicate of row %d", cfg.KeyColumn, first)
+				v.sample(ValidationSample{Row: row.offset.Row, Line: row.line, Reason: ReasonDuplicateKey, Errors: []string{problem}})
+				if err := p.reject(ctx, cfg, stats, row.rejection(ReasonDuplicateKey, problem)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		v.RowsValid++
+	}
+
+	p.logger.Info("Bulk file validated", "file", cfg.FilePath, "rows", v.RowsRead, "valid", v.RowsValid,
+		"rejected", stats.rejected.Load(), "malformed", stats.malformed.Load())
+	return nil
+}
+
+// firstRowOfKey returns the row key was first seen at, or 0 and records it
+// at row when it is new.
+func firstRowOfKey(keys *diffIndex, key string, row int64) (int64, error) {
+	sum := sha256.Sum256([]byte(key))
+	digest := [16]byte(sum[:16])
+	found, err := keys.find(digest)
+	if err != nil {
+		return 0, err
+	}
+	if found != nil {
+		return int64(binary.BigEndian.Uint64(found.digest[:8])), nil
+	}
+	var first [16]byte
+	binary.BigEndian.PutUint64(first[:8], uint64(row))
+	return 0, keys.put(digest, first)
+}
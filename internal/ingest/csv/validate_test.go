@@ -0,0 +1,65 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline_Process_ValidateOnly(t *testing.T) {
+	content := "id,qty\n1,2\n2,secret\n3\n1,4\n2,5\n"
+	source := &memSource{content: []byte(content), checkpoint: csv.Offset{Bytes: 10, Row: 1}}
+	quarantine := &memQuarantine{}
+	cfg := csv.Config{
+		FilePath:     "orders.csv",
+		KeyColumn:    "id",
+		Schema:       &csv.Schema{Columns: []csv.Column{{Name: "qty", Type: csv.TypeInt}}},
+		ValidateOnly: true,
+		Rejects:      quarantine,
+		Reports:      quarantine,
+	}
+
+	events, err := processFormat(t, source, cfg)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, csv.Offset{Bytes: 10, Row: 1}, source.checkpoint, "validation leaves the checkpoint alone")
+	assert.False(t, source.completed)
+	assert.Len(t, quarantine.rejections, 3)
+
+	require.Len(t, quarantine.reports, 1)
+	report := quarantine.reports[0]
+	assert.Equal(t, csv.ReportCompleted, report.Status)
+	assert.Zero(t, report.RowsPublished)
+	assert.Equal(t, int64(2), report.RowsRejected)
+	assert.Equal(t, int64(1), report.RowsMalformed)
+
+	v := report.Validation
+	require.NotNil(t, v)
+	assert.Equal(t, int64(5), v.RowsRead)
+	assert.Equal(t, int64(2), v.RowsValid)
+	assert.Equal(t, int64(1), v.DuplicateKeys)
+	assert.Equal(t, map[string]int64{"qty": 1}, v.ErrorsByColumn)
+	assert.Equal(t, []csv.ValidationSample{
+		{Row: 2, Line: 3, Reason: csv.ReasonInvalid, Errors: []string{`column "qty": is not an int`}},
+		{Line: 4, Reason: csv.ReasonMalformed, Errors: []string{"record on line 4: wrong number of fields"}},
+		{Row: 3, Line: 5, Reason: csv.ReasonDuplicateKey, Errors: []string{`column "id": duplicate of row 1`}},
+	}, v.Samples)
+}
+
+func TestPipeline_Process_ValidateOnlyHeader(t *testing.T) {
+	quarantine := &memQuarantine{}
+	cfg := csv.Config{
+		FilePath:     "orders.csv",
+		Mapping:      &csv.Mapping{Columns: []string{"id", "qty"}},
+		ValidateOnly: true,
+		Reports:      quarantine,
+	}
+
+	_, err := processFormat(t, &memSource{content: []byte("id,total\n1,2\n")}, cfg)
+	assert.ErrorIs(t, err, csv.ErrHeaderMismatch)
+	require.Len(t, quarantine.reports, 1)
+	assert.Equal(t, csv.ReportFailed, quarantine.reports[0].Status)
+	assert.Zero(t, quarantine.reports[0].Validation.RowsRead)
+}
@@ -0,0 +1,45 @@
+package csv
+
+import "sync"
+
+// watermark tracks rows published by concurrent workers and yields the
+// offset up to which every row has been published, which is the only one
+// safe to checkpoint.
+type watermark struct {
+	mu sync.Mutex
+	// next is the lowest row number not yet published.
+	next int64
+	// done holds published rows above next.
+	done   map[int64]Offset
+	offset Offset
+}
+
+func newWatermark(start Offset) *watermark {
+	return &watermark{
+		next:   start.Row + 1,
+		done:   make(map[int64]Offset),
+		offset: start,
+	}
+}
+
+func (w *watermark) publish(o Offset) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.done[o.Row] = o
+	for {
+		next, ok := w.done[w.next]
+		if !ok {
+			return
+		}
+		delete(w.done, w.next)
+		w.offset = next
+		w.next++
+	}
+}
+
+func (w *watermark) get() Offset {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.offset
+}
@@ -0,0 +1,70 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+const checksumPrefix = "sha256:"
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// VerifyingSource wraps a FileSource so that reading the resolved file hashes
+// it on the fly and fails at EOF when the digest differs from the manifest.
+// Verification needs every byte, so the file is no longer seekable and a
+// resumed ingestion reads through the rows it skips. Since rows are published
+// while streaming, a mismatch fails the ingestion rather than preventing it.
+//
+// Files without a checksum, and other paths, are opened unchanged.
+func VerifyingSource(source csv.FileSource, resolved Resolved) csv.FileSource {
+	return &verifyingSource{FileSource: source, resolved: resolved}
+}
+
+type verifyingSource struct {
+	csv.FileSource
+	resolved Resolved
+}
+
+func (s *verifyingSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := s.FileSource.Open(ctx, path)
+	if err != nil || path != s.resolved.FilePath || s.resolved.Checksum == "" {
+		return rc, err
+	}
+
+	want, err := hex.DecodeString(s.resolved.Checksum[len(checksumPrefix):])
+	if err != nil || len(want) != sha256.Size {
+		rc.Close()
+		return nil, fmt.Errorf("%w: malformed checksum %q", ErrInvalidManifest, s.resolved.Checksum)
+	}
+	return &verifyingReader{rc: rc, hash: sha256.New(), want: want, path: path}, nil
+}
+
+type verifyingReader struct {
+	rc   io.ReadCloser
+	hash hash.Hash
+	want []byte
+	path string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.rc.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if got := v.hash.Sum(nil); !bytes.Equal(got, v.want) {
+			return n, fmt.Errorf("%w for %s: got sha256:%x", ErrChecksumMismatch, v.path, got)
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Close() error {
+	return v.rc.Close()
+}
@@ -0,0 +1,182 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+// ManifestName is the mutable pointer to the active version of a dataset.
+const ManifestName = "_current.json"
+
+var (
+	ErrInvalidManifest = errors.New("invalid dataset manifest")
+	ErrNotFound        = errors.New("dataset partition not found")
+)
+
+// Manifest is the content of _current.json, as described in RFC 03.
+type Manifest struct {
+	CustomerID string    `json:"customer_id"`
+	Dataset    string    `json:"dataset"`
+	Year       int       `json:"year"`
+	Month      int       `json:"month"`
+	Path       string    `json:"path"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Checksum is "sha256:<hex>"; it is empty for partitions resolved
+	// without a manifest.
+	Checksum string `json:"checksum"`
+}
+
+// Ref selects a dataset version. A zero Year selects the current version
+// from the manifest; otherwise the year=/month= partition is used, which is
+// how past periods are reprocessed.
+type Ref struct {
+	CustomerID string
+	Dataset    string
+	Year       int
+	Month      int
+}
+
+func (r Ref) prefix() string {
+	return fmt.Sprintf("customer_id=%s/dataset=%s", r.CustomerID, r.Dataset)
+}
+
+// Lister is implemented by file sources able to enumerate a partition.
+type Lister interface {
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Resolved is a dataset version ready to be ingested.
+type Resolved struct {
+	Manifest
+	// FilePath is the full path of the data file within the source.
+	FilePath string
+}
+
+// Resolver finds the file holding a dataset version through a FileSource
+// laid out with Hive-style partitions:
+//
+//	customer_id=<id>/dataset=<name>/year=<yyyy>/month=<mm>/<file>
+//	customer_id=<id>/dataset=<name>/_current.json
+type Resolver struct {
+	source csv.FileSource
+}
+
+func NewResolver(source csv.FileSource) *Resolver {
+	return &Resolver{source: source}
+}
+
+func (r *Resolver) Resolve(ctx context.Context, ref Ref) (Resolved, error) {
+	if ref.CustomerID == "" || ref.Dataset == "" {
+		return Resolved{}, errors.New("customer ID and dataset are required")
+	}
+	if ref.Year == 0 {
+		return r.current(ctx, ref)
+	}
+	return r.partition(ctx, ref)
+}
+
+// Previous resolves the version of the month before resolved, which a
+// snapshot diff compares it with.
+func (r *Resolver) Previous(ctx context.Context, resolved Resolved) (Resolved, error) {
+	year, month := resolved.Year, resolved.Month-1
+	if month == 0 {
+		year, month = year-1, 12
+	}
+	return r.partition(ctx, Ref{CustomerID: resolved.CustomerID, Dataset: resolved.Dataset, Year: year, Month: month})
+}
+
+func (r *Resolver) current(ctx context.Context, ref Ref) (Resolved, error) {
+	m, err := r.readManifest(ctx, ref)
+	if err != nil {
+		return Resolved{}, err
+	}
+	if m.CustomerID != ref.CustomerID || m.Dataset != ref.Dataset {
+		return Resolved{}, fmt.Errorf("%w: manifest is for customer %q dataset %q", ErrInvalidManifest, m.CustomerID, m.Dataset)
+	}
+	if m.Checksum != "" && !strings.HasPrefix(m.Checksum, checksumPrefix) {
+		return Resolved{}, fmt.Errorf("%w: unsupported checksum %q", ErrInvalidManifest, m.Checksum)
+	}
+
+	clean := path.Clean(m.Path)
+	if m.Path == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return Resolved{}, fmt.Errorf("%w: path %q is outside the dataset", ErrInvalidManifest, m.Path)
+	}
+	if partition := partitionPath(m.Year, m.Month); !strings.HasPrefix(clean, partition+"/") {
+		return Resolved{}, fmt.Errorf("%w: path %q is not in partition %s", ErrInvalidManifest, m.Path, partition)
+	}
+
+	return Resolved{Manifest: m, FilePath: ref.prefix() + "/" + clean}, nil
+}
+
+// partition resolves a past period. When the current manifest points to the
+// same period its checksum is kept; older files cannot be verified.
+func (r *Resolver) partition(ctx context.Context, ref Ref) (Resolved, error) {
+	if ref.Month < 1 || ref.Month > 12 {
+		return Resolved{}, fmt.Errorf("invalid month %d", ref.Month)
+	}
+
+	if current, err := r.current(ctx, ref); err == nil && current.Year == ref.Year && current.Month == ref.Month {
+		return current, nil
+	}
+
+	partition := partitionPath(ref.Year, ref.Month)
+	prefix := ref.prefix() + "/" + partition + "/"
+	file := fmt.Sprintf("%s_%04d_%02d.csv", ref.Dataset, ref.Year, ref.Month)
+
+	if lister, ok := r.source.(Lister); ok {
+		var files []string
+		paths, err := lister.List(ctx, prefix)
+		if err != nil {
+			return Resolved{}, err
+		}
+		for _, p := range paths {
+			if name := path.Base(p); !strings.HasPrefix(name, "_") && !strings.HasPrefix(name, ".") {
+				files = append(files, strings.TrimPrefix(p, prefix))
+			}
+		}
+		switch len(files) {
+		case 0:
+			return Resolved{}, fmt.Errorf("%w: %s", ErrNotFound, prefix)
+		case 1:
+			file = files[0]
+		default:
+			return Resolved{}, fmt.Errorf("partition %s holds %d files, expected one", prefix, len(files))
+		}
+	}
+
+	return Resolved{
+		Manifest: Manifest{
+			CustomerID: ref.CustomerID,
+			Dataset:    ref.Dataset,
+			Year:       ref.Year,
+			Month:      ref.Month,
+			Path:       partition + "/" + file,
+		},
+		FilePath: prefix + file,
+	}, nil
+}
+
+func (r *Resolver) readManifest(ctx context.Context, ref Ref) (Manifest, error) {
+	rc, err := r.source.Open(ctx, ref.prefix()+"/"+ManifestName)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer rc.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return Manifest{}, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	return m, nil
+}
+
+func partitionPath(year, month int) string {
+	return fmt.Sprintf("year=%04d/month=%02d", year, month)
+}
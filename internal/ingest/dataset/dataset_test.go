@@ -0,0 +1,153 @@
+package dataset_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	january  = "id,total\n1,10\n2,20\n"
+	february = "id,total\n3,30\n"
+)
+
+type countingProducer struct {
+	events []model.Event
+}
+
+func (c *countingProducer) Publish(ctx context.Context, event model.Event) error {
+	c.events = append(c.events, event)
+	return nil
+}
+
+func (c *countingProducer) Close() error { return nil }
+
+// newLake lays out two monthly partitions of the orders dataset with a
+// manifest pointing at February.
+func newLake(t *testing.T, checksum string) *storage.LocalSource {
+	t.Helper()
+	root := t.TempDir()
+	base := filepath.Join(root, "customer_id=123", "dataset=orders")
+
+	write := func(rel, content string) {
+		p := filepath.Join(base, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	write("year=2025/month=01/orders_2025_01.csv", january)
+	write("year=2025/month=02/orders_2025_02.csv", february)
+	write(dataset.ManifestName, fmt.Sprintf(`{
+		"customer_id": "123",
+		"dataset": "orders",
+		"year": 2025,
+		"month": 2,
+		"path": "year=2025/month=02/orders_2025_02.csv",
+		"uploaded_at": "2025-02-28T22:10:00Z",
+		"checksum": %q
+	}`, checksum))
+
+	return storage.NewLocalSource(root)
+}
+
+func ingest(t *testing.T, source csv.FileSource, resolved dataset.Resolved) ([]model.Event, error) {
+	t.Helper()
+	producer := &countingProducer{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	pipeline := csv.NewPipeline(dataset.VerifyingSource(source, resolved), producer, logger, metrics.New())
+	err := pipeline.Process(context.Background(), csv.Config{FilePath: resolved.FilePath, WorkerCount: 1, BatchSize: 1})
+	return producer.events, err
+}
+
+func TestResolver_Current(t *testing.T) {
+	source := newLake(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(february))))
+
+	resolved, err := dataset.NewResolver(source).Resolve(context.Background(), dataset.Ref{CustomerID: "123", Dataset: "orders"})
+	require.NoError(t, err)
+	assert.Equal(t, "customer_id=123/dataset=orders/year=2025/month=02/orders_2025_02.csv", resolved.FilePath)
+	assert.Equal(t, 2, resolved.Month)
+
+	events, err := ingest(t, source, resolved)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestResolver_ChecksumMismatch(t *testing.T) {
+	source := newLake(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("something else"))))
+
+	resolved, err := dataset.NewResolver(source).Resolve(context.Background(), dataset.Ref{CustomerID: "123", Dataset: "orders"})
+	require.NoError(t, err)
+
+	_, err = ingest(t, source, resolved)
+	assert.ErrorIs(t, err, dataset.ErrChecksumMismatch)
+}
+
+func TestResolver_ChecksumMismatchValidateOnly(t *testing.T) {
+	source := newLake(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("something else"))))
+
+	resolved, err := dataset.NewResolver(source).Resolve(context.Background(), dataset.Ref{CustomerID: "123", Dataset: "orders"})
+	require.NoError(t, err)
+
+	producer := &countingProducer{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	pipeline := csv.NewPipeline(dataset.VerifyingSource(source, resolved), producer, logger, metrics.New())
+	err = pipeline.Process(context.Background(), csv.Config{FilePath: resolved.FilePath, ValidateOnly: true})
+	assert.ErrorIs(t, err, dataset.ErrChecksumMismatch)
+	assert.Empty(t, producer.events)
+}
+
+func TestResolver_TimeTravel(t *testing.T) {
+	source := newLake(t, "")
+	resolver := dataset.NewResolver(source)
+
+	resolved, err := resolver.Resolve(context.Background(), dataset.Ref{CustomerID: "123", Dataset: "orders", Year: 2025, Month: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "customer_id=123/dataset=orders/year=2025/month=01/orders_2025_01.csv", resolved.FilePath)
+	assert.Empty(t, resolved.Checksum)
+
+	events, err := ingest(t, source, resolved)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	_, err = resolver.Resolve(context.Background(), dataset.Ref{CustomerID: "123", Dataset: "orders", Year: 2024, Month: 12})
+	assert.ErrorIs(t, err, dataset.ErrNotFound)
+}
+
+func TestResolver_Previous(t *testing.T) {
+	source := newLake(t, "")
+	resolver := dataset.NewResolver(source)
+
+	current, err := resolver.Resolve(context.Background(), dataset.Ref{CustomerID: "123", Dataset: "orders"})
+	require.NoError(t, err)
+	previous, err := resolver.Previous(context.Background(), current)
+	require.NoError(t, err)
+	assert.Equal(t, "customer_id=123/dataset=orders/year=2025/month=01/orders_2025_01.csv", previous.FilePath)
+
+	_, err = resolver.Previous(context.Background(), previous)
+	assert.ErrorIs(t, err, dataset.ErrNotFound)
+}
+
+func TestResolver_ManifestOutsideDataset(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "customer_id=123", "dataset=orders")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, dataset.ManifestName), []byte(`{
+		"customer_id": "123", "dataset": "orders", "year": 2025, "month": 1,
+		"path": "../../customer_id=456/dataset=orders/year=2025/month=01/orders.csv"
+	}`), 0o644))
+
+	_, err := dataset.NewResolver(storage.NewLocalSource(root)).Resolve(context.Background(), dataset.Ref{CustomerID: "123", Dataset: "orders"})
+	assert.ErrorIs(t, err, dataset.ErrInvalidManifest)
+}
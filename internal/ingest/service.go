@@ -10,14 +10,23 @@ import (
 	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
 	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
 	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/tracing"
 )
 
 var (
 	ErrQueueFull = errors.New("ingestion queue is full")
 )
 
+// envelope carries an event through the queue together with the trace
+// context of the request that produced it, since the request context itself
+// is gone by the time a worker publishes the event.
+type envelope struct {
+	event model.Event
+	trace tracing.TraceContext
+}
+
 type Service struct {
-	queue    chan model.Event
+	queue    chan envelope
 	producer kafka.Producer
 	logger   *slog.Logger
 	metrics  *metrics.Metrics
@@ -26,7 +35,7 @@ type Service struct {
 
 func NewService(queueSize int, workerCount int, producer kafka.Producer, logger *slog.Logger, m *metrics.Metrics) *Service {
 	s := &Service{
-		queue:    make(chan model.Event, queueSize),
+		queue:    make(chan envelope, queueSize),
 		producer: producer,
 		logger:   logger,
 		metrics:  m,
@@ -42,7 +51,7 @@ func NewService(queueSize int, workerCount int, producer kafka.Producer, logger
 
 func (s *Service) Ingest(ctx context.Context, event model.Event) error {
 	select {
-	case s.queue <- event:
+	case s.queue <- envelope{event: event, trace: tracing.FromContextOrNew(ctx)}:
 		s.metrics.IngestQueueSize.Inc()
 		s.metrics.EventsReceived.Inc()
 		return nil
@@ -55,11 +64,12 @@ func (s *Service) worker(id int) {
 	defer s.wg.Done()
 	s.logger.Debug("Worker started", "worker_id", id)
 
-	for event := range s.queue {
+	for env := range s.queue {
+		event := env.event
 		s.metrics.IngestQueueSize.Dec()
 		start := time.Now()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(tracing.ContextWith(context.Background(), env.trace), 5*time.Second)
 		err := s.producer.Publish(ctx, event)
 		cancel()
 
@@ -67,7 +77,7 @@ func (s *Service) worker(id int) {
 		s.metrics.IngestLatency.Observe(duration)
 
 		if err != nil {
-			s.logger.Error("Failed to process event", "event_id", event.ID, "error", err)
+			s.logger.Error("Failed to process event", "event_id", event.ID, "trace_id", env.trace.TraceID, "error", err)
 			s.metrics.EventsFailed.Inc()
 		} else {
 			s.metrics.EventsPublished.Inc()
@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+type Status string
+
+const (
+	StatusPending    Status = "PENDING"
+	StatusInProgress Status = "IN_PROGRESS"
+	StatusCompleted  Status = "COMPLETED"
+	StatusFailed     Status = "FAILED"
+	// StatusCanceled jobs were stopped by an operator and are not resumed.
+	StatusCanceled Status = "CANCELED"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	// ErrLocked is returned when another job of the same customer, dataset
+	// and period is already pending or in progress.
+	ErrLocked = errors.New("an active job already exists for this dataset period")
+	// ErrInvalidTransition is returned when a job is not in a status that
+	// allows the requested change.
+	ErrInvalidTransition = errors.New("invalid job status transition")
+	// ErrLeaseLost is returned to a lease holder once another owner has
+	// claimed the job.
+	ErrLeaseLost = errors.New("job lease lost")
+	// ErrCanceled stops a job canceled by an operator.
+	ErrCanceled = errors.New("job canceled")
+)
+
+// Job is one ingestion run of a dataset period, as modelled in RFC 03.
+type Job struct {
+	ID         string `json:"id"`
+	CustomerID string `json:"customer_id"`
+	Dataset    string `json:"dataset"`
+	// Period is the dataset period, formatted as YYYY-MM.
+	Period      string     `json:"period"`
+	FilePath    string     `json:"file_path"`
+	Status      Status     `json:"status"`
+	LastOffset  csv.Offset `json:"last_offset"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+	// Owner identifies the process running the job.
+	Owner string `json:"owner,omitempty"`
+	// LeaseToken increases with every claim of the job; writes carrying an
+	// older token are rejected.
+	LeaseToken int64 `json:"lease_token"`
+	// Options are those of the submission, which every run of the job
+	// ingests with.
+	Options Options `json:"options"`
+	// Previous is the previous version of the file for diff jobs.
+	Previous string `json:"previous,omitempty"`
+}
+
+// ListFilter selects jobs; zero fields match every job.
+type ListFilter struct {
+	CustomerID string
+	Dataset    string
+	Period     string
+	FilePath   string
+	Status     Status
+	// Limit defaults to 100.
+	Limit int
+}
+
+// Lease is the right to run a job, held by the owner that claimed it until
+// another owner claims the job after its heartbeat expired.
+type Lease struct {
+	JobID string
+	Owner string
+	// Token fences out previous holders of the job.
+	Token int64
+}
+
+// JobStore persists jobs. At most one job per (customer, dataset, period)
+// may be PENDING or IN_PROGRESS at a time; the store enforces it.
+type JobStore interface {
+	// Create records a PENDING job, generating its ID when empty. Its Owner
+	// is the process queueing it, which keeps it with HeartbeatPending.
+	Create(ctx context.Context, job Job) (Job, error)
+	Get(ctx context.Context, id string) (Job, error)
+	// Claim moves a PENDING or FAILED job to IN_PROGRESS under a new lease
+	// for owner.
+	Claim(ctx context.Context, id string, owner string) (Lease, error)
+	// ClaimStale takes over a PENDING or IN_PROGRESS job whose heartbeat is
+	// older than staleAfter, atomically, so that concurrent callers never
+	// get the same job. It returns ErrNotFound when no job is stale.
+	ClaimStale(ctx context.Context, staleAfter time.Duration, owner string) (Lease, error)
+	// HeartbeatPending refreshes the heartbeat of the PENDING jobs of owner
+	// among ids, which are still queued there.
+	HeartbeatPending(ctx context.Context, owner string, ids []string) error
+	// Checkpoint saves the offset of the job and refreshes its heartbeat.
+	Checkpoint(ctx context.Context, lease Lease, offset csv.Offset) error
+	Heartbeat(ctx context.Context, lease Lease) error
+	// Release gives up the lease without ending the job, which stays
+	// IN_PROGRESS and is stale right away for ClaimStale to resume it.
+	Release(ctx context.Context, lease Lease) error
+	Complete(ctx context.Context, lease Lease) error
+	// Fail moves the job to FAILED with reason.
+	Fail(ctx context.Context, lease Lease, reason string) error
+	// Cancel moves a PENDING or IN_PROGRESS job to CANCELED whoever holds
+	// it; its owner loses the job at its next heartbeat.
+	Cancel(ctx context.Context, id string) error
+	// List returns the jobs matching filter, most recent first.
+	List(ctx context.Context, filter ListFilter) ([]Job, error)
+	Close() error
+}
@@ -0,0 +1,413 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+)
+
+const (
+	defaultMaxConcurrent     = 2
+	defaultHeartbeatInterval = 10 * time.Second
+)
+
+// ErrInvalidSubmission is returned when a Submission cannot be run.
+var ErrInvalidSubmission = errors.New("invalid job submission")
+
+// Submission asks for a dataset period to be imported.
+type Submission struct {
+	CustomerID string `json:"customer_id"`
+	Dataset    string `json:"dataset"`
+	// Year and Month select a past period; zero imports the current version
+	// of the dataset from its manifest.
+	Year  int `json:"year,omitempty"`
+	Month int `json:"month,omitempty"`
+	// FilePath imports a file directly instead of resolving the dataset.
+	// Period, as YYYY-MM, is then required.
+	FilePath string  `json:"file_path,omitempty"`
+	Period   string  `json:"period,omitempty"`
+	Options  Options `json:"options"`
+}
+
+// Options are the csv.Config settings a submission may override.
+type Options struct {
+	WorkerCount  int          `json:"workers,omitempty"`
+	BatchSize    int          `json:"batch_size,omitempty"`
+	ParseWorkers int          `json:"parse_workers,omitempty"`
+	RateLimit    float64      `json:"rate_limit,omitempty"`
+	KeyColumn    string       `json:"key_column,omitempty"`
+	Format       csv.Format   `json:"format"`
+	Diff         bool         `json:"diff,omitempty"`
+	NoHeader     bool         `json:"no_header,omitempty"`
+	MaxErrors    int          `json:"max_errors,omitempty"`
+	Mapping      *csv.Mapping `json:"mapping,omitempty"`
+	Schema       *csv.Schema  `json:"schema,omitempty"`
+}
+
+// Report is a job along with the progress this process knows of.
+type Report struct {
+	Job
+	// RowsProcessed is the number of rows published or rejected up to the
+	// last checkpoint.
+	RowsProcessed int64 `json:"rows_processed"`
+	// RowsRejected counts rows rejected by this process, and is only known
+	// while the job runs here.
+	RowsRejected *int64 `json:"rows_rejected,omitempty"`
+	Running      bool   `json:"running"`
+}
+
+type ManagerConfig struct {
+	// Owner identifies this process in the jobs it runs. Defaults to
+	// DefaultOwner().
+	Owner string
+	// MaxConcurrent bounds the jobs running at once; others wait PENDING.
+	// Defaults to 2.
+	MaxConcurrent int
+	// Pipeline holds the defaults of the jobs run.
+	Pipeline csv.Config
+	// HeartbeatInterval is how often the jobs queued here heartbeat, which
+	// keeps supervisors from taking them over. It must be well below their
+	// StaleAfter. Defaults to ten seconds.
+	HeartbeatInterval time.Duration
+}
+
+// Manager runs submitted jobs in process, at most MaxConcurrent at a time.
+type Manager struct {
+	store    JobStore
+	runner   *Runner
+	resolver *dataset.Resolver
+	cfg      ManagerConfig
+	logger   *slog.Logger
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+	// jobs holds the jobs submitted to this process until they stop; queue
+	// the ones waiting for a slot, in submission order.
+	jobs    map[string]*activeJob
+	queue   []*activeJob
+	running int
+}
+
+type activeJob struct {
+	id     string
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	cfg    csv.Config
+	// lease is set for jobs taken over, which are claimed already.
+	lease    *Lease
+	started  bool
+	rejected atomic.Int64
+}
+
+func NewManager(store JobStore, runner *Runner, resolver *dataset.Resolver, cfg ManagerConfig, logger *slog.Logger) *Manager {
+	if cfg.Owner == "" {
+		cfg.Owner = DefaultOwner()
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = defaultMaxConcurrent
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		store:    store,
+		runner:   runner,
+		resolver: resolver,
+		cfg:      cfg,
+		logger:   logger,
+		ctx:      ctx,
+		shutdown: cancel,
+		jobs:     make(map[string]*activeJob),
+	}
+	m.wg.Add(1)
+	go m.heartbeat()
+	return m
+}
+
+// heartbeat keeps the jobs queued here from looking orphaned until Shutdown.
+func (m *Manager) heartbeat() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		ids := make([]string, 0, len(m.queue))
+		for _, queued := range m.queue {
+			ids = append(ids, queued.id)
+		}
+		m.mu.Unlock()
+		if err := m.store.HeartbeatPending(m.ctx, m.cfg.Owner, ids); err != nil && m.ctx.Err() == nil {
+			m.logger.Warn("Failed to heartbeat queued jobs", "error", err)
+		}
+	}
+}
+
+// Submit creates a PENDING job for sub and runs it once a slot is free.
+func (m *Manager) Submit(ctx context.Context, sub Submission) (Job, error) {
+	job := Job{CustomerID: sub.CustomerID, Dataset: sub.Dataset, FilePath: sub.FilePath, Period: sub.Period}
+	if job.CustomerID == "" || job.Dataset == "" {
+		return Job{}, fmt.Errorf("%w: customer_id and dataset are required", ErrInvalidSubmission)
+	}
+	if sub.Year != 0 && (sub.Month < 1 || sub.Month > 12) {
+		return Job{}, fmt.Errorf("%w: invalid month %d", ErrInvalidSubmission, sub.Month)
+	}
+	if sub.Options.Schema != nil {
+		if err := sub.Options.Schema.Compile(); err != nil {
+			return Job{}, fmt.Errorf("%w: %v", ErrInvalidSubmission, err)
+		}
+	}
+	if err := sub.Options.Format.Validate(); err != nil {
+		return Job{}, fmt.Errorf("%w: %v", ErrInvalidSubmission, err)
+	}
+	if sub.Options.Diff && sub.Options.KeyColumn == "" && m.cfg.Pipeline.KeyColumn == "" {
+		return Job{}, fmt.Errorf("%w: diff requires key_column", ErrInvalidSubmission)
+	}
+
+	var resolved dataset.Resolved
+	if job.FilePath == "" {
+		var err error
+		resolved, err = m.resolver.Resolve(ctx, dataset.Ref{CustomerID: sub.CustomerID, Dataset: sub.Dataset, Year: sub.Year, Month: sub.Month})
+		if err != nil {
+			return Job{}, fmt.Errorf("failed to resolve dataset: %w", err)
+		}
+		job.FilePath = resolved.FilePath
+		job.Period = fmt.Sprintf("%04d-%02d", resolved.Year, resolved.Month)
+	} else if job.Period == "" {
+		return Job{}, fmt.Errorf("%w: period is required with file_path", ErrInvalidSubmission)
+	} else if sub.Options.Diff {
+		period, err := time.Parse("2006-01", job.Period)
+		if err != nil {
+			return Job{}, fmt.Errorf("%w: invalid period %q", ErrInvalidSubmission, job.Period)
+		}
+		resolved.Manifest = dataset.Manifest{CustomerID: job.CustomerID, Dataset: job.Dataset, Year: period.Year(), Month: int(period.Month())}
+	}
+
+	if sub.Options.Diff {
+		previous, err := m.resolver.Previous(ctx, resolved)
+		if err != nil {
+			return Job{}, fmt.Errorf("failed to resolve previous version: %w", err)
+		}
+		job.Previous = previous.FilePath
+	}
+
+	job.Owner = m.cfg.Owner
+	job.Options = sub.Options
+	job, err := m.store.Create(ctx, job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	active := m.newActiveJob(job.ID)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = active
+	m.queue = append(m.queue, active)
+	m.dispatch()
+	return job, nil
+}
+
+func (m *Manager) newActiveJob(id string) *activeJob {
+	runCtx, cancel := context.WithCancelCause(m.ctx)
+	active := &activeJob{id: id, ctx: runCtx, cancel: cancel, cfg: m.cfg.Pipeline}
+	active.cfg.Rejects = &countingRejects{RejectSink: active.cfg.Rejects, count: &active.rejected}
+	return active
+}
+
+// config returns the pipeline configuration of a job with opts, on top of
+// defaults.
+func (opts Options) config(defaults csv.Config) csv.Config {
+	cfg := defaults
+	if opts.WorkerCount > 0 {
+		cfg.WorkerCount = opts.WorkerCount
+	}
+	if opts.BatchSize > 0 {
+		cfg.BatchSize = opts.BatchSize
+	}
+	if opts.ParseWorkers > 0 {
+		cfg.ParseWorkers = opts.ParseWorkers
+	}
+	if opts.RateLimit > 0 {
+		cfg.RateLimit = opts.RateLimit
+	}
+	if opts.KeyColumn != "" {
+		cfg.KeyColumn = opts.KeyColumn
+	}
+	if opts.Format != (csv.Format{}) {
+		cfg.Format = opts.Format
+	}
+	if opts.NoHeader {
+		cfg.NoHeader = true
+	}
+	if opts.MaxErrors > 0 {
+		cfg.MaxErrors = opts.MaxErrors
+	}
+	if opts.Mapping != nil {
+		cfg.Mapping = opts.Mapping
+	}
+	if opts.Schema != nil {
+		cfg.Schema = opts.Schema
+	}
+	cfg.WorkerCount = max(cfg.WorkerCount, 1)
+	cfg.BatchSize = max(cfg.BatchSize, 1)
+	return cfg
+}
+
+// dispatch starts queued jobs while slots are free. m.mu must be held.
+func (m *Manager) dispatch() {
+	for m.running < m.cfg.MaxConcurrent && len(m.queue) > 0 && m.ctx.Err() == nil {
+		active := m.queue[0]
+		m.queue = m.queue[1:]
+		m.running++
+		active.started = true
+		m.wg.Add(1)
+		go m.run(active)
+	}
+}
+
+// reserve takes a slot for a job to take over, unless none is free. The
+// slot is then either given back by unreserve or used by adopt.
+func (m *Manager) reserve() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running >= m.cfg.MaxConcurrent || m.ctx.Err() != nil {
+		return false
+	}
+	m.running++
+	m.wg.Add(1)
+	return true
+}
+
+func (m *Manager) unreserve() {
+	m.wg.Done()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running--
+	m.dispatch()
+}
+
+// adopt runs the job claimed under lease in the slot taken by reserve,
+// where it can be reported on and canceled like the jobs submitted here.
+func (m *Manager) adopt(lease Lease) {
+	active := m.newActiveJob(lease.JobID)
+	active.lease = &lease
+	active.started = true
+	m.mu.Lock()
+	m.jobs[lease.JobID] = active
+	m.mu.Unlock()
+	go m.run(active)
+}
+
+func (m *Manager) run(active *activeJob) {
+	defer m.wg.Done()
+	var err error
+	if active.lease != nil {
+		err = m.runner.Resume(active.ctx, *active.lease, active.cfg)
+	} else {
+		err = m.runner.Run(active.ctx, active.id, m.cfg.Owner, active.cfg)
+	}
+	if err != nil {
+		m.logger.Error("Ingestion job failed", "job_id", active.id, "error", err)
+	}
+	active.cancel(nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, active.id)
+	m.running--
+	m.dispatch()
+}
+
+// Cancel stops a PENDING or IN_PROGRESS job. A job running in this process
+// stops right away; one running elsewhere at its next heartbeat.
+func (m *Manager) Cancel(ctx context.Context, id string) error {
+	if err := m.store.Cancel(ctx, id); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	active := m.jobs[id]
+	if active == nil {
+		return nil
+	}
+	active.cancel(ErrCanceled)
+	if !active.started {
+		delete(m.jobs, id)
+		m.queue = slices.DeleteFunc(m.queue, func(queued *activeJob) bool { return queued == active })
+	}
+	return nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (Report, error) {
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		return Report{}, err
+	}
+	return m.report(job), nil
+}
+
+func (m *Manager) List(ctx context.Context, filter ListFilter) ([]Report, error) {
+	jobs, err := m.store.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, len(jobs))
+	for i, job := range jobs {
+		reports[i] = m.report(job)
+	}
+	return reports, nil
+}
+
+func (m *Manager) report(job Job) Report {
+	r := Report{Job: job, RowsProcessed: job.LastOffset.Row}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if active := m.jobs[job.ID]; active != nil && active.started {
+		rejected := active.rejected.Load()
+		r.RowsRejected = &rejected
+		r.Running = true
+	}
+	return r
+}
+
+// Shutdown stops the running jobs and waits for them. They are released
+// IN_PROGRESS, and queued jobs stay PENDING, for supervisors to resume
+// them: the former right away, the latter once their heartbeat is stale.
+func (m *Manager) Shutdown() {
+	m.shutdown()
+	m.wg.Wait()
+}
+
+// countingRejects counts rejected rows before handing them to the optional
+// sink.
+type countingRejects struct {
+	csv.RejectSink
+	count *atomic.Int64
+}
+
+func (c *countingRejects) Reject(ctx context.Context, r csv.Rejection) error {
+	c.count.Add(1)
+	if c.RejectSink == nil {
+		return nil
+	}
+	return c.RejectSink.Reject(ctx, r)
+}
@@ -0,0 +1,251 @@
+package jobs_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedProducer holds every publish until open is closed.
+type gatedProducer struct {
+	open chan struct{}
+}
+
+func (g *gatedProducer) Publish(ctx context.Context, event model.Event) error {
+	select {
+	case <-g.open:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *gatedProducer) Close() error { return nil }
+
+func newManager(t *testing.T, producer *gatedProducer) (*jobs.Manager, *jobs.SQLStore) {
+	t.Helper()
+	dir := t.TempDir()
+	partition := filepath.Join(dir, "customer_id=123", "dataset=orders", "year=2025", "month=01")
+	require.NoError(t, os.MkdirAll(partition, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(partition, "orders.csv"), []byte("id,sku\n1,A\n2,B\n3,C\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "customer_id=123", "dataset=orders", dataset.ManifestName),
+		[]byte(`{"customer_id":"123","dataset":"orders","year":2025,"month":1,"path":"year=2025/month=01/orders.csv"}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.csv"), []byte("id\n1\n"), 0o644))
+
+	store := openSQLite(t)
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	runner := jobs.NewRunner(store, source, producer, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:         "pod-a",
+		MaxConcurrent: 1,
+		Pipeline:      csv.Config{WorkerCount: 1, BatchSize: 1},
+	}, logger)
+	t.Cleanup(manager.Shutdown)
+	return manager, store
+}
+
+func waitForStatus(t *testing.T, manager *jobs.Manager, id string, status jobs.Status) jobs.Report {
+	t.Helper()
+	var report jobs.Report
+	require.Eventually(t, func() bool {
+		var err error
+		report, err = manager.Get(context.Background(), id)
+		return err == nil && report.Status == status
+	}, 5*time.Second, 5*time.Millisecond, "job %s never reached %s", id, status)
+	return report
+}
+
+func TestManager_BoundsConcurrencyAndCancels(t *testing.T) {
+	ctx := context.Background()
+	producer := &gatedProducer{open: make(chan struct{})}
+	manager, _ := newManager(t, producer)
+
+	first, err := manager.Submit(ctx, jobs.Submission{CustomerID: "123", Dataset: "orders"})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01", first.Period)
+	assert.Equal(t, "customer_id=123/dataset=orders/year=2025/month=01/orders.csv", first.FilePath)
+
+	_, err = manager.Submit(ctx, jobs.Submission{CustomerID: "123", Dataset: "orders"})
+	assert.ErrorIs(t, err, jobs.ErrLocked)
+
+	second, err := manager.Submit(ctx, jobs.Submission{CustomerID: "123", Dataset: "other", FilePath: "other.csv", Period: "2025-01"})
+	require.NoError(t, err)
+
+	report := waitForStatus(t, manager, first.ID, jobs.StatusInProgress)
+	assert.True(t, report.Running)
+	report, err = manager.Get(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusPending, report.Status, "only one job runs at a time")
+
+	require.NoError(t, manager.Cancel(ctx, first.ID))
+	assert.ErrorIs(t, manager.Cancel(ctx, first.ID), jobs.ErrInvalidTransition)
+	report = waitForStatus(t, manager, first.ID, jobs.StatusCanceled)
+	assert.Empty(t, report.Error)
+
+	close(producer.open)
+	report = waitForStatus(t, manager, second.ID, jobs.StatusCompleted)
+	assert.Equal(t, int64(1), report.RowsProcessed)
+
+	listed, err := manager.List(ctx, jobs.ListFilter{Status: jobs.StatusCanceled})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, first.ID, listed[0].ID)
+}
+
+func TestManager_InvalidSubmission(t *testing.T) {
+	manager, _ := newManager(t, &gatedProducer{open: make(chan struct{})})
+
+	for _, sub := range []jobs.Submission{
+		{Dataset: "orders"},
+		{CustomerID: "123", Dataset: "orders", FilePath: "other.csv"},
+		{CustomerID: "123", Dataset: "orders", Year: 2025, Month: 13},
+		{CustomerID: "123", Dataset: "orders", Options: jobs.Options{Schema: &csv.Schema{Columns: []csv.Column{{Name: "id", Type: "uuid"}}}}},
+		{CustomerID: "123", Dataset: "orders", Options: jobs.Options{Format: csv.Format{Type: "xlsx"}}},
+		{CustomerID: "123", Dataset: "orders", Options: jobs.Options{Format: csv.Format{Delimiter: ";;"}}},
+		{CustomerID: "123", Dataset: "orders", Options: jobs.Options{Diff: true}},
+		{CustomerID: "123", Dataset: "orders", FilePath: "orders.csv", Period: "2025", Options: jobs.Options{Diff: true, KeyColumn: "id"}},
+	} {
+		_, err := manager.Submit(context.Background(), sub)
+		assert.ErrorIs(t, err, jobs.ErrInvalidSubmission, "%+v", sub)
+	}
+}
+
+func TestManager_ShutdownHandsJobsOver(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFile(t, dir, "orders.csv", "id\n1\n2\n3\n")
+	writeFile(t, dir, "users.csv", "id\n1\n")
+	store := openSQLite(t)
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{WorkerCount: 1, BatchSize: 1, HeartbeatInterval: 10 * time.Millisecond}
+
+	// pod-a runs one job and queues another while pod-b looks for stale
+	// jobs.
+	runner := jobs.NewRunner(store, source, &gatedProducer{open: make(chan struct{})}, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:             "pod-a",
+		MaxConcurrent:     1,
+		Pipeline:          cfg,
+		HeartbeatInterval: 10 * time.Millisecond,
+	}, logger)
+	running, err := manager.Submit(ctx, jobs.Submission{CustomerID: "123", Dataset: "orders", FilePath: "orders.csv", Period: "2025-01"})
+	require.NoError(t, err)
+	queued, err := manager.Submit(ctx, jobs.Submission{CustomerID: "123", Dataset: "users", FilePath: "users.csv", Period: "2025-01"})
+	require.NoError(t, err)
+	waitForStatus(t, manager, running.ID, jobs.StatusInProgress)
+
+	open := make(chan struct{})
+	close(open)
+	takeover := jobs.NewManager(store, jobs.NewRunner(store, source, &gatedProducer{open: open}, logger, metrics.New()), dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:    "pod-b",
+		Pipeline: cfg,
+	}, logger)
+	t.Cleanup(takeover.Shutdown)
+	supervisor := jobs.NewSupervisor(takeover, jobs.SupervisorConfig{
+		ScanInterval: 10 * time.Millisecond,
+		StaleAfter:   200 * time.Millisecond,
+	}, logger)
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- supervisor.Run(runCtx) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	time.Sleep(400 * time.Millisecond)
+	got, err := store.Get(ctx, running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "pod-a", got.Owner, "the running job heartbeats")
+	got, err = store.Get(ctx, queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusPending, got.Status, "the queued job heartbeats")
+
+	manager.Shutdown()
+	got, err = store.Get(ctx, running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusInProgress, got.Status, "shutting down does not fail the job")
+
+	for id, rows := range map[string]int64{running.ID: 3, queued.ID: 1} {
+		require.Eventually(t, func() bool {
+			got, err := store.Get(ctx, id)
+			return err == nil && got.Status == jobs.StatusCompleted
+		}, 5*time.Second, 10*time.Millisecond)
+		got, err := store.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, "pod-b", got.Owner)
+		assert.Equal(t, rows, got.LastOffset.Row)
+	}
+}
+
+func TestManager_HandedOverJobKeepsOptions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFile(t, dir, "orders.csv", "id,name\n1,a\n2,b\n")
+	store := openSQLite(t)
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{WorkerCount: 1, BatchSize: 1, HeartbeatInterval: 10 * time.Millisecond}
+
+	runner := jobs.NewRunner(store, source, &gatedProducer{open: make(chan struct{})}, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:    "pod-a",
+		Pipeline: cfg,
+	}, logger)
+	job, err := manager.Submit(ctx, jobs.Submission{CustomerID: "123", Dataset: "orders", FilePath: "orders.csv", Period: "2025-01",
+		Options: jobs.Options{
+			KeyColumn: "id",
+			Mapping:   &csv.Mapping{Rename: map[string]string{"name": "customer_name"}},
+			Schema:    &csv.Schema{Columns: []csv.Column{{Name: "id", Type: csv.TypeInt}, {Name: "name"}}},
+		}})
+	require.NoError(t, err)
+	waitForStatus(t, manager, job.ID, jobs.StatusInProgress)
+	manager.Shutdown()
+
+	// pod-b only knows the defaults, not the options of the submission.
+	producer := &failingProducer{failAfter: -1}
+	takeover := jobs.NewManager(store, jobs.NewRunner(store, source, producer, logger, metrics.New()), dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:    "pod-b",
+		Pipeline: cfg,
+	}, logger)
+	t.Cleanup(takeover.Shutdown)
+	supervisor := jobs.NewSupervisor(takeover, jobs.SupervisorConfig{
+		ScanInterval: 10 * time.Millisecond,
+		StaleAfter:   200 * time.Millisecond,
+	}, logger)
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- supervisor.Run(runCtx) }()
+
+	require.Eventually(t, func() bool {
+		got, err := store.Get(ctx, job.ID)
+		return err == nil && got.Status == jobs.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	require.Len(t, producer.events, 2)
+	for i, name := range []string{"a", "b"} {
+		event := producer.events[i]
+		assert.Equal(t, strconv.Itoa(i+1), event.Key)
+		assert.Equal(t, int64(i+1), event.Payload["id"])
+		assert.Equal(t, name, event.Payload["customer_name"])
+		assert.NotContains(t, event.Payload, "name")
+	}
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const pgUniqueViolation = "23505"
+
+var postgresDialect = dialect{
+	name: "postgres",
+	migrations: [][]string{{
+		`CREATE TABLE IF NOT EXISTS ingest_jobs (
+			id                TEXT PRIMARY KEY,
+			customer_id       TEXT NOT NULL,
+			dataset           TEXT NOT NULL,
+			period            TEXT NOT NULL,
+			file_path         TEXT NOT NULL,
+			status            TEXT NOT NULL,
+			last_offset_bytes BIGINT NOT NULL DEFAULT 0,
+			last_offset_row   BIGINT NOT NULL DEFAULT 0,
+			error             TEXT NOT NULL DEFAULT '',
+			created_at        TIMESTAMPTZ NOT NULL,
+			started_at        TIMESTAMPTZ,
+			finished_at       TIMESTAMPTZ,
+			heartbeat_at      TIMESTAMPTZ
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS ingest_jobs_active_period
+			ON ingest_jobs (customer_id, dataset, period)
+			WHERE status IN ('PENDING', 'IN_PROGRESS')`,
+	}, {
+		`ALTER TABLE ingest_jobs ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE ingest_jobs ADD COLUMN lease_token BIGINT NOT NULL DEFAULT 0`,
+	}, {
+		`ALTER TABLE ingest_jobs ADD COLUMN options TEXT NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE ingest_jobs ADD COLUMN previous TEXT NOT NULL DEFAULT ''`,
+	}},
+	numberedParams: true,
+	isUniqueViolation: func(err error) bool {
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+	},
+}
+
+// OpenPostgres opens the job store in the Postgres database at dsn.
+func OpenPostgres(ctx context.Context, dsn string) (*SQLStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres job store: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres job store: %w", err)
+	}
+	return newSQLStore(ctx, db, postgresDialect)
+}
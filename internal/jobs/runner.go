@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+)
+
+// Runner executes jobs through csv.Pipeline, keeping their status and
+// offsets in a JobStore instead of next to the files.
+type Runner struct {
+	store    JobStore
+	source   csv.FileSource
+	producer kafka.Producer
+	logger   *slog.Logger
+	metrics  *metrics.Metrics
+}
+
+func NewRunner(store JobStore, source csv.FileSource, producer kafka.Producer, logger *slog.Logger, m *metrics.Metrics) *Runner {
+	return &Runner{
+		store:    store,
+		source:   source,
+		producer: producer,
+		logger:   logger,
+		metrics:  m,
+	}
+}
+
+// Run claims the job for owner and ingests its file like Resume, resuming from
+// the last offset of the job. The job ends COMPLETED, or FAILED with the
+// error. When ctx is done first, as on shutdown, the job is released
+// instead, for a Supervisor to resume it.
+func (r *Runner) Run(ctx context.Context, id string, owner string, cfg csv.Config) error {
+	lease, err := r.store.Claim(ctx, id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to claim job %s: %w", id, err)
+	}
+	return r.Resume(ctx, lease, cfg)
+}
+
+// Resume ingests the file of a job already claimed under lease, with the
+// options the job was submitted with on top of cfg. The pipeline heartbeats
+// the job and stops as soon as the lease is lost, and every write to the
+// job is fenced by the lease, so a previous owner still running can no
+// longer move it.
+func (r *Runner) Resume(ctx context.Context, lease Lease, cfg csv.Config) error {
+	job, err := r.store.Get(ctx, lease.JobID)
+	if err != nil {
+		return err
+	}
+
+	cfg = job.Options.config(cfg)
+	cfg.Previous = job.Previous
+	cfg.FilePath = job.FilePath
+	cfg.JobID = job.ID
+	cfg.Dataset = job.Dataset
+	cfg.Heartbeat = func(ctx context.Context) error {
+		err := r.store.Heartbeat(ctx, lease)
+		if err != nil && !errors.Is(err, ErrLeaseLost) && !errors.Is(err, ErrInvalidTransition) {
+			// The store being unreachable does not mean the lease is lost;
+			// the next heartbeat may go through before the job turns stale.
+			r.logger.Warn("Failed to heartbeat job", "job_id", job.ID, "error", err)
+			return nil
+		}
+		return err
+	}
+	r.logger.Info("Running ingestion job", "job_id", job.ID, "customer_id", job.CustomerID, "dataset", job.Dataset,
+		"period", job.Period, "owner", lease.Owner, "lease", lease.Token, "row", job.LastOffset.Row)
+	if err := r.process(ctx, job, lease, cfg); err != nil {
+		if errors.Is(err, ErrLeaseLost) || errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrCanceled) {
+			// Another owner took the job over, or it was canceled.
+			r.logger.Warn("Job no longer held, stopping", "job_id", job.ID, "error", err)
+			return err
+		}
+		if ctx.Err() != nil {
+			if releaseErr := r.store.Release(context.WithoutCancel(ctx), lease); releaseErr != nil {
+				r.logger.Error("Failed to release job", "job_id", job.ID, "error", releaseErr)
+			}
+			return err
+		}
+		if failErr := r.store.Fail(context.WithoutCancel(ctx), lease, err.Error()); failErr != nil {
+			r.logger.Error("Failed to mark job failed", "job_id", job.ID, "error", failErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// quarantiner is implemented by file sources able to keep rejected rows and
+// run reports next to the files.
+type quarantiner interface {
+	Quarantine(ctx context.Context, path string) (*storage.Quarantine, error)
+}
+
+func (r *Runner) process(ctx context.Context, job Job, lease Lease, cfg csv.Config) error {
+	if q, ok := r.source.(quarantiner); ok {
+		quarantine, err := q.Quarantine(ctx, job.FilePath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := quarantine.Close(); err != nil {
+				r.logger.Error("Failed to close quarantine", "job_id", job.ID, "error", err)
+			}
+		}()
+		cfg.Rejects = csv.TeeRejects(cfg.Rejects, quarantine)
+		cfg.Reports = quarantine
+	}
+
+	source := &trackedSource{FileSource: r.source, store: r.store, job: job, lease: lease}
+	return csv.NewPipeline(source, r.producer, r.logger, r.metrics).Process(ctx, cfg)
+}
+
+// trackedSource reads the file of a job and keeps its ingestion state in
+// the job store. Members of an archive keep theirs in the underlying source,
+// the job completing along with the archive. Completed files are marked in
+// the underlying source as well, which is what a Watcher goes by.
+type trackedSource struct {
+	csv.FileSource
+	store JobStore
+	job   Job
+	lease Lease
+}
+
+func (t *trackedSource) Checkpoint(ctx context.Context, path string, offset csv.Offset) error {
+	if isMember(path) {
+		return t.FileSource.Checkpoint(ctx, path, offset)
+	}
+	return t.store.Checkpoint(ctx, t.lease, offset)
+}
+
+func (t *trackedSource) ResumeOffset(ctx context.Context, path string) (csv.Offset, error) {
+	if isMember(path) {
+		return t.FileSource.ResumeOffset(ctx, path)
+	}
+	return t.job.LastOffset, nil
+}
+
+func (t *trackedSource) MarkCompleted(ctx context.Context, path string) error {
+	if err := t.FileSource.MarkCompleted(ctx, path); err != nil || isMember(path) {
+		return err
+	}
+	return t.store.Complete(ctx, t.lease)
+}
+
+func isMember(path string) bool {
+	_, _, ok := csv.SplitMemberPath(path)
+	return ok
+}
@@ -0,0 +1,180 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingProducer fails every publish after the first failAfter ones.
+type failingProducer struct {
+	events    []model.Event
+	failAfter int
+}
+
+func (f *failingProducer) Publish(ctx context.Context, event model.Event) error {
+	if f.failAfter >= 0 && len(f.events) >= f.failAfter {
+		return errors.New("broker unavailable")
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *failingProducer) Close() error { return nil }
+
+func TestRunner_ResumesFailedJob(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.csv"), []byte("id\n1\n2\n3\n4\n"), 0o644))
+
+	store := openSQLite(t)
+	job, err := store.Create(ctx, jobs.Job{CustomerID: "123", Dataset: "orders", Period: "2025-01", FilePath: "orders.csv"})
+	require.NoError(t, err)
+
+	producer := &failingProducer{failAfter: 2}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	runner := jobs.NewRunner(store, storage.NewLocalSource(dir), producer, logger, metrics.New())
+	cfg := csv.Config{WorkerCount: 1, BatchSize: 1}
+
+	require.Error(t, runner.Run(ctx, job.ID, "pod-a", cfg))
+	failed, err := store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusFailed, failed.Status)
+	assert.Equal(t, int64(2), failed.LastOffset.Row)
+	assert.Contains(t, failed.Error, "broker unavailable")
+
+	producer.failAfter = -1
+	require.NoError(t, runner.Run(ctx, job.ID, "pod-a", cfg))
+	done, err := store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusCompleted, done.Status)
+	assert.Equal(t, int64(4), done.LastOffset.Row)
+
+	require.Len(t, producer.events, 4)
+	for i, event := range producer.events {
+		assert.Equal(t, job.ID, event.Headers[csv.HeaderJobID])
+		assert.Equal(t, csv.RowEventID(job.ID, "orders.csv", int64(i+1)), event.ID)
+	}
+}
+
+func TestSupervisor_TakesOverStaleJob(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.csv"), []byte("id\n1\n2\n3\n4\n"), 0o644))
+
+	store := openSQLite(t)
+	job, err := store.Create(ctx, jobs.Job{CustomerID: "123", Dataset: "orders", Period: "2025-01", FilePath: "orders.csv"})
+	require.NoError(t, err)
+
+	// pod-a crashes after checkpointing the first two rows.
+	crashed, err := store.Claim(ctx, job.ID, "pod-a")
+	require.NoError(t, err)
+	require.NoError(t, store.Checkpoint(ctx, crashed, csv.Offset{Bytes: 7, Row: 2}))
+
+	producer := &failingProducer{failAfter: -1}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	source := storage.NewLocalSource(dir)
+	runner := jobs.NewRunner(store, source, producer, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:    "pod-b",
+		Pipeline: csv.Config{WorkerCount: 1, BatchSize: 1},
+	}, logger)
+	t.Cleanup(manager.Shutdown)
+	supervisor := jobs.NewSupervisor(manager, jobs.SupervisorConfig{
+		ScanInterval: 10 * time.Millisecond,
+		StaleAfter:   50 * time.Millisecond,
+	}, logger)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- supervisor.Run(runCtx) }()
+
+	require.Eventually(t, func() bool {
+		got, err := store.Get(ctx, job.ID)
+		return err == nil && got.Status == jobs.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	got, err := store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "pod-b", got.Owner)
+	require.Len(t, producer.events, 2, "the rows checkpointed by pod-a are not published again")
+	assert.Equal(t, "3", producer.events[0].Payload["id"])
+
+	// pod-a coming back cannot move the job anymore.
+	assert.ErrorIs(t, runner.Resume(ctx, crashed, csv.Config{WorkerCount: 1, BatchSize: 1}), jobs.ErrLeaseLost)
+	assert.ErrorIs(t, store.Fail(ctx, crashed, "late failure"), jobs.ErrLeaseLost)
+}
+
+func TestSupervisor_TakesOverIntoManagerSlots(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := openSQLite(t)
+	var stale []string
+	for _, name := range []string{"orders", "users"} {
+		writeFile(t, dir, name+".csv", "id\n1\n2\n")
+		job, err := store.Create(ctx, jobs.Job{CustomerID: "123", Dataset: name, Period: "2025-01", FilePath: name + ".csv"})
+		require.NoError(t, err)
+		_, err = store.Claim(ctx, job.ID, "pod-a")
+		require.NoError(t, err)
+		stale = append(stale, job.ID)
+	}
+
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	runner := jobs.NewRunner(store, source, &gatedProducer{open: make(chan struct{})}, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:         "pod-b",
+		MaxConcurrent: 1,
+		Pipeline:      csv.Config{WorkerCount: 1, BatchSize: 1, HeartbeatInterval: 10 * time.Millisecond},
+	}, logger)
+	t.Cleanup(manager.Shutdown)
+	supervisor := jobs.NewSupervisor(manager, jobs.SupervisorConfig{
+		ScanInterval: 10 * time.Millisecond,
+		StaleAfter:   50 * time.Millisecond,
+	}, logger)
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- supervisor.Run(runCtx) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	ownedBy := func(id, owner string) bool {
+		got, err := store.Get(ctx, id)
+		return err == nil && got.Owner == owner
+	}
+	require.Eventually(t, func() bool { return ownedBy(stale[0], "pod-b") || ownedBy(stale[1], "pod-b") },
+		5*time.Second, 10*time.Millisecond)
+	taken, waiting := stale[0], stale[1]
+	if !ownedBy(taken, "pod-b") {
+		taken, waiting = waiting, taken
+	}
+
+	// The only slot is busy, so the other job waits.
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, ownedBy(waiting, "pod-a"))
+	report, err := manager.Get(ctx, taken)
+	require.NoError(t, err)
+	assert.True(t, report.Running)
+
+	require.NoError(t, manager.Cancel(ctx, taken))
+	require.Eventually(t, func() bool { return ownedBy(waiting, "pod-b") }, 5*time.Second, 10*time.Millisecond)
+	waitForStatus(t, manager, taken, jobs.StatusCanceled)
+}
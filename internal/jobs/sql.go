@@ -0,0 +1,378 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+// dialect holds what differs between the SQL databases a SQLStore runs on.
+type dialect struct {
+	name string
+	// migrations are applied in order, once each. The first one creates the
+	// jobs table and the partial unique index backing the per-period lock.
+	migrations [][]string
+	// numberedParams rewrites ? placeholders to $1, $2, ...
+	numberedParams    bool
+	isUniqueViolation func(error) bool
+}
+
+// SQLStore is a JobStore on top of database/sql.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+	now     func() time.Time
+}
+
+func newSQLStore(ctx context.Context, db *sql.DB, d dialect) (*SQLStore, error) {
+	s := &SQLStore{db: db, dialect: d, now: func() time.Time { return time.Now().UTC() }}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s job store: %w", d.name, err)
+	}
+	return s, nil
+}
+
+func (s *SQLStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS ingest_schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var current int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM ingest_schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for version := current + 1; version <= len(s.dialect.migrations); version++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range s.dialect.migrations[version-1] {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d: %w", version, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO ingest_schema_migrations (version) VALUES (?)`), version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const jobColumns = `id, customer_id, dataset, period, file_path, status, last_offset_bytes, last_offset_row,
+	error, created_at, started_at, finished_at, heartbeat_at, owner, lease_token, options, previous`
+
+func (s *SQLStore) Create(ctx context.Context, job Job) (Job, error) {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	job.Status = StatusPending
+	job.CreatedAt = s.now()
+	job.StartedAt, job.FinishedAt, job.HeartbeatAt = nil, nil, &job.CreatedAt
+	job.Error, job.LeaseToken = "", 0
+	options, err := json.Marshal(job.Options)
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to marshal job options: %w", err)
+	}
+
+	_, err = s.exec(ctx, `INSERT INTO ingest_jobs (`+jobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, NULL, ?, ?, 0, ?, ?)`,
+		job.ID, job.CustomerID, job.Dataset, job.Period, job.FilePath, job.Status,
+		job.LastOffset.Bytes, job.LastOffset.Row, job.Error, job.CreatedAt, job.CreatedAt, job.Owner,
+		string(options), job.Previous)
+	if err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Job, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+jobColumns+` FROM ingest_jobs WHERE id = ?`), id)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *SQLStore) Claim(ctx context.Context, id string, owner string) (Lease, error) {
+	now := s.now()
+	row := s.queryRow(ctx,
+		`UPDATE ingest_jobs SET status = ?, error = '', started_at = COALESCE(started_at, ?), finished_at = NULL,
+			heartbeat_at = ?, owner = ?, lease_token = lease_token + 1
+		WHERE id = ? AND status IN (?, ?)
+		RETURNING lease_token`,
+		StatusInProgress, now, now, owner, id, StatusPending, StatusFailed)
+
+	lease := Lease{JobID: id, Owner: owner}
+	err := row.Scan(&lease.Token)
+	if errors.Is(err, sql.ErrNoRows) {
+		job, err := s.Get(ctx, id)
+		if err != nil {
+			return Lease{}, err
+		}
+		return Lease{}, fmt.Errorf("%w: job %s is %s", ErrInvalidTransition, id, job.Status)
+	}
+	if err != nil {
+		return Lease{}, s.writeErr(err)
+	}
+	return lease, nil
+}
+
+func (s *SQLStore) ClaimStale(ctx context.Context, staleAfter time.Duration, owner string) (Lease, error) {
+	now := s.now()
+	deadline := now.Add(-staleAfter)
+	// The status and heartbeat are checked again by the UPDATE itself: when
+	// two callers pick the same job, the second one matches no row once the
+	// first has refreshed the heartbeat. PENDING jobs created before they
+	// had a heartbeat go by their creation.
+	const stale = `status IN (?, ?) AND COALESCE(heartbeat_at, created_at) < ?`
+	row := s.queryRow(ctx,
+		`UPDATE ingest_jobs SET status = ?, started_at = COALESCE(started_at, ?), heartbeat_at = ?, owner = ?,
+			lease_token = lease_token + 1
+		WHERE id = (
+			SELECT id FROM ingest_jobs WHERE `+stale+`
+			ORDER BY COALESCE(heartbeat_at, created_at) LIMIT 1
+		) AND `+stale+`
+		RETURNING id, lease_token`,
+		StatusInProgress, now, now, owner,
+		StatusPending, StatusInProgress, deadline, StatusPending, StatusInProgress, deadline)
+
+	lease := Lease{Owner: owner}
+	err := row.Scan(&lease.JobID, &lease.Token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Lease{}, ErrNotFound
+	}
+	if err != nil {
+		return Lease{}, s.writeErr(err)
+	}
+	return lease, nil
+}
+
+func (s *SQLStore) Checkpoint(ctx context.Context, lease Lease, offset csv.Offset) error {
+	return s.leased(ctx, lease,
+		`UPDATE ingest_jobs SET last_offset_bytes = ?, last_offset_row = ?, heartbeat_at = ?`,
+		offset.Bytes, offset.Row, s.now())
+}
+
+func (s *SQLStore) Heartbeat(ctx context.Context, lease Lease) error {
+	return s.leased(ctx, lease, `UPDATE ingest_jobs SET heartbeat_at = ?`, s.now())
+}
+
+func (s *SQLStore) HeartbeatPending(ctx context.Context, owner string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []any{s.now(), StatusPending, owner}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	_, err := s.exec(ctx, `UPDATE ingest_jobs SET heartbeat_at = ? WHERE status = ? AND owner = ?
+		AND id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, args...)
+	return err
+}
+
+// releasedHeartbeat is the heartbeat of released jobs, older than any
+// staleness threshold.
+var releasedHeartbeat = time.Unix(0, 0).UTC()
+
+func (s *SQLStore) Release(ctx context.Context, lease Lease) error {
+	return s.leased(ctx, lease, `UPDATE ingest_jobs SET owner = '', heartbeat_at = ?`, releasedHeartbeat)
+}
+
+func (s *SQLStore) Complete(ctx context.Context, lease Lease) error {
+	return s.leased(ctx, lease, `UPDATE ingest_jobs SET status = ?, finished_at = ?`, StatusCompleted, s.now())
+}
+
+func (s *SQLStore) Fail(ctx context.Context, lease Lease, reason string) error {
+	return s.leased(ctx, lease, `UPDATE ingest_jobs SET status = ?, error = ?, finished_at = ?`, StatusFailed, reason, s.now())
+}
+
+func (s *SQLStore) Cancel(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, `UPDATE ingest_jobs SET status = ?, finished_at = ? WHERE id = ? AND status IN (?, ?)`,
+		StatusCanceled, s.now(), id, StatusPending, StatusInProgress)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	job, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: job %s is %s", ErrInvalidTransition, id, job.Status)
+}
+
+const defaultListLimit = 100
+
+func (s *SQLStore) List(ctx context.Context, filter ListFilter) ([]Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM ingest_jobs WHERE 1 = 1`
+	var args []any
+	if filter.CustomerID != "" {
+		query += ` AND customer_id = ?`
+		args = append(args, filter.CustomerID)
+	}
+	if filter.Dataset != "" {
+		query += ` AND dataset = ?`
+		args = append(args, filter.Dataset)
+	}
+	if filter.Period != "" {
+		query += ` AND period = ?`
+		args = append(args, filter.Period)
+	}
+	if filter.FilePath != "" {
+		query += ` AND file_path = ?`
+		args = append(args, filter.FilePath)
+	}
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	query += ` ORDER BY created_at DESC, id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list jobs: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// leased runs an update of an IN_PROGRESS job on behalf of the lease
+// holder. It fails with ErrLeaseLost once the job was claimed again, and
+// with ErrInvalidTransition once it is no longer in progress.
+func (s *SQLStore) leased(ctx context.Context, lease Lease, update string, args ...any) error {
+	args = append(args, lease.JobID, StatusInProgress, lease.Token)
+	res, err := s.exec(ctx, update+` WHERE id = ? AND status = ? AND lease_token = ?`, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	job, err := s.Get(ctx, lease.JobID)
+	if err != nil {
+		return err
+	}
+	if job.LeaseToken != lease.Token {
+		return fmt.Errorf("%w: job %s is held by %s", ErrLeaseLost, lease.JobID, job.Owner)
+	}
+	return fmt.Errorf("%w: job %s is %s", ErrInvalidTransition, lease.JobID, job.Status)
+}
+
+func (s *SQLStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, s.writeErr(err)
+	}
+	return res, nil
+}
+
+func (s *SQLStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+func (s *SQLStore) writeErr(err error) error {
+	if s.dialect.isUniqueViolation(err) {
+		return ErrLocked
+	}
+	return fmt.Errorf("failed to write job: %w", err)
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) rebind(query string) string {
+	if !s.dialect.numberedParams {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (Job, error) {
+	var (
+		job                          Job
+		started, finished, heartbeat sql.NullTime
+		options                      string
+	)
+	err := row.Scan(&job.ID, &job.CustomerID, &job.Dataset, &job.Period, &job.FilePath, &job.Status,
+		&job.LastOffset.Bytes, &job.LastOffset.Row, &job.Error, &job.CreatedAt, &started, &finished, &heartbeat,
+		&job.Owner, &job.LeaseToken, &options, &job.Previous)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := json.Unmarshal([]byte(options), &job.Options); err != nil {
+		return Job{}, fmt.Errorf("failed to parse options of job %s: %w", job.ID, err)
+	}
+	job.CreatedAt = job.CreatedAt.UTC()
+	job.StartedAt = timePtr(started)
+	job.FinishedAt = timePtr(finished)
+	job.HeartbeatAt = timePtr(heartbeat)
+	return job, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
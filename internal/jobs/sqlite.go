@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var sqliteDialect = dialect{
+	name: "sqlite",
+	migrations: [][]string{{
+		`CREATE TABLE IF NOT EXISTS ingest_jobs (
+			id                TEXT PRIMARY KEY,
+			customer_id       TEXT NOT NULL,
+			dataset           TEXT NOT NULL,
+			period            TEXT NOT NULL,
+			file_path         TEXT NOT NULL,
+			status            TEXT NOT NULL,
+			last_offset_bytes INTEGER NOT NULL DEFAULT 0,
+			last_offset_row   INTEGER NOT NULL DEFAULT 0,
+			error             TEXT NOT NULL DEFAULT '',
+			created_at        TIMESTAMP NOT NULL,
+			started_at        TIMESTAMP,
+			finished_at       TIMESTAMP,
+			heartbeat_at      TIMESTAMP
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS ingest_jobs_active_period
+			ON ingest_jobs (customer_id, dataset, period)
+			WHERE status IN ('PENDING', 'IN_PROGRESS')`,
+	}, {
+		`ALTER TABLE ingest_jobs ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE ingest_jobs ADD COLUMN lease_token INTEGER NOT NULL DEFAULT 0`,
+	}, {
+		`ALTER TABLE ingest_jobs ADD COLUMN options TEXT NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE ingest_jobs ADD COLUMN previous TEXT NOT NULL DEFAULT ''`,
+	}},
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	},
+}
+
+// OpenSQLite opens the embedded job store in the database file at path.
+func OpenSQLite(ctx context.Context, path string) (*SQLStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite job store: %w", err)
+	}
+	// SQLite serialises writers anyway; one connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	return newSQLStore(ctx, db, sqliteDialect)
+}
@@ -0,0 +1,144 @@
+package jobs_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openSQLite(t *testing.T) *jobs.SQLStore {
+	t.Helper()
+	store, err := jobs.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStore_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := openSQLite(t)
+
+	job, err := store.Create(ctx, jobs.Job{CustomerID: "123", Dataset: "orders", Period: "2025-01", FilePath: "orders.csv"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, job.ID)
+	assert.Equal(t, jobs.StatusPending, job.Status)
+
+	assert.ErrorIs(t, store.Checkpoint(ctx, jobs.Lease{JobID: job.ID}, csv.Offset{Bytes: 10, Row: 1}), jobs.ErrInvalidTransition)
+
+	lease, err := store.Claim(ctx, job.ID, "pod-a")
+	require.NoError(t, err)
+	require.NoError(t, store.Checkpoint(ctx, lease, csv.Offset{Bytes: 120, Row: 10}))
+
+	got, err := store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusInProgress, got.Status)
+	assert.Equal(t, csv.Offset{Bytes: 120, Row: 10}, got.LastOffset)
+	require.NotNil(t, got.StartedAt)
+	require.NotNil(t, got.HeartbeatAt)
+	assert.Equal(t, "pod-a", got.Owner)
+	assert.Equal(t, lease.Token, got.LeaseToken)
+
+	require.NoError(t, store.Fail(ctx, lease, "kafka unavailable"))
+	got, err = store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusFailed, got.Status)
+	assert.Equal(t, "kafka unavailable", got.Error)
+
+	// A failed job is retried from where it stopped.
+	retry, err := store.Claim(ctx, job.ID, "pod-b")
+	require.NoError(t, err)
+	assert.Greater(t, retry.Token, lease.Token)
+	require.NoError(t, store.Complete(ctx, retry))
+	got, err = store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusCompleted, got.Status)
+	assert.Equal(t, int64(10), got.LastOffset.Row)
+	assert.Empty(t, got.Error)
+	assert.NotNil(t, got.FinishedAt)
+
+	_, err = store.Claim(ctx, job.ID, "pod-a")
+	assert.ErrorIs(t, err, jobs.ErrInvalidTransition)
+	_, err = store.Get(ctx, "missing")
+	assert.ErrorIs(t, err, jobs.ErrNotFound)
+}
+
+func TestSQLiteStore_PeriodLock(t *testing.T) {
+	ctx := context.Background()
+	store := openSQLite(t)
+	period := jobs.Job{CustomerID: "123", Dataset: "orders", Period: "2025-01", FilePath: "orders.csv"}
+
+	first, err := store.Create(ctx, period)
+	require.NoError(t, err)
+
+	_, err = store.Create(ctx, period)
+	assert.ErrorIs(t, err, jobs.ErrLocked)
+
+	other := period
+	other.Period = "2025-02"
+	_, err = store.Create(ctx, other)
+	assert.NoError(t, err, "other periods are not locked")
+
+	lease, err := store.Claim(ctx, first.ID, "pod-a")
+	require.NoError(t, err)
+	require.NoError(t, store.Fail(ctx, lease, "cancelled"))
+	second, err := store.Create(ctx, period)
+	require.NoError(t, err, "the lock is released once the job is no longer active")
+
+	// Restarting the failed job would make two active jobs for the period.
+	_, err = store.Claim(ctx, first.ID, "pod-a")
+	assert.ErrorIs(t, err, jobs.ErrLocked)
+
+	lease, err = store.Claim(ctx, second.ID, "pod-a")
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, lease))
+	_, err = store.Create(ctx, period)
+	assert.NoError(t, err, "a completed period can be reprocessed")
+}
+
+func TestSQLiteStore_ClaimStale(t *testing.T) {
+	ctx := context.Background()
+	store := openSQLite(t)
+
+	job, err := store.Create(ctx, jobs.Job{CustomerID: "123", Dataset: "orders", Period: "2025-01", FilePath: "orders.csv"})
+	require.NoError(t, err)
+	old, err := store.Claim(ctx, job.ID, "pod-a")
+	require.NoError(t, err)
+	require.NoError(t, store.Checkpoint(ctx, old, csv.Offset{Bytes: 50, Row: 5}))
+
+	_, err = store.ClaimStale(ctx, time.Minute, "pod-b")
+	assert.ErrorIs(t, err, jobs.ErrNotFound, "the heartbeat is fresh")
+
+	time.Sleep(20 * time.Millisecond)
+	lease, err := store.ClaimStale(ctx, 10*time.Millisecond, "pod-b")
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, lease.JobID)
+	assert.Greater(t, lease.Token, old.Token)
+
+	_, err = store.ClaimStale(ctx, 10*time.Millisecond, "pod-c")
+	assert.ErrorIs(t, err, jobs.ErrNotFound, "the takeover refreshed the heartbeat")
+
+	// The previous owner is fenced out.
+	assert.ErrorIs(t, store.Heartbeat(ctx, old), jobs.ErrLeaseLost)
+	assert.ErrorIs(t, store.Checkpoint(ctx, old, csv.Offset{Bytes: 90, Row: 9}), jobs.ErrLeaseLost)
+	assert.ErrorIs(t, store.Complete(ctx, old), jobs.ErrLeaseLost)
+
+	got, err := store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusInProgress, got.Status)
+	assert.Equal(t, "pod-b", got.Owner)
+	assert.Equal(t, csv.Offset{Bytes: 50, Row: 5}, got.LastOffset)
+
+	// A released job is stale right away.
+	require.NoError(t, store.Release(ctx, lease))
+	released, err := store.ClaimStale(ctx, time.Hour, "pod-c")
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, released.JobID)
+	assert.ErrorIs(t, store.Complete(ctx, lease), jobs.ErrLeaseLost)
+	require.NoError(t, store.Complete(ctx, released))
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	defaultScanInterval = 30 * time.Second
+	defaultStaleAfter   = 2 * time.Minute
+)
+
+type SupervisorConfig struct {
+	// ScanInterval is how often stale jobs are looked for. Defaults to 30s.
+	ScanInterval time.Duration
+	// StaleAfter is how long a job may go without heartbeat before it is
+	// taken over. It must be well above the heartbeat interval of the
+	// pipeline, or healthy jobs get taken over. Defaults to two minutes.
+	StaleAfter time.Duration
+}
+
+// Supervisor resumes IN_PROGRESS jobs whose owner stopped heartbeating,
+// typically because its pod died mid-import, or released them on shutdown,
+// and runs PENDING jobs left queued by a Manager that stopped. Claiming a
+// stale job hands out a new lease, so the previous owner, should it still
+// be alive, fails its next heartbeat or checkpoint and stops.
+//
+// The jobs taken over run in the Manager, as its owner, in the slots its
+// submitted jobs share; stale jobs wait for a free slot.
+type Supervisor struct {
+	manager *Manager
+	cfg     SupervisorConfig
+	logger  *slog.Logger
+}
+
+func NewSupervisor(manager *Manager, cfg SupervisorConfig, logger *slog.Logger) *Supervisor {
+	if cfg.ScanInterval <= 0 {
+		cfg.ScanInterval = defaultScanInterval
+	}
+	if cfg.StaleAfter <= 0 {
+		cfg.StaleAfter = defaultStaleAfter
+	}
+	return &Supervisor{manager: manager, cfg: cfg, logger: logger}
+}
+
+// DefaultOwner identifies the current process as <hostname>-<pid>.
+func DefaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Run scans for stale jobs until ctx is done. The jobs it took over keep
+// running until the Manager shuts down.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.cfg.ScanInterval)
+	defer ticker.Stop()
+
+	for {
+		s.scan(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan claims stale jobs until none is left or no slot is free, and
+// resumes each of them.
+func (s *Supervisor) scan(ctx context.Context) {
+	for ctx.Err() == nil && s.manager.reserve() {
+		lease, err := s.manager.store.ClaimStale(ctx, s.cfg.StaleAfter, s.manager.cfg.Owner)
+		if err != nil {
+			s.manager.unreserve()
+			if !errors.Is(err, ErrNotFound) {
+				s.logger.Error("Failed to claim stale job", "error", err)
+			}
+			return
+		}
+
+		s.logger.Info("Taking over stale job", "job_id", lease.JobID, "owner", lease.Owner, "lease", lease.Token)
+		s.manager.adopt(lease)
+	}
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+)
+
+// Notification is a bucket notification in the S3 event format, which is
+// also what MinIO sends to its webhook and Kafka targets.
+type Notification struct {
+	Records []NotificationRecord `json:"Records"`
+}
+
+type NotificationRecord struct {
+	// EventName is s3:ObjectCreated:Put and the like for MinIO, and
+	// ObjectCreated:Put for S3.
+	EventName string `json:"eventName"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			// Key is URL encoded.
+			Key  string `json:"key"`
+			Size int64  `json:"size"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// CompletionSource is a file source that tells which files were imported.
+type CompletionSource interface {
+	csv.FileSource
+	Completed(ctx context.Context, path string) (bool, error)
+}
+
+type TriggerConfig struct {
+	// Bucket is the only bucket notifications are handled for, any bucket
+	// when empty.
+	Bucket string
+	// Prefix restricts the objects imported to part of the bucket.
+	Prefix string
+	// Options are the options of the jobs submitted.
+	Options Options
+}
+
+// Trigger submits a job for every object created under its prefix that is
+// a dataset manifest or a file in a year=/month= partition, as a Watcher
+// would find them. Notifications are delivered at least once: objects
+// already completed are skipped, and so are the ones whose period already
+// has an active job.
+type Trigger struct {
+	resolver *dataset.Resolver
+	source   CompletionSource
+	manager  *Manager
+	cfg      TriggerConfig
+	logger   *slog.Logger
+}
+
+func NewTrigger(source CompletionSource, manager *Manager, cfg TriggerConfig, logger *slog.Logger) *Trigger {
+	return &Trigger{resolver: dataset.NewResolver(source), source: source, manager: manager, cfg: cfg, logger: logger}
+}
+
+// Handle submits the jobs n calls for. It fails only when a job could not
+// be submitted for a reason that may go away, so that the notification can
+// be delivered again; objects that cannot be imported are logged and
+// skipped.
+func (t *Trigger) Handle(ctx context.Context, n Notification) error {
+	for _, record := range n.Records {
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			t.logger.Warn("Skipping notification with invalid object key", "key", record.S3.Object.Key, "error", err)
+			continue
+		}
+		if !isObjectCreated(record.EventName) || !strings.HasPrefix(key, t.cfg.Prefix) ||
+			(t.cfg.Bucket != "" && record.S3.Bucket.Name != t.cfg.Bucket) {
+			continue
+		}
+		if err := t.submit(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Trigger) submit(ctx context.Context, key string) error {
+	c, ok, err := candidateOf(ctx, t.resolver, key)
+	if err != nil {
+		t.logger.Warn("Skipping notified object", "key", key, "error", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	completed, err := t.source.Completed(ctx, c.path)
+	if err != nil {
+		return fmt.Errorf("failed to read state of %s: %w", c.path, err)
+	}
+	if completed {
+		return nil
+	}
+
+	sub := c.sub
+	sub.Options = t.cfg.Options
+	job, err := t.manager.Submit(ctx, sub)
+	switch {
+	case errors.Is(err, ErrLocked):
+		t.logger.Warn("Skipping notified object, its period has an active job", "key", key, "file", c.path)
+		return nil
+	case errors.Is(err, ErrInvalidSubmission), errors.Is(err, dataset.ErrNotFound), errors.Is(err, dataset.ErrInvalidManifest):
+		t.logger.Warn("Skipping notified object", "key", key, "file", c.path, "error", err)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to submit job for %s: %w", c.path, err)
+	}
+	t.logger.Info("Submitted job for notified object", "key", key, "file", c.path, "job_id", job.ID)
+	return nil
+}
+
+func isObjectCreated(event string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(event, "s3:"), "ObjectCreated:")
+}
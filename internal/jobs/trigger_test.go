@@ -0,0 +1,77 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// minioNotification is a notification as MinIO sends it for one object.
+func minioNotification(t *testing.T, event, bucket, key string) jobs.Notification {
+	t.Helper()
+	body := fmt.Sprintf(`{"EventName":%q,"Key":%q,"Records":[{"eventVersion":"2.0","eventSource":"minio:s3",
+		"eventName":%q,"s3":{"s3SchemaVersion":"1.0","bucket":{"name":%q,"arn":"arn:aws:s3:::%s"},
+		"object":{"key":%q,"size":12,"contentType":"text/csv"}}}]}`,
+		event, bucket+"/"+key, event, bucket, bucket, url.QueryEscape(key))
+	var n jobs.Notification
+	require.NoError(t, json.Unmarshal([]byte(body), &n))
+	return n
+}
+
+func TestTrigger_Handle(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFile(t, dir, "customer_id=123/dataset=orders/year=2025/month=01/orders.csv", "id\n1\n")
+	writeFile(t, dir, "customer_id=123/dataset=orders/year=2025/month=02/orders.csv", "id\n1\n")
+	writeFile(t, dir, "customer_id=123/dataset=orders/"+dataset.ManifestName,
+		`{"customer_id":"123","dataset":"orders","year":2025,"month":2,"path":"year=2025/month=02/orders.csv"}`)
+	writeFile(t, dir, "customer_id=123/dataset=users/year=2025/month=01/users.csv", "id\n1\n")
+	writeFile(t, dir, "customer_id=456/dataset=orders/year=2025/month=01/orders.csv", "id\n1\n")
+
+	store := openSQLite(t)
+	source := storage.NewLocalSource(dir)
+	require.NoError(t, source.MarkCompleted(ctx, "customer_id=123/dataset=users/year=2025/month=01/users.csv"))
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	// Jobs never complete, so duplicate notifications hit the active job.
+	runner := jobs.NewRunner(store, source, &gatedProducer{open: make(chan struct{})}, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:    "pod-a",
+		Pipeline: csv.Config{WorkerCount: 1, BatchSize: 1},
+	}, logger)
+	t.Cleanup(manager.Shutdown)
+	trigger := jobs.NewTrigger(source, manager, jobs.TriggerConfig{Bucket: "datasets", Prefix: "customer_id=123/"}, logger)
+
+	for _, n := range []jobs.Notification{
+		minioNotification(t, "s3:ObjectCreated:Put", "datasets", "customer_id=123/dataset=orders/year=2025/month=01/orders.csv"),
+		minioNotification(t, "s3:ObjectCreated:Put", "datasets", "customer_id=123/dataset=orders/year=2025/month=01/orders.csv"),
+		// The manifest and the file it points to import the file once.
+		minioNotification(t, "s3:ObjectCreated:CompleteMultipartUpload", "datasets", "customer_id=123/dataset=orders/year=2025/month=02/orders.csv"),
+		minioNotification(t, "s3:ObjectCreated:Put", "datasets", "customer_id=123/dataset=orders/"+dataset.ManifestName),
+		// Completed, removed, outside the prefix or the bucket, or not in
+		// a partition.
+		minioNotification(t, "s3:ObjectCreated:Put", "datasets", "customer_id=123/dataset=users/year=2025/month=01/users.csv"),
+		minioNotification(t, "s3:ObjectRemoved:Delete", "datasets", "customer_id=123/dataset=users/year=2025/month=02/users.csv"),
+		minioNotification(t, "s3:ObjectCreated:Put", "datasets", "customer_id=456/dataset=orders/year=2025/month=01/orders.csv"),
+		minioNotification(t, "s3:ObjectCreated:Put", "other", "customer_id=123/dataset=users/year=2025/month=03/users.csv"),
+		minioNotification(t, "s3:ObjectCreated:Put", "datasets", "customer_id=123/notes.csv"),
+	} {
+		require.NoError(t, trigger.Handle(ctx, n))
+	}
+
+	assert.Equal(t, []string{
+		"customer_id=123/dataset=orders/year=2025/month=01/orders.csv",
+		"customer_id=123/dataset=orders/year=2025/month=02/orders.csv",
+	}, jobFiles(t, store))
+}
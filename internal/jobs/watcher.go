@@ -0,0 +1,302 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+)
+
+const defaultPollInterval = 30 * time.Second
+
+// WatchSource is a file source a Watcher can find new files in.
+type WatchSource interface {
+	CompletionSource
+	dataset.Lister
+	Size(ctx context.Context, path string) (int64, error)
+}
+
+type WatcherConfig struct {
+	// Prefix restricts the watch to part of the source, the whole of it
+	// when empty.
+	Prefix string
+	// PollInterval is how often the source is listed. Defaults to 30s.
+	PollInterval time.Duration
+	// StableFor is how long a file must keep the same size before it is
+	// imported, so that files still being uploaded are left alone.
+	// Defaults to PollInterval.
+	StableFor time.Duration
+	// Options are the options of the jobs submitted.
+	Options Options
+}
+
+// Watcher polls a source laid out as dataset.Resolver expects and submits a
+// job for every new dataset version: the file a manifest points to, or a
+// file dropped in a year=/month= partition. Files marked completed in the
+// source are skipped, and so are the ones a job was submitted for already,
+// by this process or an earlier one, whatever became of the job; a failed
+// job is left to be resumed rather than submitted again. A file replaced in
+// place after it was imported is not imported again.
+type Watcher struct {
+	source   WatchSource
+	resolver *dataset.Resolver
+	manager  *Manager
+	cfg      WatcherConfig
+	logger   *slog.Logger
+
+	// seen holds the files submitted or found completed, or with a job.
+	seen map[string]bool
+	// pending holds the files waiting to be stable.
+	pending map[string]observation
+}
+
+// observation is the size a file has had since a given time.
+type observation struct {
+	size  int64
+	since time.Time
+}
+
+// candidate is a file to import along with the submission importing it.
+type candidate struct {
+	path string
+	sub  Submission
+}
+
+func NewWatcher(source WatchSource, manager *Manager, cfg WatcherConfig, logger *slog.Logger) *Watcher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.StableFor <= 0 {
+		cfg.StableFor = cfg.PollInterval
+	}
+	return &Watcher{
+		source:   source,
+		resolver: dataset.NewResolver(source),
+		manager:  manager,
+		cfg:      cfg,
+		logger:   logger,
+		seen:     make(map[string]bool),
+		pending:  make(map[string]observation),
+	}
+}
+
+// Run polls the source until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx); err != nil {
+			w.logger.Error("Failed to poll for new files", "prefix", w.cfg.Prefix, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll submits the stable files among the new ones listed.
+func (w *Watcher) poll(ctx context.Context) error {
+	candidates, err := w.candidates(ctx)
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		listed[c.path] = true
+		if w.seen[c.path] || ctx.Err() != nil {
+			continue
+		}
+		completed, err := w.source.Completed(ctx, c.path)
+		if err != nil {
+			w.logger.Warn("Failed to read file state", "file", c.path, "error", err)
+			continue
+		}
+		if completed {
+			w.seen[c.path] = true
+			delete(w.pending, c.path)
+			continue
+		}
+		submitted, err := w.submitted(ctx, c)
+		if err != nil {
+			w.logger.Warn("Failed to look up jobs of file", "file", c.path, "error", err)
+			continue
+		}
+		if submitted {
+			w.seen[c.path] = true
+			delete(w.pending, c.path)
+			continue
+		}
+		if stable, err := w.stable(ctx, c.path); err != nil || !stable {
+			if err != nil {
+				w.logger.Warn("Failed to size file", "file", c.path, "error", err)
+			}
+			continue
+		}
+
+		sub := c.sub
+		sub.Options = w.cfg.Options
+		job, err := w.manager.Submit(ctx, sub)
+		if errors.Is(err, ErrLocked) {
+			// Another job of the period is still active; try again once it
+			// is done.
+			continue
+		}
+		if err != nil {
+			w.logger.Error("Failed to submit job for new file", "file", c.path, "error", err)
+			continue
+		}
+		w.seen[c.path] = true
+		delete(w.pending, c.path)
+		w.logger.Info("Submitted job for new file", "file", c.path, "job_id", job.ID)
+	}
+
+	for p := range w.pending {
+		if !listed[p] {
+			delete(w.pending, p)
+		}
+	}
+	return nil
+}
+
+// submitted reports whether a job, whatever its status, was submitted for
+// the file of c.
+func (w *Watcher) submitted(ctx context.Context, c candidate) (bool, error) {
+	period := c.sub.Period
+	if period == "" {
+		period = fmt.Sprintf("%04d-%02d", c.sub.Year, c.sub.Month)
+	}
+	existing, err := w.manager.List(ctx, ListFilter{
+		CustomerID: c.sub.CustomerID,
+		Dataset:    c.sub.Dataset,
+		Period:     period,
+		FilePath:   c.path,
+		Limit:      1,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(existing) > 0, nil
+}
+
+// stable reports whether the file has kept its size for cfg.StableFor.
+func (w *Watcher) stable(ctx context.Context, p string) (bool, error) {
+	size, err := w.source.Size(ctx, p)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	obs, ok := w.pending[p]
+	if !ok || obs.size != size {
+		obs = observation{size: size, since: now}
+		w.pending[p] = obs
+	}
+	return now.Sub(obs.since) >= w.cfg.StableFor, nil
+}
+
+// candidates lists the files to import under the prefix.
+func (w *Watcher) candidates(ctx context.Context) ([]candidate, error) {
+	paths, err := w.source.List(ctx, w.cfg.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	listed := make(map[string]bool)
+	for _, p := range paths {
+		if w.seen[p] {
+			continue
+		}
+		c, ok, err := candidateOf(ctx, w.resolver, p)
+		if err != nil {
+			w.logger.Warn("Failed to resolve new file", "file", p, "error", err)
+			continue
+		}
+		if ok && !listed[c.path] {
+			listed[c.path] = true
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+// candidateOf returns the file to import when p is a dataset manifest or a
+// file in a partition, and false otherwise. A file the manifest of its
+// dataset points to is submitted through the manifest, so that its checksum
+// is verified.
+func candidateOf(ctx context.Context, resolver *dataset.Resolver, p string) (candidate, bool, error) {
+	if path.Base(p) == dataset.ManifestName {
+		customer, name, ok := datasetDir(path.Dir(p))
+		if !ok {
+			return candidate{}, false, nil
+		}
+		resolved, err := resolver.Resolve(ctx, dataset.Ref{CustomerID: customer, Dataset: name})
+		if err != nil {
+			return candidate{}, false, err
+		}
+		return manifestCandidate(resolved), true, nil
+	}
+
+	sub, ok := partitionFile(p)
+	if !ok {
+		return candidate{}, false, nil
+	}
+	if resolved, err := resolver.Resolve(ctx, dataset.Ref{CustomerID: sub.CustomerID, Dataset: sub.Dataset}); err == nil && resolved.FilePath == p {
+		return manifestCandidate(resolved), true, nil
+	}
+	return candidate{path: p, sub: sub}, true, nil
+}
+
+func manifestCandidate(resolved dataset.Resolved) candidate {
+	return candidate{path: resolved.FilePath, sub: Submission{
+		CustomerID: resolved.CustomerID, Dataset: resolved.Dataset, Year: resolved.Year, Month: resolved.Month,
+	}}
+}
+
+// datasetDir parses customer_id=<id>/dataset=<name>.
+func datasetDir(dir string) (customer, name string, ok bool) {
+	c, d, found := strings.Cut(dir, "/")
+	customer, ok1 := strings.CutPrefix(c, "customer_id=")
+	name, ok2 := strings.CutPrefix(d, "dataset=")
+	return customer, name, found && ok1 && ok2 && customer != "" && name != "" && !strings.Contains(name, "/")
+}
+
+// partitionFile returns the submission importing a file at
+// customer_id=<id>/dataset=<name>/year=<yyyy>/month=<mm>/<file>.
+func partitionFile(p string) (Submission, bool) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 5 || strings.HasPrefix(parts[4], "_") || strings.HasPrefix(parts[4], ".") {
+		return Submission{}, false
+	}
+	customer, name, ok := datasetDir(parts[0] + "/" + parts[1])
+	if !ok {
+		return Submission{}, false
+	}
+	year, err := partitionValue(parts[2], "year=")
+	if err != nil {
+		return Submission{}, false
+	}
+	month, err := partitionValue(parts[3], "month=")
+	if err != nil || month < 1 || month > 12 {
+		return Submission{}, false
+	}
+	return Submission{CustomerID: customer, Dataset: name, FilePath: p, Period: fmt.Sprintf("%04d-%02d", year, month)}, true
+}
+
+func partitionValue(part, key string) (int, error) {
+	value, ok := strings.CutPrefix(part, key)
+	if !ok {
+		return 0, fmt.Errorf("expected %s in %q", key, part)
+	}
+	return strconv.Atoi(value)
+}
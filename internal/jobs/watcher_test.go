@@ -0,0 +1,146 @@
+package jobs_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/dataset"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+// watch runs a watcher over dir until the returned function is called.
+func watch(t *testing.T, store *jobs.SQLStore, dir string, cfg jobs.WatcherConfig) func() {
+	t.Helper()
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	producer := &gatedProducer{open: make(chan struct{})}
+	close(producer.open)
+	runner := jobs.NewRunner(store, source, producer, logger, metrics.New())
+	manager := jobs.NewManager(store, runner, dataset.NewResolver(source), jobs.ManagerConfig{
+		Owner:    "pod-a",
+		Pipeline: csv.Config{WorkerCount: 1, BatchSize: 1},
+	}, logger)
+	t.Cleanup(manager.Shutdown)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, jobs.NewWatcher(source, manager, cfg, logger).Run(ctx))
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func jobFiles(t *testing.T, store *jobs.SQLStore) []string {
+	t.Helper()
+	list, err := store.List(context.Background(), jobs.ListFilter{})
+	require.NoError(t, err)
+	var files []string
+	for _, job := range list {
+		files = append(files, job.FilePath)
+	}
+	slices.Sort(files)
+	return files
+}
+
+func TestWatcher_SubmitsNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "customer_id=123/dataset=orders/year=2025/month=01/orders.csv", "id\n1\n2\n")
+	writeFile(t, dir, "customer_id=123/dataset=orders/"+dataset.ManifestName,
+		`{"customer_id":"123","dataset":"orders","year":2025,"month":1,"path":"year=2025/month=01/orders.csv"}`)
+	writeFile(t, dir, "customer_id=123/dataset=users/year=2025/month=02/users.csv", "id\n1\n")
+	writeFile(t, dir, "customer_id=123/dataset=users/year=2025/month=01/users.csv", "id\n1\n")
+	writeFile(t, dir, "customer_id=123/dataset=users/year=2025/month=02/_SUCCESS", "")
+	writeFile(t, dir, "unrelated/data.csv", "id\n1\n")
+	source := storage.NewLocalSource(dir)
+	require.NoError(t, source.MarkCompleted(context.Background(), "customer_id=123/dataset=users/year=2025/month=01/users.csv"))
+
+	store := openSQLite(t)
+	stop := watch(t, store, dir, jobs.WatcherConfig{PollInterval: 10 * time.Millisecond})
+	want := []string{
+		"customer_id=123/dataset=orders/year=2025/month=01/orders.csv",
+		"customer_id=123/dataset=users/year=2025/month=02/users.csv",
+	}
+	require.Eventually(t, func() bool {
+		return slices.Equal(jobFiles(t, store), want)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Jobs mark their file completed, and a later file is picked up.
+	require.Eventually(t, func() bool {
+		completed, err := source.Completed(context.Background(), want[0])
+		return err == nil && completed
+	}, 5*time.Second, 10*time.Millisecond)
+	writeFile(t, dir, "customer_id=123/dataset=users/year=2025/month=03/users.csv", "id\n1\n")
+	require.Eventually(t, func() bool {
+		return len(jobFiles(t, store)) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stop()
+	assert.Len(t, jobFiles(t, store), 3)
+}
+
+func TestWatcher_WaitsForStableFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "customer_id=123/dataset=orders/year=2025/month=01/orders.csv", "id\n1\n")
+
+	store := openSQLite(t)
+	stop := watch(t, store, dir, jobs.WatcherConfig{PollInterval: 10 * time.Millisecond, StableFor: time.Hour})
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	assert.Empty(t, jobFiles(t, store))
+}
+
+func TestWatcher_SkipsFilesWithJobs(t *testing.T) {
+	dir := t.TempDir()
+	canceled := "customer_id=123/dataset=orders/year=2025/month=01/orders.csv"
+	writeFile(t, dir, canceled, "id\n1\n")
+	writeFile(t, dir, "customer_id=123/dataset=orders/"+dataset.ManifestName,
+		`{"customer_id":"123","dataset":"orders","year":2025,"month":1,"path":"year=2025/month=01/orders.csv"}`)
+	failed := "customer_id=123/dataset=users/year=2025/month=01/users.csv"
+	writeFile(t, dir, failed, "id\n1\n")
+
+	// Jobs left by a previous process, which never completed their file.
+	ctx := context.Background()
+	store := openSQLite(t)
+	job, err := store.Create(ctx, jobs.Job{CustomerID: "123", Dataset: "orders", Period: "2025-01", FilePath: canceled})
+	require.NoError(t, err)
+	require.NoError(t, store.Cancel(ctx, job.ID))
+	job, err = store.Create(ctx, jobs.Job{CustomerID: "123", Dataset: "users", Period: "2025-01", FilePath: failed})
+	require.NoError(t, err)
+	lease, err := store.Claim(ctx, job.ID, "pod-b")
+	require.NoError(t, err)
+	require.NoError(t, store.Fail(ctx, lease, "broker unavailable"))
+
+	stop := watch(t, store, dir, jobs.WatcherConfig{PollInterval: 10 * time.Millisecond})
+	fresh := "customer_id=123/dataset=users/year=2025/month=02/users.csv"
+	writeFile(t, dir, fresh, "id\n1\n")
+	require.Eventually(t, func() bool {
+		return slices.Contains(jobFiles(t, store), fresh)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stop()
+	assert.Equal(t, []string{canceled, failed, fresh}, jobFiles(t, store))
+}
@@ -0,0 +1,224 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/breaker"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/spool"
+)
+
+// CircuitBreakerProducer protects a Producer with a circuit breaker. While
+// the breaker is open, events are written to a local disk spool instead of
+// waiting on an unavailable Kafka; once a half-open probe succeeds the spool
+// is drained back through the wrapped producer in the background. Replaying
+// the spool is a probe too, tried every OpenTimeout, so that the spool
+// drains even when no new events come in.
+//
+// It writes batches with PublishAll when the wrapped producer is a
+// BulkPublisher. It cannot take part in transactions: a batch spooled
+// would be published without its checkpoint.
+//
+// Spooled events are replayed after newer events may already have been
+// published, so per-key ordering is not preserved across an outage.
+type CircuitBreakerProducer struct {
+	next    Producer
+	spool   *spool.Spool
+	breaker *breaker.Breaker
+	logger  *slog.Logger
+	metrics *metrics.Metrics
+
+	drainCh       chan struct{}
+	drainInterval time.Duration
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+const defaultDrainInterval = time.Second
+
+func NewCircuitBreakerProducer(next Producer, sp *spool.Spool, cfg breaker.Config, logger *slog.Logger, m *metrics.Metrics) *CircuitBreakerProducer {
+	p := &CircuitBreakerProducer{
+		next:          next,
+		spool:         sp,
+		logger:        logger,
+		metrics:       m,
+		drainCh:       make(chan struct{}, 1),
+		drainInterval: cfg.OpenTimeout,
+		stop:          make(chan struct{}),
+	}
+	if p.drainInterval <= 0 {
+		p.drainInterval = defaultDrainInterval
+	}
+
+	cfg.OnStateChange = p.onStateChange
+	p.breaker = breaker.New(cfg)
+	p.metrics.ProducerBreakerState.Set(float64(breaker.Closed))
+	p.metrics.SpoolSize.Set(float64(sp.Len()))
+
+	p.wg.Add(1)
+	go p.drainLoop()
+
+	// Events left over by a previous process are replayed right away.
+	if sp.Len() > 0 {
+		p.requestDrain()
+	}
+
+	return p
+}
+
+func (p *CircuitBreakerProducer) Publish(ctx context.Context, event model.Event) error {
+	ticket, ok := p.breaker.Allow()
+	if !ok {
+		return p.spoolEvent(ctx, event)
+	}
+
+	if err := p.next.Publish(ctx, event); err != nil {
+		ticket.Failure()
+		p.logger.Warn("Publish failed, spooling event", "event_id", event.ID, "error", err)
+		return p.spoolEvent(ctx, event)
+	}
+
+	ticket.Success()
+	return nil
+}
+
+// PublishAll writes events together when the wrapped producer is a
+// BulkPublisher. A failed write spools every event of the batch, the ones
+// Kafka may have taken included, so they are delivered at least once.
+func (p *CircuitBreakerProducer) PublishAll(ctx context.Context, events []model.Event) error {
+	bulk, ok := p.next.(BulkPublisher)
+	if !ok {
+		for _, event := range events {
+			if err := p.Publish(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ticket, ok := p.breaker.Allow()
+	if !ok {
+		return p.spoolEvents(ctx, events)
+	}
+	if err := bulk.PublishAll(ctx, events); err != nil {
+		ticket.Failure()
+		p.logger.Warn("Publish failed, spooling events", "events", len(events), "error", err)
+		return p.spoolEvents(ctx, events)
+	}
+	ticket.Success()
+	return nil
+}
+
+func (p *CircuitBreakerProducer) spoolEvents(ctx context.Context, events []model.Event) error {
+	for _, event := range events {
+		if err := p.spoolEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *CircuitBreakerProducer) spoolEvent(ctx context.Context, event model.Event) error {
+	if err := p.spool.Append(ctx, event); err != nil {
+		return fmt.Errorf("failed to spool event: %w", err)
+	}
+	p.metrics.EventsSpooled.Inc()
+	p.metrics.SpoolSize.Set(float64(p.spool.Len()))
+	return nil
+}
+
+func (p *CircuitBreakerProducer) onStateChange(from, to breaker.State) {
+	p.metrics.ProducerBreakerState.Set(float64(to))
+	p.logger.Warn("Producer circuit breaker state changed", "from", from.String(), "to", to.String())
+
+	if to == breaker.Closed {
+		p.requestDrain()
+	}
+}
+
+func (p *CircuitBreakerProducer) requestDrain() {
+	select {
+	case p.drainCh <- struct{}{}:
+	default:
+	}
+}
+
+// drainLoop drains the spool when asked to, and every drainInterval while
+// it holds events.
+func (p *CircuitBreakerProducer) drainLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.drainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-p.drainCh:
+		case <-ticker.C:
+			if p.spool.Len() == 0 {
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-p.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		corrupt := p.spool.Corrupt()
+		drained, err := p.spool.Drain(ctx, p.replay)
+		cancel()
+
+		p.metrics.SpoolSize.Set(float64(p.spool.Len()))
+		if corrupt := p.spool.Corrupt() - corrupt; corrupt > 0 {
+			p.metrics.SpoolCorrupt.Add(float64(corrupt))
+			p.logger.Error("Moved undecodable spooled events aside", "events", corrupt)
+		}
+		if err != nil {
+			p.logger.Warn("Spool drain interrupted", "drained", drained, "remaining", p.spool.Len(), "error", err)
+			continue
+		}
+		if drained > 0 {
+			p.logger.Info("Spool drained", "events", drained)
+		}
+	}
+}
+
+// replay publishes a spooled event. It feeds the breaker too, so a relapse
+// of the outage stops the drain and opens the breaker again, and the first
+// event replayed once the breaker half-opens is its probe.
+func (p *CircuitBreakerProducer) replay(ctx context.Context, event model.Event) error {
+	ticket, ok := p.breaker.Allow()
+	if !ok {
+		return fmt.Errorf("circuit breaker is %s", p.breaker.State())
+	}
+	if err := p.next.Publish(ctx, event); err != nil {
+		ticket.Failure()
+		return err
+	}
+	ticket.Success()
+	p.metrics.SpoolDrained.Inc()
+	return nil
+}
+
+func (p *CircuitBreakerProducer) Close() error {
+	close(p.stop)
+	p.wg.Wait()
+
+	err := p.spool.Close()
+	if nextErr := p.next.Close(); nextErr != nil {
+		return nextErr
+	}
+	return err
+}
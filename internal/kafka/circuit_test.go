@@ -0,0 +1,133 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/breaker"
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/spool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyProducer fails every publish while down is set.
+type flakyProducer struct {
+	mu        sync.Mutex
+	down      bool
+	calls     int
+	published []string
+}
+
+func (f *flakyProducer) Publish(ctx context.Context, event model.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.down {
+		return errors.New("kafka unavailable")
+	}
+	f.published = append(f.published, event.ID)
+	return nil
+}
+
+func (f *flakyProducer) Close() error { return nil }
+
+func (f *flakyProducer) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *flakyProducer) snapshot() (int, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls, append([]string(nil), f.published...)
+}
+
+func TestCircuitBreakerProducer_SpoolsAndDrains(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	next := &flakyProducer{down: true}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	producer := kafka.NewCircuitBreakerProducer(next, sp, breaker.Config{
+		FailureRatio: 0.5,
+		MinRequests:  2,
+		Window:       time.Minute,
+		OpenTimeout:  50 * time.Millisecond,
+	}, logger, metrics.New())
+	defer producer.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, producer.Publish(ctx, model.Event{ID: fmt.Sprintf("evt-%d", i)}))
+	}
+
+	calls, _ := next.snapshot()
+	assert.Equal(t, 2, calls, "once open, publishes go straight to the spool")
+	assert.Equal(t, 10, sp.Len())
+
+	// With no new events coming in, replaying the spool probes the breaker
+	// once the open timeout elapses; its success closes the breaker and the
+	// rest of the spool follows.
+	next.setDown(false)
+	require.Eventually(t, func() bool { return sp.Len() == 0 }, 2*time.Second, 10*time.Millisecond)
+
+	_, published := next.snapshot()
+	var expected []string
+	for i := 0; i < 10; i++ {
+		expected = append(expected, fmt.Sprintf("evt-%d", i))
+	}
+	assert.Equal(t, expected, published)
+}
+
+// bulkFlakyProducer is a flakyProducer writing batches in one call.
+type bulkFlakyProducer struct {
+	flakyProducer
+}
+
+func (b *bulkFlakyProducer) PublishAll(ctx context.Context, events []model.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	if b.down {
+		return errors.New("kafka unavailable")
+	}
+	for _, event := range events {
+		b.published = append(b.published, event.ID)
+	}
+	return nil
+}
+
+func TestCircuitBreakerProducer_PublishAll(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	next := &bulkFlakyProducer{flakyProducer{down: true}}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	producer := kafka.NewCircuitBreakerProducer(next, sp, breaker.Config{
+		FailureThreshold: 1,
+		OpenTimeout:      time.Hour,
+	}, logger, metrics.New())
+	defer producer.Close()
+
+	var bulk kafka.Producer = producer
+	require.Implements(t, (*kafka.BulkPublisher)(nil), bulk)
+
+	ctx := context.Background()
+	batch := []model.Event{{ID: "evt-0"}, {ID: "evt-1"}, {ID: "evt-2"}}
+	require.NoError(t, producer.PublishAll(ctx, batch))
+	require.NoError(t, producer.PublishAll(ctx, batch))
+
+	calls, _ := next.snapshot()
+	assert.Equal(t, 1, calls, "one failed write opens the breaker")
+	assert.Equal(t, 6, sp.Len())
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	consumerRetryBackoff    = time.Second
+	consumerMaxRetryBackoff = 30 * time.Second
+)
+
+// Consumer reads the messages of a topic as a member of a consumer group.
+type Consumer struct {
+	reader *kafka.Reader
+	logger *slog.Logger
+}
+
+func NewConsumer(brokers []string, topic, groupID string, logger *slog.Logger) *Consumer {
+	return &Consumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: groupID,
+		}),
+		logger: logger,
+	}
+}
+
+// Run hands every message to handle, in order, until ctx is done. A message
+// is committed once handled; one that fails is handled again, with a
+// growing backoff, rather than skipped. Failures to fetch or commit are
+// retried the same way, so Run only returns once ctx is done.
+func (c *Consumer) Run(ctx context.Context, handle func(ctx context.Context, value []byte) error) error {
+	backoff := consumerRetryBackoff
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			c.logger.Error("Failed to fetch message, retrying", "backoff", backoff, "error", err)
+			if !sleep(ctx, &backoff) {
+				return nil
+			}
+			continue
+		}
+
+		backoff = consumerRetryBackoff
+		for {
+			err := handle(ctx, msg.Value)
+			if err == nil {
+				break
+			}
+			c.logger.Error("Failed to handle message, retrying", "topic", msg.Topic, "partition", msg.Partition,
+				"offset", msg.Offset, "backoff", backoff, "error", err)
+			if !sleep(ctx, &backoff) {
+				return nil
+			}
+		}
+
+		backoff = consumerRetryBackoff
+		for {
+			err := c.reader.CommitMessages(ctx, msg)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == nil {
+				break
+			}
+			c.logger.Error("Failed to commit message, retrying", "topic", msg.Topic, "partition", msg.Partition,
+				"offset", msg.Offset, "backoff", backoff, "error", err)
+			if !sleep(ctx, &backoff) {
+				return nil
+			}
+		}
+		backoff = consumerRetryBackoff
+	}
+}
+
+// sleep waits for backoff, which it then doubles up to
+// consumerMaxRetryBackoff, and reports false if ctx is done first.
+func sleep(ctx context.Context, backoff *time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(*backoff):
+	}
+	*backoff = min(*backoff*2, consumerMaxRetryBackoff)
+	return true
+}
+
+func (c *Consumer) Close() error {
+	return c.reader.Close()
+}
@@ -2,11 +2,19 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/raphaelreis/go-event-ingestor/internal/breaker"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
 	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/serde"
+	"github.com/raphaelreis/go-event-ingestor/internal/tracing"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -15,12 +23,30 @@ type Producer interface {
 	Close() error
 }
 
-type KafkaProducer struct {
+// BulkPublisher is implemented by producers that can write several events
+// in one request. Events that could not be written are handled as Publish
+// would handle them one by one.
+type BulkPublisher interface {
+	PublishAll(ctx context.Context, events []model.Event) error
+}
+
+const (
+	primaryCluster   = "primary"
+	secondaryCluster = "secondary"
+
+	defaultProbeInterval = 30 * time.Second
+)
+
+// cluster holds the writers for the main topic and the DLQ of one Kafka
+// cluster, so that a failover moves both together.
+type cluster struct {
+	name      string
+	brokers   []string
 	writer    *kafka.Writer
 	dlqWriter *kafka.Writer
 }
 
-func NewProducer(brokers []string, topic, dlqTopic string, timeout time.Duration) *KafkaProducer {
+func newCluster(name string, brokers []string, topic, dlqTopic string, timeout time.Duration) *cluster {
 	w := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
 		Topic:        topic,
@@ -40,52 +66,306 @@ func NewProducer(brokers []string, topic, dlqTopic string, timeout time.Duration
 		Async:        false,
 	}
 
-	return &KafkaProducer{
-		writer:    w,
-		dlqWriter: dlq,
+	return &cluster{name: name, brokers: brokers, writer: w, dlqWriter: dlq}
+}
+
+func (c *cluster) close() error {
+	err1 := c.writer.Close()
+	err2 := c.dlqWriter.Close()
+
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+type KafkaProducer struct {
+	primary    *cluster
+	secondary  *cluster
+	serializer serde.Serializer
+
+	failover FailoverConfig
+	breaker  *breaker.Breaker
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// FailoverConfig enables writing to a secondary cluster while the primary
+// one is unavailable.
+type FailoverConfig struct {
+	SecondaryBrokers []string
+	// FailureThreshold is the number of consecutive failed writes to the
+	// primary cluster after which writes move to the secondary one.
+	FailureThreshold int
+	// ProbeInterval is how often the primary cluster is probed while
+	// failed over, and how long to wait before the first probe.
+	ProbeInterval time.Duration
+	Metrics       *metrics.Metrics
+	Logger        *slog.Logger
+}
+
+// Option customises a KafkaProducer built by NewProducer.
+type Option func(*KafkaProducer)
+
+// WithSerializer replaces the default JSON encoding of event values.
+func WithSerializer(s serde.Serializer) Option {
+	return func(p *KafkaProducer) {
+		p.serializer = s
+	}
+}
+
+// WithFailover adds a secondary cluster that receives main and DLQ writes
+// once the primary cluster keeps failing. It is ignored when cfg has no
+// secondary brokers.
+func WithFailover(cfg FailoverConfig) Option {
+	return func(p *KafkaProducer) {
+		p.failover = cfg
+	}
+}
+
+func NewProducer(brokers []string, topic, dlqTopic string, timeout time.Duration, opts ...Option) *KafkaProducer {
+	p := &KafkaProducer{
+		primary:    newCluster(primaryCluster, brokers, topic, dlqTopic, timeout),
+		serializer: serde.JSONSerializer{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if len(p.failover.SecondaryBrokers) > 0 {
+		if p.failover.ProbeInterval <= 0 {
+			p.failover.ProbeInterval = defaultProbeInterval
+		}
+		p.secondary = newCluster(secondaryCluster, p.failover.SecondaryBrokers, topic, dlqTopic, timeout)
+		p.breaker = breaker.New(breaker.Config{
+			FailureThreshold: p.failover.FailureThreshold,
+			OpenTimeout:      p.failover.ProbeInterval,
+			OnStateChange:    p.onBreakerChange,
+		})
+		p.setActive(p.primary)
+
+		p.stop = make(chan struct{})
+		p.wg.Add(1)
+		go p.probeLoop()
 	}
+
+	return p
 }
 
 func (p *KafkaProducer) Publish(ctx context.Context, event model.Event) error {
-	payload, err := json.Marshal(event)
+	return p.PublishAll(ctx, []model.Event{event})
+}
+
+// PublishAll writes events in one request. Events the active cluster did not
+// accept go to the secondary cluster when failing over, or to the DLQ.
+func (p *KafkaProducer) PublishAll(ctx context.Context, events []model.Event) error {
+	msgs := make([]kafka.Message, len(events))
+	for i, event := range events {
+		payload, err := p.serializer.Serialize(event)
+		if err != nil {
+			return err
+		}
+		msgs[i] = kafka.Message{
+			Key:     messageKey(event),
+			Value:   payload,
+			Headers: eventHeaders(ctx, event),
+		}
+	}
+
+	active := p.active()
+	var ticket breaker.Ticket
+	if active == p.primary && p.breaker != nil {
+		ticket, _ = p.breaker.Allow()
+	}
+	err := active.writer.WriteMessages(ctx, msgs...)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		ticket.Failure()
+	} else {
+		ticket.Success()
 	}
+	if err == nil {
+		return nil
+	}
+	errs := messageErrors(err, len(msgs))
 
-	msg := kafka.Message{
-		Key:   []byte(event.ID),
-		Value: payload,
-		Headers: []kafka.Header{
-			{Key: "trace_id", Value: []byte(event.ID)},
-		},
+	// A failing primary usually means the whole cluster is unhealthy, DLQ
+	// included, so the events go to the secondary cluster instead.
+	if active == p.primary && p.secondary != nil {
+		var retry []kafka.Message
+		for i, msg := range msgs {
+			if errs[i] != nil {
+				retry = append(retry, msg)
+			}
+		}
+		secondaryErr := p.secondary.writer.WriteMessages(ctx, retry...)
+		if secondaryErr == nil {
+			return nil
+		}
+		// The events left go to the DLQ of the secondary, with its errors.
+		msgs, errs = retry, messageErrors(secondaryErr, len(retry))
+		active = p.secondary
 	}
 
-	err = p.writer.WriteMessages(ctx, msg)
-	if err != nil {
-		return p.sendToDLQ(ctx, msg, err)
+	var dlqErrs []error
+	for i, msg := range msgs {
+		if errs[i] == nil {
+			continue
+		}
+		if err := p.sendToDLQ(ctx, active, msg, errs[i]); err != nil {
+			dlqErrs = append(dlqErrs, err)
+		}
 	}
+	return errors.Join(dlqErrs...)
+}
 
-	return nil
+// messageErrors returns the error of each of the n messages of a failed
+// write. Only a kafka.WriteErrors tells them apart; any other error failed
+// them all.
+func messageErrors(err error, n int) []error {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) && len(writeErrs) == n {
+		return writeErrs
+	}
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// eventHeaders propagates the trace context of ctx as W3C headers, starting
+// a new trace for events that arrive without one, followed by the headers of
+// the event itself, each in a fixed order. trace_id is kept for consumers
+// that only look at the plain trace ID.
+func eventHeaders(ctx context.Context, event model.Event) []kafka.Header {
+	tc := tracing.FromContextOrNew(ctx)
+	headers := []kafka.Header{{Key: "trace_id", Value: []byte(tc.TraceID)}}
+	trace := tc.Headers()
+	for _, key := range []string{tracing.TraceParentHeader, tracing.TraceStateHeader, tracing.BaggageHeader} {
+		if value, ok := trace[key]; ok {
+			headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(event.Headers)) {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(event.Headers[key])})
+	}
+	return headers
+}
+
+func messageKey(event model.Event) []byte {
+	if event.Key != "" {
+		return []byte(event.Key)
+	}
+	return []byte(event.ID)
 }
 
-func (p *KafkaProducer) sendToDLQ(ctx context.Context, msg kafka.Message, originalErr error) error {
+// active returns the cluster that currently receives writes.
+func (p *KafkaProducer) active() *cluster {
+	if p.breaker == nil || p.breaker.State() == breaker.Closed {
+		return p.primary
+	}
+	return p.secondary
+}
+
+func (p *KafkaProducer) sendToDLQ(ctx context.Context, c *cluster, msg kafka.Message, originalErr error) error {
 	msg.Headers = append(msg.Headers, kafka.Header{
 		Key:   "error",
 		Value: []byte(originalErr.Error()),
 	})
 
-	if err := p.dlqWriter.WriteMessages(ctx, msg); err != nil {
+	if err := c.dlqWriter.WriteMessages(ctx, msg); err != nil {
 		return fmt.Errorf("failed to send to DLQ (original error: %v): %w", originalErr, err)
 	}
 	return nil
 }
 
+// probeLoop checks the primary cluster while writes are failed over, and
+// fails back as soon as it answers a metadata request for the main topic.
+func (p *KafkaProducer) probeLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.failover.ProbeInterval)
+	defer ticker.Stop()
+
+	client := &kafka.Client{Addr: kafka.TCP(p.primary.brokers...), Timeout: p.primary.writer.WriteTimeout}
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if p.breaker.State() == breaker.Closed {
+			continue
+		}
+		ticket, ok := p.breaker.Allow()
+		if !ok {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.primary.writer.WriteTimeout)
+		resp, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{p.primary.writer.Topic}})
+		cancel()
+
+		if err == nil && len(resp.Topics) == 1 && resp.Topics[0].Error == nil {
+			ticket.Success()
+		} else {
+			ticket.Failure()
+		}
+	}
+}
+
+func (p *KafkaProducer) onBreakerChange(from, to breaker.State) {
+	switch {
+	case to == breaker.Open && from == breaker.Closed:
+		p.setActive(p.secondary)
+		p.countSwitch(p.secondary)
+		p.log("Failing over to secondary Kafka cluster", "brokers", p.secondary.brokers)
+	case to == breaker.Closed:
+		p.setActive(p.primary)
+		p.countSwitch(p.primary)
+		p.log("Failing back to primary Kafka cluster", "brokers", p.primary.brokers)
+	}
+}
+
+func (p *KafkaProducer) setActive(active *cluster) {
+	m := p.failover.Metrics
+	if m == nil {
+		return
+	}
+	for _, c := range []*cluster{p.primary, p.secondary} {
+		value := 0.0
+		if c == active {
+			value = 1
+		}
+		m.KafkaActiveCluster.WithLabelValues(c.name).Set(value)
+	}
+}
+
+func (p *KafkaProducer) countSwitch(to *cluster) {
+	if m := p.failover.Metrics; m != nil {
+		m.KafkaFailovers.WithLabelValues(to.name).Inc()
+	}
+}
+
+func (p *KafkaProducer) log(msg string, args ...any) {
+	if p.failover.Logger != nil {
+		p.failover.Logger.Warn(msg, args...)
+	}
+}
+
 func (p *KafkaProducer) Close() error {
-	err1 := p.writer.Close()
-	err2 := p.dlqWriter.Close()
+	if p.stop != nil {
+		close(p.stop)
+		p.wg.Wait()
+	}
 
-	if err1 != nil {
-		return err1
+	err := p.primary.close()
+	if p.secondary != nil {
+		if err2 := p.secondary.close(); err == nil {
+			err = err2
+		}
 	}
-	return err2
+	return err
 }
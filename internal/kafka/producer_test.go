@@ -0,0 +1,25 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventHeaders_Order(t *testing.T) {
+	tc := tracing.New()
+	tc.TraceState, tc.Baggage = "vendor=1", "tenant=acme"
+	ctx := tracing.ContextWith(context.Background(), tc)
+	event := model.Event{Headers: map[string]string{"job_id": "j1", "dataset": "orders"}}
+
+	for i := 0; i < 10; i++ {
+		var keys []string
+		for _, header := range eventHeaders(ctx, event) {
+			keys = append(keys, header.Key)
+		}
+		assert.Equal(t, []string{"trace_id", "traceparent", "tracestate", "baggage", "dataset", "job_id"}, keys)
+	}
+}
@@ -0,0 +1,297 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/serde"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Checkpoint records how far a source has been consumed. It is written in the
+// same transaction as the events it covers, so a committed checkpoint always
+// matches the events visible to read_committed consumers.
+type Checkpoint struct {
+	Source string `json:"source"`
+	Offset int64  `json:"offset"`
+	// Completed is set by the checkpoint ending the source.
+	Completed bool `json:"completed,omitempty"`
+}
+
+// Batch is a group of events published atomically together with the
+// checkpoint reached after them.
+type Batch struct {
+	Events     []model.Event
+	Checkpoint Checkpoint
+}
+
+// BatchPublisher is implemented by producers that can publish a Batch
+// atomically and report the last committed checkpoint for a source, the
+// zero Checkpoint when there is none.
+type BatchPublisher interface {
+	PublishBatch(ctx context.Context, batch Batch) error
+	LastCheckpoint(ctx context.Context, source string) (Checkpoint, error)
+}
+
+// TransactionalProducer publishes through an idempotent, transactional Kafka
+// client. Every call commits or aborts a whole transaction, so consumers
+// reading with isolation.level=read_committed never observe a partial batch.
+//
+// There is no DLQ in this mode: a failed batch is aborted and the error is
+// returned so the caller can retry from the last committed checkpoint.
+type TransactionalProducer struct {
+	client          *kgo.Client
+	brokers         []string
+	topic           string
+	checkpointTopic string
+	timeout         time.Duration
+	serializer      serde.Serializer
+	mu              sync.Mutex
+
+	// checkpoints holds the last committed checkpoint of each source found
+	// in the checkpoint topic up to scanned.
+	checkpointsMu sync.Mutex
+	checkpoints   map[string]Checkpoint
+	scanned       int64
+}
+
+// NewTransactionalProducer connects with the given transactional ID. A nil
+// serializer encodes events as JSON.
+func NewTransactionalProducer(brokers []string, topic, checkpointTopic, transactionalID string, timeout time.Duration, serializer serde.Serializer) (*TransactionalProducer, error) {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.TransactionalID(transactionalID),
+		kgo.TransactionTimeout(timeout*6),
+		kgo.ProduceRequestTimeout(timeout),
+		kgo.RecordPartitioner(checkpointPartitioner{topic: checkpointTopic, events: kgo.StickyKeyPartitioner(nil)}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transactional client: %w", err)
+	}
+	if serializer == nil {
+		serializer = serde.JSONSerializer{}
+	}
+
+	return &TransactionalProducer{
+		client:          client,
+		brokers:         brokers,
+		topic:           topic,
+		checkpointTopic: checkpointTopic,
+		timeout:         timeout,
+		serializer:      serializer,
+		checkpoints:     make(map[string]Checkpoint),
+	}, nil
+}
+
+// checkpointPartitioner writes checkpoints to partition 0 of their topic,
+// the one LastCheckpoint reads, and events by key.
+type checkpointPartitioner struct {
+	topic  string
+	events kgo.Partitioner
+}
+
+func (c checkpointPartitioner) ForTopic(topic string) kgo.TopicPartitioner {
+	if topic == c.topic {
+		return kgo.ManualPartitioner().ForTopic(topic)
+	}
+	return c.events.ForTopic(topic)
+}
+
+func (p *TransactionalProducer) Publish(ctx context.Context, event model.Event) error {
+	record, err := p.record(ctx, event)
+	if err != nil {
+		return err
+	}
+	return p.commit(ctx, []*kgo.Record{record})
+}
+
+// PublishBatch writes the batch events and its checkpoint in one
+// transaction. Batches are serialised: a transactional ID can only have one
+// open transaction at a time.
+func (p *TransactionalProducer) PublishBatch(ctx context.Context, batch Batch) error {
+	records := make([]*kgo.Record, 0, len(batch.Events)+1)
+	for _, event := range batch.Events {
+		record, err := p.record(ctx, event)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+
+	checkpoint, err := json.Marshal(batch.Checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	records = append(records, &kgo.Record{
+		Topic:     p.checkpointTopic,
+		Partition: 0,
+		Key:       []byte(batch.Checkpoint.Source),
+		Value:     checkpoint,
+	})
+
+	return p.commit(ctx, records)
+}
+
+func (p *TransactionalProducer) commit(ctx context.Context, records []*kgo.Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.client.BeginTransaction(); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := p.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return p.abort(fmt.Errorf("failed to produce transactional records: %w", err))
+	}
+
+	// EndTransaction must not be interrupted half way, so it gets its own
+	// deadline instead of the caller's context.
+	endCtx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	if err := p.client.EndTransaction(endCtx, kgo.TryCommit); err != nil {
+		if errors.Is(err, kerr.OperationNotAttempted) || errors.Is(err, kerr.TransactionAbortable) {
+			return p.abort(fmt.Errorf("failed to commit transaction: %w", err))
+		}
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (p *TransactionalProducer) abort(cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	if err := p.client.AbortBufferedRecords(ctx); err != nil {
+		return fmt.Errorf("failed to abort buffered records (original error: %v): %w", cause, err)
+	}
+	if err := p.client.EndTransaction(ctx, kgo.TryAbort); err != nil {
+		return fmt.Errorf("failed to abort transaction (original error: %v): %w", cause, err)
+	}
+	return cause
+}
+
+// LastCheckpoint returns the last committed checkpoint for source, or the
+// zero Checkpoint if none exists. It reads the checkpoint topic up to its
+// last stable offset, so checkpoints of aborted or still open transactions
+// are never returned. The checkpoints read are kept, so that later calls
+// only read what was committed since.
+func (p *TransactionalProducer) LastCheckpoint(ctx context.Context, source string) (Checkpoint, error) {
+	p.checkpointsMu.Lock()
+	defer p.checkpointsMu.Unlock()
+
+	end, err := p.lastStableOffset(ctx)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if end > p.scanned {
+		if err := p.scanCheckpoints(ctx, end); err != nil {
+			return Checkpoint{}, err
+		}
+	}
+	return p.checkpoints[source], nil
+}
+
+// scanCheckpoints reads the checkpoint topic from where the previous scan
+// stopped up to end. p.checkpointsMu must be held.
+func (p *TransactionalProducer) scanCheckpoints(ctx context.Context, end int64) error {
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(p.brokers...),
+		kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{
+			p.checkpointTopic: {0: kgo.NewOffset().At(p.scanned)},
+		}),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		// Transaction markers are kept so that the read position can be
+		// compared against the last stable offset, which always points
+		// past the marker of the last finished transaction.
+		kgo.KeepControlRecords(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint reader: %w", err)
+	}
+	defer consumer.Close()
+
+	for {
+		fetches := consumer.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if errs := fetches.Errors(); len(errs) > 0 {
+			return fmt.Errorf("failed to read checkpoints: %w", errs[0].Err)
+		}
+
+		done := false
+		fetches.EachRecord(func(r *kgo.Record) {
+			if r.Offset >= end-1 {
+				done = true
+			}
+			if r.Attrs.IsControl() {
+				return
+			}
+			var cp Checkpoint
+			if err := json.Unmarshal(r.Value, &cp); err == nil {
+				p.checkpoints[string(r.Key)] = cp
+			}
+		})
+		if done {
+			p.scanned = end
+			return nil
+		}
+	}
+}
+
+func (p *TransactionalProducer) lastStableOffset(ctx context.Context) (int64, error) {
+	req := kmsg.NewPtrListOffsetsRequest()
+	req.IsolationLevel = 1 // read_committed
+	topic := kmsg.NewListOffsetsRequestTopic()
+	topic.Topic = p.checkpointTopic
+	partition := kmsg.NewListOffsetsRequestTopicPartition()
+	partition.Partition = 0
+	partition.Timestamp = -1 // latest
+	topic.Partitions = append(topic.Partitions, partition)
+	req.Topics = append(req.Topics, topic)
+
+	resp, err := req.RequestWith(ctx, p.client)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list checkpoint offsets: %w", err)
+	}
+	if len(resp.Topics) != 1 || len(resp.Topics[0].Partitions) != 1 {
+		return 0, fmt.Errorf("unexpected list offsets response for topic %s", p.checkpointTopic)
+	}
+	part := resp.Topics[0].Partitions[0]
+	if err := kerr.ErrorForCode(part.ErrorCode); err != nil {
+		return 0, fmt.Errorf("failed to list checkpoint offsets: %w", err)
+	}
+	return part.Offset, nil
+}
+
+func (p *TransactionalProducer) record(ctx context.Context, event model.Event) (*kgo.Record, error) {
+	payload, err := p.serializer.Serialize(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []kgo.RecordHeader
+	for _, h := range eventHeaders(ctx, event) {
+		headers = append(headers, kgo.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+
+	return &kgo.Record{
+		Topic:   p.topic,
+		Key:     messageKey(event),
+		Value:   payload,
+		Headers: headers,
+	}, nil
+}
+
+func (p *TransactionalProducer) Close() error {
+	p.client.Close()
+	return nil
+}
@@ -14,8 +14,36 @@ type Metrics struct {
 	IngestQueueSize prometheus.Gauge
 	IngestLatency   prometheus.Histogram
 	HTTPRequests    *prometheus.CounterVec
+
+	KafkaActiveCluster *prometheus.GaugeVec
+	KafkaFailovers     *prometheus.CounterVec
+
+	ProducerBreakerState prometheus.Gauge
+	EventsSpooled        prometheus.Counter
+	SpoolDrained         prometheus.Counter
+	SpoolCorrupt         prometheus.Counter
+	SpoolSize            prometheus.Gauge
+
+	CSVRowsRejected prometheus.Counter
+
+	BulkRowsRead      *prometheus.CounterVec
+	BulkRowsPublished *prometheus.CounterVec
+	BulkRowsRejected  *prometheus.CounterVec
+	CSVParsingErrors  *prometheus.CounterVec
+	BulkBytesRead     *prometheus.CounterVec
+	BulkOffsetRows    *prometheus.GaugeVec
+	BulkOffsetBytes   *prometheus.GaugeVec
+	BulkRunDuration   *prometheus.GaugeVec
+	BulkRunCompletion *prometheus.HistogramVec
+
+	datasetsMu sync.Mutex
+	datasets   map[string]bool
 }
 
+// maxDatasetLabels bounds the datasets the bulk series are labeled with;
+// further ones share the "other" label.
+const maxDatasetLabels = 100
+
 var (
 	once     sync.Once
 	instance *Metrics
@@ -49,7 +77,122 @@ func New() *Metrics {
 				Name: "http_requests_total",
 				Help: "Total HTTP requests by status code",
 			}, []string{"status"}),
+			KafkaActiveCluster: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_active_cluster",
+				Help: "Kafka cluster currently receiving writes (1 = active)",
+			}, []string{"cluster"}),
+			KafkaFailovers: promauto.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_cluster_switches_total",
+				Help: "Total number of switches of the active Kafka cluster, by target cluster",
+			}, []string{"cluster"}),
+			ProducerBreakerState: promauto.NewGauge(prometheus.GaugeOpts{
+				Name: "producer_circuit_breaker_state",
+				Help: "State of the producer circuit breaker (0 = closed, 1 = open, 2 = half-open)",
+			}),
+			EventsSpooled: promauto.NewCounter(prometheus.CounterOpts{
+				Name: "events_spooled_total",
+				Help: "Total number of events written to the local spool instead of Kafka",
+			}),
+			SpoolDrained: promauto.NewCounter(prometheus.CounterOpts{
+				Name: "spool_drained_total",
+				Help: "Total number of spooled events published to Kafka after recovery",
+			}),
+			SpoolCorrupt: promauto.NewCounter(prometheus.CounterOpts{
+				Name: "spool_corrupt_total",
+				Help: "Total number of undecodable spooled events moved aside instead of published",
+			}),
+			SpoolSize: promauto.NewGauge(prometheus.GaugeOpts{
+				Name: "spool_size",
+				Help: "Current number of events waiting in the local spool",
+			}),
+			CSVRowsRejected: promauto.NewCounter(prometheus.CounterOpts{
+				Name: "csv_rows_rejected_total",
+				Help: "Total number of CSV rows rejected by schema validation",
+			}),
+			BulkRowsRead: promauto.NewCounterVec(prometheus.CounterOpts{
+				Name: "bulk_rows_read_total",
+				Help: "Total number of rows read from bulk files, by dataset",
+			}, []string{"dataset"}),
+			BulkRowsPublished: promauto.NewCounterVec(prometheus.CounterOpts{
+				Name: "bulk_rows_published_total",
+				Help: "Total number of bulk rows published to Kafka, by dataset",
+			}, []string{"dataset"}),
+			BulkRowsRejected: promauto.NewCounterVec(prometheus.CounterOpts{
+				Name: "bulk_rows_rejected_total",
+				Help: "Total number of bulk rows rejected, by dataset and reason",
+			}, []string{"dataset", "reason"}),
+			CSVParsingErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+				Name: "csv_parsing_errors_total",
+				Help: "Total number of bulk rows that could not be parsed, by dataset",
+			}, []string{"dataset"}),
+			BulkBytesRead: promauto.NewCounterVec(prometheus.CounterOpts{
+				Name: "bulk_bytes_read_total",
+				Help: "Total number of bytes read from bulk files, by dataset",
+			}, []string{"dataset"}),
+			BulkOffsetRows: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "bulk_offset_rows",
+				Help: "Row of the last checkpoint of the latest bulk run, by dataset",
+			}, []string{"dataset"}),
+			BulkOffsetBytes: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "bulk_offset_bytes",
+				Help: "Byte offset of the last checkpoint of the latest bulk run, by dataset",
+			}, []string{"dataset"}),
+			BulkRunDuration: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "bulk_run_duration_seconds",
+				Help: "Time the latest bulk run has been going, or took, by dataset",
+			}, []string{"dataset"}),
+			BulkRunCompletion: promauto.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "bulk_run_completion_seconds",
+				Help:    "Duration of finished bulk runs, by dataset and status",
+				Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+			}, []string{"dataset", "status"}),
+			datasets: make(map[string]bool),
 		}
 	})
 	return instance
 }
+
+// Bulk is the set of bulk import series of one dataset.
+type Bulk struct {
+	RowsRead      prometheus.Counter
+	RowsPublished prometheus.Counter
+	// RowsRejected is labeled by reason.
+	RowsRejected *prometheus.CounterVec
+	ParseErrors  prometheus.Counter
+	BytesRead    prometheus.Counter
+	OffsetRows   prometheus.Gauge
+	OffsetBytes  prometheus.Gauge
+	Duration     prometheus.Gauge
+	// Completion is labeled by status.
+	Completion prometheus.ObserverVec
+}
+
+// Bulk returns the bulk import series of dataset. Datasets beyond the first
+// maxDatasetLabels share the "other" label, and an empty one is "unknown".
+func (m *Metrics) Bulk(dataset string) *Bulk {
+	label := m.datasetLabel(dataset)
+	return &Bulk{
+		RowsRead:      m.BulkRowsRead.WithLabelValues(label),
+		RowsPublished: m.BulkRowsPublished.WithLabelValues(label),
+		RowsRejected:  m.BulkRowsRejected.MustCurryWith(prometheus.Labels{"dataset": label}),
+		ParseErrors:   m.CSVParsingErrors.WithLabelValues(label),
+		BytesRead:     m.BulkBytesRead.WithLabelValues(label),
+		OffsetRows:    m.BulkOffsetRows.WithLabelValues(label),
+		OffsetBytes:   m.BulkOffsetBytes.WithLabelValues(label),
+		Duration:      m.BulkRunDuration.WithLabelValues(label),
+		Completion:    m.BulkRunCompletion.MustCurryWith(prometheus.Labels{"dataset": label}),
+	}
+}
+
+func (m *Metrics) datasetLabel(dataset string) string {
+	if dataset == "" {
+		return "unknown"
+	}
+	m.datasetsMu.Lock()
+	defer m.datasetsMu.Unlock()
+	if !m.datasets[dataset] && len(m.datasets) >= maxDatasetLabels {
+		return "other"
+	}
+	m.datasets[dataset] = true
+	return dataset
+}
@@ -7,4 +7,9 @@ type Event struct {
 	Type      string                 `json:"type"`
 	Timestamp time.Time              `json:"timestamp"`
 	Payload   map[string]interface{} `json:"payload"`
+
+	// Key overrides ID as the Kafka message key.
+	Key string `json:"-"`
+	// Headers are extra Kafka headers published with the event.
+	Headers map[string]string `json:"-"`
 }
@@ -1,6 +1,8 @@
 package rate
 
 import (
+	"context"
+
 	"golang.org/x/time/rate"
 )
 
@@ -21,3 +23,8 @@ func NewTokenLimiter(rps float64, burst int) *TokenLimiter {
 func (l *TokenLimiter) Allow() bool {
 	return l.limiter.Allow()
 }
+
+// Wait blocks until a token is available or ctx is done.
+func (l *TokenLimiter) Wait(ctx context.Context) error {
+	return l.limiter.Wait(ctx)
+}
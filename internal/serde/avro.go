@@ -0,0 +1,81 @@
+package serde
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hamba/avro/v2"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+)
+
+// EventAvroSchema is used when no custom schema is configured. The payload
+// is free form, so it travels as a JSON document.
+const EventAvroSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "ingestor.v1",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "type", "type": "string"},
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "payload", "type": "string"}
+  ]
+}`
+
+// AvroSerializer encodes events with an Avro record schema that has id, type,
+// timestamp and payload fields. A custom schema may declare payload as a
+// record or map to get typed values; a string payload holds JSON.
+type AvroSerializer struct {
+	schema        avro.Schema
+	id            int
+	payloadAsJSON bool
+}
+
+func NewAvroSerializer(ctx context.Context, registry Registry, subject, definition string) (*AvroSerializer, error) {
+	schema, err := avro.ParseWithCache(definition, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse avro schema: %w", err)
+	}
+
+	record, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("avro schema must be a record, got %s", schema.Type())
+	}
+
+	payloadAsJSON := false
+	for _, field := range record.Fields() {
+		if field.Name() == "payload" {
+			payloadAsJSON = field.Type().Type() == avro.String
+		}
+	}
+
+	id, err := registerSchema(ctx, registry, subject, Schema{Type: SchemaTypeAvro, Definition: definition})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AvroSerializer{schema: schema, id: id, payloadAsJSON: payloadAsJSON}, nil
+}
+
+func (s *AvroSerializer) Serialize(event model.Event) ([]byte, error) {
+	var payload interface{} = event.Payload
+	if s.payloadAsJSON {
+		data, err := json.Marshal(event.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		payload = string(data)
+	}
+
+	data, err := avro.Marshal(s.schema, map[string]interface{}{
+		"id":        event.ID,
+		"type":      event.Type,
+		"timestamp": event.Timestamp,
+		"payload":   payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode avro event: %w", err)
+	}
+	return frame(s.id, nil, data), nil
+}
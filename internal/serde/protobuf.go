@@ -0,0 +1,139 @@
+package serde
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EventProtoSchema is the schema registered for Protobuf events. It must stay
+// in sync with eventDescriptor.
+const EventProtoSchema = `syntax = "proto3";
+package ingestor.v1;
+
+import "google/protobuf/struct.proto";
+import "google/protobuf/timestamp.proto";
+
+message Event {
+  string id = 1;
+  string type = 2;
+  google.protobuf.Timestamp timestamp = 3;
+  google.protobuf.Struct payload = 4;
+}
+`
+
+// firstMessageIndex is the encoded message index path of the first message
+// in the schema, which the wire format shortens to a single zero byte.
+var firstMessageIndex = []byte{0}
+
+// ProtobufSerializer encodes events as ingestor.v1.Event messages.
+type ProtobufSerializer struct {
+	descriptor protoreflect.MessageDescriptor
+	id         int
+}
+
+func NewProtobufSerializer(ctx context.Context, registry Registry, subject string) (*ProtobufSerializer, error) {
+	descriptor, err := eventDescriptor()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := registerSchema(ctx, registry, subject, Schema{Type: SchemaTypeProtobuf, Definition: EventProtoSchema})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProtobufSerializer{descriptor: descriptor, id: id}, nil
+}
+
+func (s *ProtobufSerializer) Serialize(event model.Event) ([]byte, error) {
+	payload, err := toStruct(event.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := s.descriptor.Fields()
+	msg := dynamicpb.NewMessage(s.descriptor)
+	msg.Set(fields.ByName("id"), protoreflect.ValueOfString(event.ID))
+	msg.Set(fields.ByName("type"), protoreflect.ValueOfString(event.Type))
+	msg.Set(fields.ByName("timestamp"), protoreflect.ValueOfMessage(timestamppb.New(event.Timestamp).ProtoReflect()))
+	msg.Set(fields.ByName("payload"), protoreflect.ValueOfMessage(payload.ProtoReflect()))
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode protobuf event: %w", err)
+	}
+	return frame(s.id, firstMessageIndex, data), nil
+}
+
+// toStruct goes through JSON so that any payload the JSON serializer accepts,
+// such as []string values, also converts to a google.protobuf.Struct.
+func toStruct(payload map[string]interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("failed to normalise payload: %w", err)
+	}
+	result, err := structpb.NewStruct(generic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert payload: %w", err)
+	}
+	return result, nil
+}
+
+func eventDescriptor() (protoreflect.MessageDescriptor, error) {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    optional,
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("ingestor/v1/event.proto"),
+		Package: proto.String("ingestor.v1"),
+		Syntax:  proto.String("proto3"),
+		Dependency: []string{
+			"google/protobuf/struct.proto",
+			"google/protobuf/timestamp.proto",
+		},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("type", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("timestamp", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				field("payload", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Struct"),
+			},
+		}},
+	}
+
+	// Importing structpb and timestamppb registers their files globally,
+	// which is what resolves the two dependencies above.
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build event descriptor: %w", err)
+	}
+	return fd.Messages().ByName("Event"), nil
+}
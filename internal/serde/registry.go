@@ -0,0 +1,310 @@
+package serde
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+type SchemaType string
+
+const (
+	SchemaTypeAvro     SchemaType = "AVRO"
+	SchemaTypeProtobuf SchemaType = "PROTOBUF"
+)
+
+type Schema struct {
+	Type       SchemaType
+	Definition string
+}
+
+var ErrIncompatibleSchema = errors.New("schema is incompatible with the latest registered version")
+
+// Registry stores schemas by subject and hands out the IDs embedded in the
+// wire format.
+type Registry interface {
+	// Register returns the ID of schema under subject, adding it as a new
+	// version when it is not registered yet.
+	Register(ctx context.Context, subject string, schema Schema) (int, error)
+	// CheckCompatibility returns ErrIncompatibleSchema when schema cannot
+	// replace the latest version of subject. Unknown subjects are compatible.
+	CheckCompatibility(ctx context.Context, subject string, schema Schema) error
+}
+
+// registerSchema is run once per serializer at startup so that an
+// incompatible schema stops the service before anything is published.
+func registerSchema(ctx context.Context, registry Registry, subject string, schema Schema) (int, error) {
+	if err := registry.CheckCompatibility(ctx, subject, schema); err != nil {
+		return 0, fmt.Errorf("subject %s: %w", subject, err)
+	}
+	id, err := registry.Register(ctx, subject, schema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register schema for subject %s: %w", subject, err)
+	}
+	return id, nil
+}
+
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// HTTPRegistry talks to a Confluent compatible schema registry REST API.
+// Registered IDs are cached, so each schema costs one round trip per process.
+type HTTPRegistry struct {
+	baseURL string
+	client  *http.Client
+	mu      sync.RWMutex
+	ids     map[string]int
+}
+
+func NewHTTPRegistry(baseURL string, client *http.Client) *HTTPRegistry {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPRegistry{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+		ids:     make(map[string]int),
+	}
+}
+
+type registryRequest struct {
+	Schema     string     `json:"schema"`
+	SchemaType SchemaType `json:"schemaType,omitempty"`
+}
+
+type registryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// errSubjectNotFound and errVersionNotFound are the registry error codes for
+// a subject without any version yet.
+const (
+	errSubjectNotFound = 40401
+	errVersionNotFound = 40402
+)
+
+func (r *HTTPRegistry) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	key := subject + "\x00" + schema.Definition
+	r.mu.RLock()
+	id, ok := r.ids[key]
+	r.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := r.post(ctx, path, newRegistryRequest(schema), &resp); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	r.ids[key] = resp.ID
+	r.mu.Unlock()
+	return resp.ID, nil
+}
+
+func (r *HTTPRegistry) CheckCompatibility(ctx context.Context, subject string, schema Schema) error {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest"
+	err := r.post(ctx, path, newRegistryRequest(schema), &resp)
+
+	var regErr *registryError
+	if errors.As(err, &regErr) && (regErr.ErrorCode == errSubjectNotFound || regErr.ErrorCode == errVersionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.IsCompatible {
+		return ErrIncompatibleSchema
+	}
+	return nil
+}
+
+func newRegistryRequest(schema Schema) registryRequest {
+	req := registryRequest{Schema: schema.Definition}
+	// AVRO is the registry default and is omitted for older registries.
+	if schema.Type != SchemaTypeAvro {
+		req.SchemaType = schema.Type
+	}
+	return req
+}
+
+func (r *HTTPRegistry) post(ctx context.Context, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", registryContentType)
+	req.Header.Set("Accept", registryContentType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read schema registry response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		regErr := &registryError{}
+		if json.Unmarshal(data, regErr) != nil || regErr.ErrorCode == 0 {
+			regErr.ErrorCode = resp.StatusCode
+			regErr.Message = strings.TrimSpace(string(data))
+		}
+		return regErr
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode schema registry response: %w", err)
+	}
+	return nil
+}
+
+func (e *registryError) Error() string {
+	return fmt.Sprintf("schema registry error %d: %s", e.ErrorCode, e.Message)
+}
+
+// FileRegistry keeps schemas in a local JSON file, for development and for
+// deployments without a registry service. Avro schemas are checked for
+// backward compatibility; other types must match the latest version exactly.
+type FileRegistry struct {
+	path string
+	mu   sync.Mutex
+}
+
+type fileRegistryEntry struct {
+	ID         int        `json:"id"`
+	Subject    string     `json:"subject"`
+	Version    int        `json:"version"`
+	SchemaType SchemaType `json:"schemaType"`
+	Schema     string     `json:"schema"`
+}
+
+type fileRegistryState struct {
+	Schemas []fileRegistryEntry `json:"schemas"`
+}
+
+func NewFileRegistry(path string) *FileRegistry {
+	return &FileRegistry{path: path}
+}
+
+func (r *FileRegistry) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, err := r.load()
+	if err != nil {
+		return 0, err
+	}
+
+	nextID, version := 1, 1
+	for _, entry := range state.Schemas {
+		if entry.Subject == subject && entry.Schema == schema.Definition {
+			return entry.ID, nil
+		}
+		nextID = max(nextID, entry.ID+1)
+		if entry.Subject == subject {
+			version = max(version, entry.Version+1)
+		}
+	}
+
+	state.Schemas = append(state.Schemas, fileRegistryEntry{
+		ID:         nextID,
+		Subject:    subject,
+		Version:    version,
+		SchemaType: schema.Type,
+		Schema:     schema.Definition,
+	})
+	if err := r.save(state); err != nil {
+		return 0, err
+	}
+	return nextID, nil
+}
+
+func (r *FileRegistry) CheckCompatibility(ctx context.Context, subject string, schema Schema) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	var latest *fileRegistryEntry
+	for i := range state.Schemas {
+		entry := &state.Schemas[i]
+		if entry.Subject == subject && (latest == nil || entry.Version > latest.Version) {
+			latest = entry
+		}
+	}
+	if latest == nil || latest.Schema == schema.Definition {
+		return nil
+	}
+	if latest.SchemaType != schema.Type || schema.Type != SchemaTypeAvro {
+		return ErrIncompatibleSchema
+	}
+
+	writer, err := avro.ParseWithCache(latest.Schema, "", &avro.SchemaCache{})
+	if err != nil {
+		return fmt.Errorf("failed to parse registered schema %d: %w", latest.ID, err)
+	}
+	reader, err := avro.ParseWithCache(schema.Definition, "", &avro.SchemaCache{})
+	if err != nil {
+		return fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if err := avro.NewSchemaCompatibility().Compatible(reader, writer); err != nil {
+		return fmt.Errorf("%w: %v", ErrIncompatibleSchema, err)
+	}
+	return nil
+}
+
+func (r *FileRegistry) load() (*fileRegistryState, error) {
+	state := &fileRegistryState{}
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema registry file: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode schema registry file: %w", err)
+	}
+	return state, nil
+}
+
+func (r *FileRegistry) save(state *fileRegistryState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema registry file: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write schema registry file: %w", err)
+	}
+	return os.Rename(tmp, r.path)
+}
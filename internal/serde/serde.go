@@ -0,0 +1,76 @@
+package serde
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+)
+
+// Serializer turns an event into the value of a Kafka message.
+type Serializer interface {
+	Serialize(event model.Event) ([]byte, error)
+}
+
+const (
+	FormatJSON     = "json"
+	FormatAvro     = "avro"
+	FormatProtobuf = "protobuf"
+)
+
+// wireMagicByte prefixes every message framed in the Confluent wire format.
+const wireMagicByte = 0
+
+// JSONSerializer encodes events as plain JSON without any schema prefix,
+// which is what consumers of the events topic have always received.
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(event model.Event) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return payload, nil
+}
+
+// frame builds a Confluent wire format message: magic byte, big-endian
+// schema ID, optional Protobuf message indexes and the encoded payload.
+func frame(id int, indexes []byte, payload []byte) []byte {
+	buf := make([]byte, 5, 5+len(indexes)+len(payload))
+	buf[0] = wireMagicByte
+	binary.BigEndian.PutUint32(buf[1:5], uint32(id))
+	buf = append(buf, indexes...)
+	return append(buf, payload...)
+}
+
+// SubjectForTopic returns the registry subject of a topic value following
+// the default TopicNameStrategy.
+func SubjectForTopic(topic string) string {
+	return topic + "-value"
+}
+
+// New builds the serializer for format. Schema based formats register their
+// schema for subject and check its compatibility, so they need a registry.
+// avroSchema overrides EventAvroSchema when not empty.
+func New(ctx context.Context, format string, registry Registry, subject, avroSchema string) (Serializer, error) {
+	switch format {
+	case "", FormatJSON:
+		return JSONSerializer{}, nil
+	case FormatAvro, FormatProtobuf:
+		if registry == nil {
+			return nil, fmt.Errorf("serializer %s requires a schema registry", format)
+		}
+	default:
+		return nil, fmt.Errorf("unknown serializer %q", format)
+	}
+
+	if format == FormatProtobuf {
+		return NewProtobufSerializer(ctx, registry, subject)
+	}
+	if avroSchema == "" {
+		avroSchema = EventAvroSchema
+	}
+	return NewAvroSerializer(ctx, registry, subject, avroSchema)
+}
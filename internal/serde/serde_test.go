@@ -0,0 +1,167 @@
+package serde_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/serde"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var testEvent = model.Event{
+	ID:        "evt-1",
+	Type:      "order_created",
+	Timestamp: time.Date(2025, 1, 31, 22, 10, 0, 0, time.UTC),
+	Payload:   map[string]interface{}{"sku": "A-1", "qty": 2},
+}
+
+func TestAvroSerializer_WireFormat(t *testing.T) {
+	registry := serde.NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+
+	s, err := serde.NewAvroSerializer(context.Background(), registry, "events-value", serde.EventAvroSchema)
+	require.NoError(t, err)
+
+	data, err := s.Serialize(testEvent)
+	require.NoError(t, err)
+
+	require.Equal(t, byte(0), data[0])
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(data[1:5]))
+
+	var decoded struct {
+		ID        string    `avro:"id"`
+		Type      string    `avro:"type"`
+		Timestamp time.Time `avro:"timestamp"`
+		Payload   string    `avro:"payload"`
+	}
+	require.NoError(t, avro.Unmarshal(avro.MustParse(serde.EventAvroSchema), data[5:], &decoded))
+	assert.Equal(t, testEvent.ID, decoded.ID)
+	assert.True(t, testEvent.Timestamp.Equal(decoded.Timestamp))
+	assert.JSONEq(t, `{"sku":"A-1","qty":2}`, decoded.Payload)
+}
+
+func TestProtobufSerializer_WireFormat(t *testing.T) {
+	registry := serde.NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+
+	s, err := serde.NewProtobufSerializer(context.Background(), registry, "events-value")
+	require.NoError(t, err)
+
+	data, err := s.Serialize(testEvent)
+	require.NoError(t, err)
+
+	require.Equal(t, byte(0), data[0])
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(data[1:5]))
+	require.Equal(t, byte(0), data[5], "message index of the first message")
+
+	// Field 4 (payload) is a google.protobuf.Struct; decode it on its own to
+	// check the conversion without depending on generated Event code.
+	var payload structpb.Struct
+	raw := data[6:]
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		require.Positive(t, n)
+		raw = raw[n:]
+		if num == 4 && typ == protowire.BytesType {
+			value, m := protowire.ConsumeBytes(raw)
+			require.NoError(t, proto.Unmarshal(value, &payload))
+			raw = raw[m:]
+			continue
+		}
+		m := protowire.ConsumeFieldValue(num, typ, raw)
+		require.Positive(t, m)
+		raw = raw[m:]
+	}
+	assert.Equal(t, "A-1", payload.Fields["sku"].GetStringValue())
+	assert.Equal(t, float64(2), payload.Fields["qty"].GetNumberValue())
+}
+
+func TestFileRegistry_Compatibility(t *testing.T) {
+	ctx := context.Background()
+	registry := serde.NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+
+	_, err := serde.NewAvroSerializer(ctx, registry, "events-value", serde.EventAvroSchema)
+	require.NoError(t, err)
+
+	// Adding a field with a default keeps old data readable.
+	compatible := `{"type":"record","name":"Event","namespace":"ingestor.v1","fields":[
+		{"name":"id","type":"string"},
+		{"name":"type","type":"string"},
+		{"name":"timestamp","type":{"type":"long","logicalType":"timestamp-millis"}},
+		{"name":"payload","type":"string"},
+		{"name":"source","type":"string","default":"http"}]}`
+	s, err := serde.NewAvroSerializer(ctx, registry, "events-value", compatible)
+	require.NoError(t, err)
+	data, err := s.Serialize(testEvent)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), binary.BigEndian.Uint32(data[1:5]))
+
+	// Adding a field without a default cannot read what was written before.
+	incompatible := `{"type":"record","name":"Event","namespace":"ingestor.v1","fields":[
+		{"name":"id","type":"string"},
+		{"name":"type","type":"string"},
+		{"name":"timestamp","type":{"type":"long","logicalType":"timestamp-millis"}},
+		{"name":"payload","type":"string"},
+		{"name":"source","type":"string"},
+		{"name":"tenant","type":"string"}]}`
+	_, err = serde.NewAvroSerializer(ctx, registry, "events-value", incompatible)
+	assert.ErrorIs(t, err, serde.ErrIncompatibleSchema)
+}
+
+func TestHTTPRegistry_RegisterAndCache(t *testing.T) {
+	var registrations, checks int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/vnd.schemaregistry.v1+json", r.Header.Get("Content-Type"))
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "PROTOBUF", body["schemaType"])
+
+		switch r.URL.Path {
+		case "/compatibility/subjects/events-value/versions/latest":
+			checks++
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject 'events-value' not found."}`))
+		case "/subjects/events-value/versions":
+			registrations++
+			_, _ = w.Write([]byte(`{"id":42}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	registry := serde.NewHTTPRegistry(srv.URL, srv.Client())
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		s, err := serde.NewProtobufSerializer(ctx, registry, "events-value")
+		require.NoError(t, err)
+		data, err := s.Serialize(testEvent)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(42), binary.BigEndian.Uint32(data[1:5]))
+	}
+
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, 1, registrations, "registered IDs are cached")
+}
+
+func TestHTTPRegistry_Incompatible(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"is_compatible":false}`))
+	}))
+	defer srv.Close()
+
+	_, err := serde.NewAvroSerializer(context.Background(), serde.NewHTTPRegistry(srv.URL, nil), "events-value", serde.EventAvroSchema)
+	assert.ErrorIs(t, err, serde.ErrIncompatibleSchema)
+}
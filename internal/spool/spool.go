@@ -0,0 +1,368 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/tracing"
+)
+
+var ErrSpoolFull = errors.New("spool is full")
+
+const (
+	segmentPrefix = "segment-"
+	// corruptName is the file undecodable lines are moved to, for inspection.
+	corruptName = "corrupt.jsonl"
+)
+
+// record is one spooled line. The trace context is kept with the event so a
+// replayed event still carries the trace of the request that produced it.
+// Key and Headers are not part of the event JSON and are stored alongside.
+type record struct {
+	Event   model.Event           `json:"event"`
+	Key     string                `json:"key,omitempty"`
+	Headers map[string]string     `json:"headers,omitempty"`
+	Trace   *tracing.TraceContext `json:"trace,omitempty"`
+}
+
+// Spool is a local disk buffer of events, stored as JSON lines in numbered
+// segment files. Appends go to the newest segment; Drain replays segments
+// oldest first and deletes them once every event was handed off.
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	current *os.File
+	seq     int
+	size    int64
+	count   int
+	corrupt int
+	drainMu sync.Mutex
+}
+
+// Open opens the spool in dir, creating it when needed. Segments left by a
+// previous process are kept and drained with the new ones. maxBytes bounds
+// the spool size on disk; zero means unbounded.
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes}
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(segment.path)
+		if err != nil {
+			return nil, err
+		}
+		s.size += info.Size()
+		s.seq = max(s.seq, segment.seq)
+
+		lines, err := countLines(segment.path)
+		if err != nil {
+			return nil, err
+		}
+		s.count += lines
+	}
+	return s, nil
+}
+
+// Append durably adds an event to the spool, along with the trace context
+// carried by ctx.
+func (s *Spool) Append(ctx context.Context, event model.Event) error {
+	rec := record{Event: event, Key: event.Key, Headers: event.Headers}
+	if tc, ok := tracing.FromContext(ctx); ok {
+		rec.Trace = &tc
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spooled event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxBytes > 0 && s.size+int64(len(line)) > s.maxBytes {
+		return ErrSpoolFull
+	}
+
+	if s.current == nil {
+		s.seq++
+		f, err := os.OpenFile(s.segmentPath(s.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open spool segment: %w", err)
+		}
+		s.current = f
+	}
+
+	if _, err := s.current.Write(line); err != nil {
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	if err := s.current.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+
+	s.size += int64(len(line))
+	s.count++
+	return nil
+}
+
+// Len returns the number of events waiting in the spool.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Corrupt returns the number of undecodable lines Drain moved to the
+// corrupt.jsonl file of the spool since Open, such as the tail of a
+// segment being written when the process crashed.
+func (s *Spool) Corrupt() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.corrupt
+}
+
+// Drain hands every spooled event to publish in order, with its trace
+// context attached to the context passed to publish. Undecodable lines are
+// moved aside, see Corrupt, and do not stop the drain. When publish fails,
+// the failed event and everything after it stay in the spool and the error
+// is returned with the number of events drained so far. Appends may carry on
+// while draining; they land in a new segment.
+func (s *Spool) Drain(ctx context.Context, publish func(context.Context, model.Event) error) (int, error) {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	s.mu.Lock()
+	err := s.rotate()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	drained := 0
+	for _, segment := range segments {
+		if s.isCurrent(segment.seq) {
+			break
+		}
+		n, err := s.drainSegment(ctx, segment.path, publish)
+		drained += n
+		if err != nil {
+			return drained, err
+		}
+	}
+	return drained, nil
+}
+
+func (s *Spool) drainSegment(ctx context.Context, path string, publish func(context.Context, model.Event) error) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spool segment: %w", err)
+	}
+	defer f.Close()
+
+	// offset is where the lines not handled yet start; consumed counts the
+	// lines before it, drained the ones of them that were published.
+	var offset int64
+	drained, consumed := 0, 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return drained, s.keep(path, offset, consumed, fmt.Errorf("failed to read spool segment: %w", err))
+		}
+		if len(line) == 0 {
+			break
+		}
+
+		if trimmed := bytes.TrimSuffix(line, []byte("\n")); len(trimmed) > 0 {
+			var rec record
+			if err := json.Unmarshal(trimmed, &rec); err != nil {
+				if err := s.moveCorrupt(trimmed); err != nil {
+					return drained, s.keep(path, offset, consumed, err)
+				}
+			} else {
+				if err := ctx.Err(); err != nil {
+					return drained, s.keep(path, offset, consumed, err)
+				}
+				rec.Event.Key, rec.Event.Headers = rec.Key, rec.Headers
+				eventCtx := ctx
+				if rec.Trace != nil {
+					eventCtx = tracing.ContextWith(ctx, *rec.Trace)
+				}
+				if err := publish(eventCtx, rec.Event); err != nil {
+					return drained, s.keep(path, offset, consumed, err)
+				}
+				drained++
+			}
+			consumed++
+		}
+		offset += int64(len(line))
+	}
+
+	s.mu.Lock()
+	s.size -= offset
+	s.count -= consumed
+	s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil {
+		return drained, fmt.Errorf("failed to remove drained spool segment: %w", err)
+	}
+	return drained, nil
+}
+
+// moveCorrupt appends an undecodable line to the corrupt file.
+func (s *Spool) moveCorrupt(line []byte) error {
+	f, err := os.OpenFile(filepath.Join(s.dir, corruptName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open corrupt spool file: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write corrupt spool file: %w", err)
+	}
+
+	s.mu.Lock()
+	s.corrupt++
+	s.mu.Unlock()
+	return nil
+}
+
+// keep rewrites a partially drained segment with the lines from offset on,
+// which were not handled, and returns cause.
+func (s *Spool) keep(path string, offset int64, consumed int, cause error) error {
+	tmp := path + ".tmp"
+	if err := copyFrom(path, tmp, offset); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to rewrite spool segment: %w", err))
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to rewrite spool segment: %w", err))
+	}
+
+	s.mu.Lock()
+	s.size -= offset
+	s.count -= consumed
+	s.mu.Unlock()
+	return cause
+}
+
+// copyFrom writes the content of src from offset on to dst.
+func copyFrom(src, dst string, offset int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if _, err := in.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// rotate closes the segment being appended to so it can be drained.
+func (s *Spool) rotate() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	if err != nil {
+		return fmt.Errorf("failed to close spool segment: %w", err)
+	}
+	return nil
+}
+
+func (s *Spool) isCurrent(seq int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current != nil && seq == s.seq
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotate()
+}
+
+type segment struct {
+	seq  int
+	path string
+}
+
+func (s *Spool) segments() ([]segment, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool directory: %w", err)
+	}
+
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || filepath.Ext(name) != ".jsonl" {
+			continue
+		}
+		var seq int
+		if _, err := fmt.Sscanf(name, segmentPrefix+"%d.jsonl", &seq); err != nil {
+			continue
+		}
+		segments = append(segments, segment{seq: seq, path: filepath.Join(s.dir, name)})
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments, nil
+}
+
+func (s *Spool) segmentPath(seq int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%012d.jsonl", segmentPrefix, seq))
+}
+
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines++
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,127 @@
+package spool_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/spool"
+	"github.com/raphaelreis/go-event-ingestor/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool_DrainResumesAfterFailure(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := spool.Open(dir, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sp.Append(context.Background(), model.Event{ID: fmt.Sprintf("evt-%d", i)}))
+	}
+
+	var published []string
+	failAt := "evt-3"
+	publish := func(ctx context.Context, event model.Event) error {
+		if event.ID == failAt {
+			return errors.New("kafka unavailable")
+		}
+		published = append(published, event.ID)
+		return nil
+	}
+
+	drained, err := sp.Drain(context.Background(), publish)
+	assert.Error(t, err)
+	assert.Equal(t, 3, drained)
+	assert.Equal(t, 2, sp.Len())
+
+	require.NoError(t, sp.Append(context.Background(), model.Event{ID: "evt-5"}))
+	require.NoError(t, sp.Close())
+
+	// A new process picks up what is left, oldest first.
+	reopened, err := spool.Open(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, reopened.Len())
+
+	failAt = ""
+	drained, err = reopened.Drain(context.Background(), publish)
+	require.NoError(t, err)
+	assert.Equal(t, 3, drained)
+	assert.Equal(t, 0, reopened.Len())
+	assert.Equal(t, []string{"evt-0", "evt-1", "evt-2", "evt-3", "evt-4", "evt-5"}, published)
+}
+
+func TestSpool_KeepsTraceContextAndHeaders(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	trace := tracing.New()
+	trace.Baggage = "tenant=acme"
+	event := model.Event{ID: "evt-1", Key: "customer-1", Headers: map[string]string{"ingest_job_id": "job-1"}}
+	require.NoError(t, sp.Append(tracing.ContextWith(context.Background(), trace), event))
+
+	var (
+		replayed      tracing.TraceContext
+		replayedEvent model.Event
+	)
+	_, err = sp.Drain(context.Background(), func(ctx context.Context, e model.Event) error {
+		replayed, _ = tracing.FromContext(ctx)
+		replayedEvent = e
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, trace, replayed)
+	assert.Equal(t, event.Key, replayedEvent.Key)
+	assert.Equal(t, event.Headers, replayedEvent.Headers)
+}
+
+func TestSpool_MaxBytes(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), 100)
+	require.NoError(t, err)
+
+	require.NoError(t, sp.Append(context.Background(), model.Event{ID: "a"}))
+	assert.ErrorIs(t, sp.Append(context.Background(), model.Event{ID: "b"}), spool.ErrSpoolFull)
+}
+
+func TestSpool_MovesTruncatedTailAside(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := spool.Open(dir, 0)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sp.Append(context.Background(), model.Event{ID: fmt.Sprintf("evt-%d", i)}))
+	}
+	require.NoError(t, sp.Close())
+
+	// The process crashed while appending the next event.
+	segments, err := filepath.Glob(filepath.Join(dir, "segment-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"event":{"id":"evt-`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := spool.Open(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Append(context.Background(), model.Event{ID: "evt-2"}))
+
+	var published []string
+	drained, err := reopened.Drain(context.Background(), func(ctx context.Context, event model.Event) error {
+		published = append(published, event.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, drained)
+	assert.Equal(t, []string{"evt-0", "evt-1", "evt-2"}, published)
+	assert.Equal(t, 0, reopened.Len())
+	assert.Equal(t, 1, reopened.Corrupt())
+
+	corrupt, err := os.ReadFile(filepath.Join(dir, "corrupt.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"event":{"id":"evt-`+"\n", string(corrupt))
+}
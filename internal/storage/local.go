@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+// LocalSource reads files from the local filesystem. The ingestion state of
+// each file is kept in a sidecar file next to it.
+type LocalSource struct {
+	root string
+}
+
+// NewLocalSource serves paths relative to root; they cannot escape it. An
+// empty root uses paths as given.
+func NewLocalSource(root string) *LocalSource {
+	return &LocalSource{root: root}
+}
+
+func (s *LocalSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	f, err := os.Open(s.resolve(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return f, nil
+}
+
+// Checkpoint records offset along with the size and modification time of
+// the file, so that the offset is discarded once the file is replaced.
+func (s *LocalSource) Checkpoint(ctx context.Context, path string, offset csv.Offset) error {
+	version, err := s.version(path)
+	if err != nil {
+		return err
+	}
+	return s.writeState(path, fileState{Offset: offset, Version: version})
+}
+
+// ResumeOffset returns the offset to resume path from; a completed file or
+// one changed since its last checkpoint starts over.
+func (s *LocalSource) ResumeOffset(ctx context.Context, path string) (csv.Offset, error) {
+	return resumeOffset(path, s.readState, s.version)
+}
+
+func (s *LocalSource) MarkCompleted(ctx context.Context, path string) error {
+	state, err := s.readState(path)
+	if err != nil {
+		return err
+	}
+	state.Completed = true
+	return s.writeState(path, state)
+}
+
+// Completed reports whether the file was marked completed.
+func (s *LocalSource) Completed(ctx context.Context, path string) (bool, error) {
+	state, err := s.readState(path)
+	return state.Completed, err
+}
+
+// Size returns the size of the file in bytes.
+func (s *LocalSource) Size(ctx context.Context, path string) (int64, error) {
+	info, err := os.Stat(s.resolve(path))
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// List returns the paths of the files below prefix, sidecars excluded.
+func (s *LocalSource) List(ctx context.Context, prefix string) ([]string, error) {
+	base := s.resolve(prefix)
+	var paths []string
+	err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isSidecar(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(filepath.Join(prefix, rel)))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	return paths, nil
+}
+
+func (s *LocalSource) version(path string) (fileVersion, error) {
+	info, err := os.Stat(s.resolve(objectPath(path)))
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return fileVersion{Size: info.Size(), ModTime: info.ModTime().UTC()}, nil
+}
+
+func (s *LocalSource) resolve(path string) string {
+	if s.root == "" {
+		return path
+	}
+	return filepath.Join(s.root, filepath.Clean(string(filepath.Separator)+path))
+}
+
+func (s *LocalSource) readState(path string) (fileState, error) {
+	var state fileState
+	data, err := os.ReadFile(s.resolve(sidecar(path, stateSuffix)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return state, nil
+}
+
+// writeState replaces the sidecar atomically, so a crash never leaves a
+// truncated checkpoint behind.
+func (s *LocalSource) writeState(path string, state fileState) error {
+	state.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	return writeFileAtomic(s.resolve(sidecar(path, stateSuffix)), data)
+}
+
+// Quarantine appends the rows of path that are not published to a sidecar
+// file, and keeps the report of the last run in another one.
+func (s *LocalSource) Quarantine(ctx context.Context, path string) (*Quarantine, error) {
+	f, err := os.OpenFile(s.resolve(sidecar(path, quarantineSuffix)), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open quarantine file: %w", err)
+	}
+	return newQuarantine(f, func(ctx context.Context, data []byte) error {
+		return writeFileAtomic(s.resolve(sidecar(path, reportSuffix)), data)
+	}), nil
+}
+
+func writeFileAtomic(target string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", target, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package storage_test
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingProducer struct {
+	events []model.Event
+}
+
+func (r *recordingProducer) Publish(ctx context.Context, event model.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recordingProducer) Close() error { return nil }
+
+func TestLocalSource_Resume(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "orders"), 0o755))
+	content := "id,sku\n1,A\n2,B\n3,C\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders", "2025-01.csv"), []byte(content), 0o644))
+
+	ctx := context.Background()
+	source := storage.NewLocalSource(dir)
+
+	// Pretend a previous run got through the first two rows.
+	require.NoError(t, source.Checkpoint(ctx, "orders/2025-01.csv", csv.Offset{Bytes: int64(len("id,sku\n1,A\n2,B\n")), Row: 2}))
+
+	producer := &recordingProducer{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{FilePath: "orders/2025-01.csv", WorkerCount: 1, BatchSize: 1}
+	require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(ctx, cfg))
+
+	require.Len(t, producer.events, 1)
+	assert.Equal(t, "C", producer.events[0].Payload["sku"])
+	assert.Equal(t, "3", producer.events[0].Headers[csv.HeaderRowNumber])
+
+	// A completed file is imported from the start again.
+	offset, err := source.ResumeOffset(ctx, "orders/2025-01.csv")
+	require.NoError(t, err)
+	assert.Zero(t, offset)
+
+	size, err := source.Size(ctx, "orders/2025-01.csv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+}
+
+func TestLocalSource_ResumeChangedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "2025-01.csv")
+	require.NoError(t, os.WriteFile(path, []byte("id,sku\n1,A\n2,B\n"), 0o644))
+
+	ctx := context.Background()
+	source := storage.NewLocalSource(dir)
+	resume := csv.Offset{Bytes: int64(len("id,sku\n1,A\n")), Row: 1}
+	require.NoError(t, source.Checkpoint(ctx, "2025-01.csv", resume))
+	offset, err := source.ResumeOffset(ctx, "2025-01.csv")
+	require.NoError(t, err)
+	assert.Equal(t, resume, offset)
+
+	require.NoError(t, os.WriteFile(path, []byte("id,sku\n7,X\n8,Y\n9,Z\n"), 0o644))
+	offset, err = source.ResumeOffset(ctx, "2025-01.csv")
+	require.NoError(t, err)
+	assert.Zero(t, offset, "the offset of another version of the file is discarded")
+}
+
+func TestLocalSource_StaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(filepath.Dir(root), "secret.csv")
+	require.NoError(t, os.WriteFile(outside, []byte("x\n"), 0o644))
+	defer os.Remove(outside)
+
+	_, err := storage.NewLocalSource(root).Open(context.Background(), "../secret.csv")
+	assert.Error(t, err)
+}
+
+func TestLocalSource_Quarantine(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "orders"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders", "2025-01.csv"), []byte("id,sku\n1,A\n2\n"), 0o644))
+
+	ctx := context.Background()
+	source := storage.NewLocalSource(dir)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	// Two runs append to the same quarantine and leave the last report.
+	for range 2 {
+		quarantine, err := source.Quarantine(ctx, "orders/2025-01.csv")
+		require.NoError(t, err)
+		cfg := csv.Config{FilePath: "orders/2025-01.csv", WorkerCount: 1, BatchSize: 1, Rejects: quarantine, Reports: quarantine}
+		require.NoError(t, csv.NewPipeline(source, &recordingProducer{}, logger, metrics.New()).Process(ctx, cfg))
+		require.NoError(t, quarantine.Close())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "orders", "2025-01.csv.ingest-quarantine.jsonl"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var rejection csv.Rejection
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rejection))
+	assert.Equal(t, csv.ReasonMalformed, rejection.Reason)
+	assert.Equal(t, "orders/2025-01.csv", rejection.File)
+	assert.Equal(t, int64(3), rejection.Line)
+
+	data, err = os.ReadFile(filepath.Join(dir, "orders", "2025-01.csv.ingest-report.json"))
+	require.NoError(t, err)
+	var report csv.Report
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, csv.ReportCompleted, report.Status)
+	assert.Equal(t, int64(1), report.RowsMalformed)
+
+	files, err := source.List(ctx, "orders/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders/2025-01.csv"}, files)
+}
+
+func TestLocalSource_ArchiveMembers(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "bundle.zip"))
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for name, content := range map[string]string{"orders.csv": "id,sku\n1,A\n", "2025/refunds.csv": "id,sku\n1,R\n"} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	ctx := context.Background()
+	source := storage.NewLocalSource(dir)
+	producer := &recordingProducer{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{FilePath: "bundle.zip", WorkerCount: 1, BatchSize: 1}
+	require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(ctx, cfg))
+	assert.Len(t, producer.events, 2)
+
+	// The members of a completed archive are imported from the start again,
+	// but keep their offsets once the next import of the archive got to
+	// them, until it completes.
+	member := csv.MemberPath("bundle.zip", "2025/refunds.csv")
+	offset, err := source.ResumeOffset(ctx, member)
+	require.NoError(t, err)
+	assert.Zero(t, offset)
+	resume := csv.Offset{Bytes: int64(len("id,sku\n1,R\n")), Row: 1}
+	require.NoError(t, source.Checkpoint(ctx, member, resume))
+	require.NoError(t, source.MarkCompleted(ctx, member))
+	offset, err = source.ResumeOffset(ctx, member)
+	require.NoError(t, err)
+	assert.Equal(t, resume, offset)
+	assert.FileExists(t, filepath.Join(dir, "bundle.zip!2025%2Frefunds.csv.ingest-state.json"))
+
+	files, err := source.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bundle.zip"}, files)
+}
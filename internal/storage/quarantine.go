@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+// Quarantine keeps what went wrong while ingesting a file next to it: rows
+// that were not published are appended to <file>.ingest-quarantine.jsonl as
+// JSON lines, and the report of each run replaces <file>.ingest-report.json.
+// It is a csv.RejectSink and a csv.ReportSink, and must be closed once the
+// run ended.
+type Quarantine struct {
+	*csv.JSONRejectWriter
+	w           io.WriteCloser
+	writeReport func(ctx context.Context, data []byte) error
+}
+
+func newQuarantine(w io.WriteCloser, writeReport func(ctx context.Context, data []byte) error) *Quarantine {
+	return &Quarantine{JSONRejectWriter: csv.NewJSONRejectWriter(w), w: w, writeReport: writeReport}
+}
+
+func (q *Quarantine) WriteReport(ctx context.Context, r csv.Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	return q.writeReport(ctx, data)
+}
+
+func (q *Quarantine) Close() error {
+	if err := q.w.Close(); err != nil {
+		return fmt.Errorf("failed to close quarantine: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3Source reads objects from an S3-compatible bucket. Paths are object
+// keys. The ingestion state of an object is kept in a sidecar object next to
+// it, and resuming seeks with ranged GETs instead of downloading the object
+// from the start.
+type S3Source struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Source(cfg S3Config) (*S3Source, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return &S3Source{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3Source) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	r := &objectReader{ctx: ctx, core: minio.Core{Client: s.client}, bucket: s.bucket, key: path}
+	// Open eagerly so a missing object fails here rather than on first read.
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Checkpoint records offset along with the ETag of the object, so that the
+// offset is discarded once the object is replaced.
+func (s *S3Source) Checkpoint(ctx context.Context, path string, offset csv.Offset) error {
+	version, err := s.version(ctx, path)
+	if err != nil {
+		return err
+	}
+	return s.writeState(ctx, path, fileState{Offset: offset, Version: version})
+}
+
+// ResumeOffset returns the offset to resume path from; a completed object
+// or one replaced since its last checkpoint starts over.
+func (s *S3Source) ResumeOffset(ctx context.Context, path string) (csv.Offset, error) {
+	return resumeOffset(path,
+		func(path string) (fileState, error) { return s.readState(ctx, path) },
+		func(path string) (fileVersion, error) { return s.version(ctx, path) })
+}
+
+func (s *S3Source) MarkCompleted(ctx context.Context, path string) error {
+	state, err := s.readState(ctx, path)
+	if err != nil {
+		return err
+	}
+	state.Completed = true
+	return s.writeState(ctx, path, state)
+}
+
+// Completed reports whether the object was marked completed.
+func (s *S3Source) Completed(ctx context.Context, path string) (bool, error) {
+	state, err := s.readState(ctx, path)
+	return state.Completed, err
+}
+
+// Size returns the size of the object in bytes.
+func (s *S3Source) Size(ctx context.Context, path string) (int64, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, path, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat object %s: %w", path, err)
+	}
+	return info.Size, nil
+}
+
+// List returns the keys of the objects below prefix, sidecars excluded.
+func (s *S3Source) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, object.Err)
+		}
+		if isSidecar(object.Key) {
+			continue
+		}
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
+// quarantinePartSize bounds the memory buffered by quarantine uploads, whose
+// size is unknown up front.
+const quarantinePartSize = 5 << 20
+
+// Quarantine writes the rows of path that are not published to a sidecar
+// object. Objects cannot be appended to, so the sidecar is rewritten with its
+// previous content followed by the new rows, streamed as they come, and only
+// replaced once the quarantine is closed.
+func (s *S3Source) Quarantine(ctx context.Context, path string) (*Quarantine, error) {
+	key := sidecar(path, quarantineSuffix)
+	previous, _, _, err := minio.Core{Client: s.client}.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("failed to read quarantine object: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	w := &objectWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		var body io.Reader = pr
+		if previous != nil {
+			defer previous.Close()
+			body = io.MultiReader(previous, pr)
+		}
+		// The rows collected so far are uploaded even when the run is
+		// interrupted.
+		_, err := s.client.PutObject(context.WithoutCancel(ctx), s.bucket, key, body, -1,
+			minio.PutObjectOptions{ContentType: "application/x-ndjson", PartSize: quarantinePartSize})
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return newQuarantine(w, func(ctx context.Context, data []byte) error {
+		return s.putObject(ctx, sidecar(path, reportSuffix), data)
+	}), nil
+}
+
+// objectWriter feeds an upload running in the background.
+type objectWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *objectWriter) Close() error {
+	w.pw.Close()
+	if err := <-w.done; err != nil {
+		return fmt.Errorf("failed to upload quarantine object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Source) version(ctx context.Context, path string) (fileVersion, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, objectPath(path), minio.StatObjectOptions{})
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("failed to stat object %s: %w", objectPath(path), err)
+	}
+	return fileVersion{Size: info.Size, ETag: info.ETag}, nil
+}
+
+func (s *S3Source) readState(ctx context.Context, path string) (fileState, error) {
+	var state fileState
+	body, _, _, err := minio.Core{Client: s.client}.GetObject(ctx, s.bucket, sidecar(path, stateSuffix), minio.GetObjectOptions{})
+	if isNotFound(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read state object: %w", err)
+	}
+	defer body.Close()
+
+	if err := json.NewDecoder(body).Decode(&state); err != nil {
+		return state, fmt.Errorf("failed to parse state object: %w", err)
+	}
+	return state, nil
+}
+
+func (s *S3Source) writeState(ctx context.Context, path string, state fileState) error {
+	state.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	return s.putObject(ctx, sidecar(path, stateSuffix), data)
+}
+
+func (s *S3Source) putObject(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("failed to write object %s: %w", key, err)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	resp := minio.ToErrorResponse(err)
+	return resp.StatusCode == http.StatusNotFound || resp.Code == "NoSuchKey"
+}
+
+// objectReader streams an object and seeks by reissuing a ranged GET from
+// the new offset. Every GET after the first is pinned to the ETag first
+// seen, so an object replaced mid-ingestion fails instead of mixing versions.
+type objectReader struct {
+	ctx    context.Context
+	core   minio.Core
+	bucket string
+	key    string
+
+	etag   string
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *objectReader) open() error {
+	opts := minio.GetObjectOptions{}
+	if r.offset > 0 {
+		if err := opts.SetRange(r.offset, 0); err != nil {
+			return err
+		}
+	}
+	if r.etag != "" {
+		if err := opts.SetMatchETag(r.etag); err != nil {
+			return err
+		}
+	}
+
+	body, info, _, err := r.core.GetObject(r.ctx, r.bucket, r.key, opts)
+	if r.offset > 0 && minio.ToErrorResponse(err).StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// Resuming a file that was read to the end.
+		r.body = http.NoBody
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", r.key, err)
+	}
+	if r.etag == "" {
+		r.etag = info.ETag
+	}
+	r.body = body
+	return nil
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek supports io.SeekStart and io.SeekCurrent; the object size is not
+// known up front. Objects are therefore never parsed in chunks, which needs
+// io.SeekEnd and io.ReaderAt.
+func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	default:
+		return 0, errors.New("seek relative to the end is not supported")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative seek offset")
+	}
+	if offset == r.offset {
+		return offset, nil
+	}
+
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *objectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
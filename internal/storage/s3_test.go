@@ -0,0 +1,175 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 serves path-style GET, HEAD and PUT requests for one bucket,
+// honouring open-ended Range headers, and records the ranges it was asked
+// for. ETags are the MD5 of the content.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	ranges  []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data = decodeChunked(data)
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", `"put"`)
+	case http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+		w.Header().Set("Last-Modified", "Fri, 31 Jan 2025 22:10:00 GMT")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code></Error>`))
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+		w.Header().Set("Last-Modified", "Fri, 31 Jan 2025 22:10:00 GMT")
+		if rng := r.Header.Get("Range"); rng != "" {
+			f.ranges = append(f.ranges, rng)
+			start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if start >= len(data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(data[start:])
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeChunked strips the aws-chunked framing minio-go uses for uploads
+// over plain HTTP: "<hex size>;chunk-signature=...\r\n<data>\r\n".
+func decodeChunked(body []byte) []byte {
+	var data []byte
+	for len(body) > 0 {
+		header, rest, ok := strings.Cut(string(body), "\r\n")
+		if !ok {
+			break
+		}
+		sizeHex, _, _ := strings.Cut(header, ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size == 0 {
+			break
+		}
+		data = append(data, rest[:size]...)
+		body = []byte(rest[size+2:])
+	}
+	return data
+}
+
+func newFakeS3Source(t *testing.T, objects map[string][]byte) (*storage.S3Source, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{objects: objects}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	source, err := storage.NewS3Source(storage.S3Config{
+		Endpoint:  u.Host,
+		Region:    "us-east-1",
+		Bucket:    "bucket",
+		AccessKey: "key",
+		SecretKey: "secret",
+	})
+	require.NoError(t, err)
+	return source, fake
+}
+
+func TestS3Source_RangedResume(t *testing.T) {
+	content := "id,sku\n1,A\n2,B\n3,C\n"
+	source, fake := newFakeS3Source(t, map[string][]byte{"orders/2025-01.csv": []byte(content)})
+	ctx := context.Background()
+
+	offset, err := source.ResumeOffset(ctx, "orders/2025-01.csv")
+	require.NoError(t, err)
+	assert.Zero(t, offset)
+
+	resume := csv.Offset{Bytes: int64(len("id,sku\n1,A\n2,B\n")), Row: 2}
+	require.NoError(t, source.Checkpoint(ctx, "orders/2025-01.csv", resume))
+	offset, err = source.ResumeOffset(ctx, "orders/2025-01.csv")
+	require.NoError(t, err)
+	assert.Equal(t, resume, offset)
+
+	rc, err := source.Open(ctx, "orders/2025-01.csv")
+	require.NoError(t, err)
+	defer rc.Close()
+
+	seeker, ok := rc.(io.Seeker)
+	require.True(t, ok, "S3 objects are seekable")
+	_, err = seeker.Seek(resume.Bytes, io.SeekStart)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "3,C\n", string(rest))
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%d-", resume.Bytes)}, fake.ranges)
+
+	// Seeking to the end of a fully read object yields EOF, not an error.
+	_, err = seeker.Seek(int64(len(content)), io.SeekStart)
+	require.NoError(t, err)
+	rest, err = io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+}
+
+func TestS3Source_ResumeReplacedObject(t *testing.T) {
+	source, fake := newFakeS3Source(t, map[string][]byte{"orders/2025-01.csv": []byte("id,sku\n1,A\n2,B\n")})
+	ctx := context.Background()
+
+	resume := csv.Offset{Bytes: int64(len("id,sku\n1,A\n")), Row: 1}
+	require.NoError(t, source.Checkpoint(ctx, "orders/2025-01.csv", resume))
+	fake.mu.Lock()
+	fake.objects["orders/2025-01.csv"] = []byte("id,sku\n1,B\n2,A\n")
+	fake.mu.Unlock()
+
+	offset, err := source.ResumeOffset(ctx, "orders/2025-01.csv")
+	require.NoError(t, err)
+	assert.Zero(t, offset, "the offset of another version of the object is discarded")
+}
+
+func TestS3Source_MissingObject(t *testing.T) {
+	source, _ := newFakeS3Source(t, map[string][]byte{})
+
+	_, err := source.Open(context.Background(), "missing.csv")
+	assert.Error(t, err)
+}
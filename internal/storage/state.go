@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+)
+
+// Sidecars kept next to an ingested file.
+const (
+	// stateSuffix names the sidecar holding the ingestion state of a file.
+	stateSuffix      = ".ingest-state.json"
+	quarantineSuffix = ".ingest-quarantine.jsonl"
+	reportSuffix     = ".ingest-report.json"
+)
+
+// sidecar returns the path of a sidecar of path. The sidecars of archive
+// members sit next to the archive, their member name escaped.
+func sidecar(path, suffix string) string {
+	if archive, member, ok := csv.SplitMemberPath(path); ok {
+		return archive + "!" + url.PathEscape(member) + suffix
+	}
+	return path + suffix
+}
+
+func isSidecar(path string) bool {
+	return strings.HasSuffix(path, stateSuffix) || strings.HasSuffix(path, quarantineSuffix) || strings.HasSuffix(path, reportSuffix)
+}
+
+type fileState struct {
+	Offset    csv.Offset `json:"offset"`
+	Completed bool       `json:"completed"`
+	// Version is the version of the file Offset was reached in.
+	Version   fileVersion `json:"version"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// fileVersion identifies the content of a file by its size and modification
+// time, or by its ETag for objects. The zero fileVersion, that of states
+// written before versions were recorded, matches any.
+type fileVersion struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	ETag    string    `json:"etag,omitempty"`
+}
+
+func (v fileVersion) matches(current fileVersion) bool {
+	return v == fileVersion{} || (v.Size == current.Size && v.ModTime.Equal(current.ModTime) && v.ETag == current.ETag)
+}
+
+// resumeOffset returns the offset to resume path from, reading states with
+// readState and the current version of the file with version, that of
+// their archive for members. A file changed since its last checkpoint is
+// imported from the start again, and so is a completed one. Members keep
+// their offsets, completed or not, until their archive is completed, so
+// that resuming an archive skips the members already imported.
+func resumeOffset(path string, readState func(path string) (fileState, error), version func(path string) (fileVersion, error)) (csv.Offset, error) {
+	state, err := readState(path)
+	if err != nil {
+		return csv.Offset{}, err
+	}
+	if state.Version != (fileVersion{}) {
+		current, err := version(path)
+		if err != nil {
+			return csv.Offset{}, err
+		}
+		if !state.Version.matches(current) {
+			return csv.Offset{}, nil
+		}
+	}
+
+	archive, _, ok := csv.SplitMemberPath(path)
+	if !ok {
+		if state.Completed {
+			return csv.Offset{}, nil
+		}
+		return state.Offset, nil
+	}
+	archived, err := readState(archive)
+	if err != nil {
+		return csv.Offset{}, err
+	}
+	if archived.Completed && !state.UpdatedAt.After(archived.UpdatedAt) {
+		return csv.Offset{}, nil
+	}
+	return state.Offset, nil
+}
+
+// objectPath returns the path of the file holding path, the archive of
+// members.
+func objectPath(path string) string {
+	if archive, _, ok := csv.SplitMemberPath(path); ok {
+		return archive
+	}
+	return path
+}
@@ -0,0 +1,169 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context and Baggage header names, used both on HTTP requests and
+// as Kafka record headers.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+	BaggageHeader     = "baggage"
+)
+
+const (
+	traceIDLen      = 32
+	spanIDLen       = 16
+	traceParentLen  = 55
+	supportedFormat = "00"
+	sampledFlags    = "01"
+)
+
+// TraceContext is the propagated part of a W3C trace: the trace ID, the ID of
+// the span the next hop should use as parent, the trace flags and the opaque
+// vendor tracestate and baggage lists.
+type TraceContext struct {
+	TraceID    string `json:"trace_id"`
+	SpanID     string `json:"span_id"`
+	Flags      string `json:"flags"`
+	TraceState string `json:"tracestate,omitempty"`
+	Baggage    string `json:"baggage,omitempty"`
+}
+
+// Extract reads the trace context of an incoming request. When traceparent
+// is missing or malformed a new trace is started and tracestate is dropped,
+// as the spec requires; baggage is kept either way. The returned context
+// has a fresh span ID standing for the ingestor itself.
+func Extract(h http.Header) TraceContext {
+	baggage := strings.Join(h.Values(BaggageHeader), ",")
+
+	parent, ok := ParseTraceParent(h.Get(TraceParentHeader))
+	if !ok {
+		tc := New()
+		tc.Baggage = baggage
+		return tc
+	}
+
+	parent.TraceState = strings.Join(h.Values(TraceStateHeader), ",")
+	parent.Baggage = baggage
+	return parent.Child()
+}
+
+// ParseTraceParent parses a traceparent header value.
+func ParseTraceParent(value string) (TraceContext, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < traceParentLen {
+		return TraceContext{}, false
+	}
+
+	version := value[0:2]
+	if !isHex(version) || version == "ff" {
+		return TraceContext{}, false
+	}
+	// Version 00 has a fixed length; future versions may append fields
+	// after another dash, which are ignored.
+	if version == supportedFormat && len(value) != traceParentLen {
+		return TraceContext{}, false
+	}
+	if len(value) > traceParentLen && value[traceParentLen] != '-' {
+		return TraceContext{}, false
+	}
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return TraceContext{}, false
+	}
+
+	tc := TraceContext{
+		TraceID: value[3:35],
+		SpanID:  value[36:52],
+		Flags:   value[53:55],
+	}
+	if !isHex(tc.TraceID) || isZero(tc.TraceID) ||
+		!isHex(tc.SpanID) || isZero(tc.SpanID) ||
+		!isHex(tc.Flags) {
+		return TraceContext{}, false
+	}
+	return tc, true
+}
+
+// New starts a new sampled trace.
+func New() TraceContext {
+	return TraceContext{
+		TraceID: randomHex(traceIDLen / 2),
+		SpanID:  randomHex(spanIDLen / 2),
+		Flags:   sampledFlags,
+	}
+}
+
+// Child returns the context for a new span in the same trace.
+func (tc TraceContext) Child() TraceContext {
+	tc.SpanID = randomHex(spanIDLen / 2)
+	return tc
+}
+
+// TraceParent formats the traceparent header value.
+func (tc TraceContext) TraceParent() string {
+	return supportedFormat + "-" + tc.TraceID + "-" + tc.SpanID + "-" + tc.Flags
+}
+
+// Headers returns the non-empty propagation headers for tc.
+func (tc TraceContext) Headers() map[string]string {
+	headers := map[string]string{TraceParentHeader: tc.TraceParent()}
+	if tc.TraceState != "" {
+		headers[TraceStateHeader] = tc.TraceState
+	}
+	if tc.Baggage != "" {
+		headers[BaggageHeader] = tc.Baggage
+	}
+	return headers
+}
+
+type contextKey struct{}
+
+func ContextWith(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, tc)
+}
+
+func FromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(contextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// FromContextOrNew returns the trace context carried by ctx, or starts a
+// new trace for events that did not come with one.
+func FromContextOrNew(ctx context.Context) TraceContext {
+	if tc, ok := FromContext(ctx); ok {
+		return tc
+	}
+	return New()
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic("tracing: failed to read random bytes: " + err.Error())
+		}
+		if s := hex.EncodeToString(b); !isZero(s) {
+			return s
+		}
+	}
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
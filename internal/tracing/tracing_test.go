@@ -0,0 +1,64 @@
+package tracing_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"future version with extra fields", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"version 00 with extra fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"forbidden version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"uppercase hex", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"too short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := tracing.ParseTraceParent(tt.value)
+			assert.Equal(t, tt.valid, ok)
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Add("tracestate", "congo=t61rcWkgMzE")
+	h.Add("tracestate", "rojo=00f067aa0ba902b7")
+	h.Set("baggage", "tenant=acme")
+
+	tc := tracing.Extract(h)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+	assert.NotEqual(t, "00f067aa0ba902b7", tc.SpanID, "the ingestor gets its own span")
+	assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", tc.TraceState)
+
+	headers := tc.Headers()
+	_, ok := tracing.ParseTraceParent(headers[tracing.TraceParentHeader])
+	require.True(t, ok)
+	assert.Equal(t, "tenant=acme", headers[tracing.BaggageHeader])
+}
+
+func TestExtract_InvalidParentStartsNewTrace(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "garbage")
+	h.Set("tracestate", "congo=t61rcWkgMzE")
+
+	tc := tracing.Extract(h)
+	_, ok := tracing.ParseTraceParent(tc.TraceParent())
+	assert.True(t, ok)
+	assert.Empty(t, tc.TraceState)
+}
@@ -0,0 +1,103 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	kafkaGo "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tcKafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+)
+
+func TestProducerFailoverIntegration(t *testing.T) {
+	ctx := context.Background()
+
+	kafkaContainer, err := tcKafka.Run(ctx,
+		"confluentinc/cp-kafka:7.6.1",
+		tcKafka.WithClusterID("secondary-cluster"),
+	)
+	require.NoError(t, err)
+	defer func() {
+		if err := kafkaContainer.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate container: %s", err)
+		}
+	}()
+
+	secondary, err := kafkaContainer.Brokers(ctx)
+	require.NoError(t, err)
+
+	topic := "failover-events"
+	dlqTopic := "failover-events-dlq"
+
+	conn, err := kafkaGo.Dial("tcp", secondary[0])
+	require.NoError(t, err)
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	require.NoError(t, err)
+	controllerConn, err := kafkaGo.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	require.NoError(t, err)
+	defer controllerConn.Close()
+
+	err = controllerConn.CreateTopics(
+		kafkaGo.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1},
+		kafkaGo.TopicConfig{Topic: dlqTopic, NumPartitions: 1, ReplicationFactor: 1},
+	)
+	require.NoError(t, err)
+
+	// Nothing listens on the primary address, every write to it fails.
+	mets := metrics.New()
+	producer := kafka.NewProducer(
+		[]string{"127.0.0.1:1"},
+		topic,
+		dlqTopic,
+		2*time.Second,
+		kafka.WithFailover(kafka.FailoverConfig{
+			SecondaryBrokers: secondary,
+			FailureThreshold: 2,
+			ProbeInterval:    time.Hour,
+			Metrics:          mets,
+		}),
+	)
+	defer producer.Close()
+
+	for i := 0; i < 5; i++ {
+		err := producer.Publish(ctx, model.Event{
+			ID:        fmt.Sprintf("evt-%d", i),
+			Type:      "failover",
+			Timestamp: time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(mets.KafkaActiveCluster.WithLabelValues("secondary")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(mets.KafkaActiveCluster.WithLabelValues("primary")))
+
+	reader := kafkaGo.NewReader(kafkaGo.ReaderConfig{
+		Brokers:   secondary,
+		Topic:     topic,
+		Partition: 0,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	ctxRead, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for i := 0; i < 5; i++ {
+		m, err := reader.ReadMessage(ctxRead)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("evt-%d", i), string(m.Key))
+	}
+}
@@ -0,0 +1,67 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tcPostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+func TestPostgresJobStoreIntegration(t *testing.T) {
+	ctx := context.Background()
+
+	pgContainer, err := tcPostgres.Run(ctx,
+		"postgres:16-alpine",
+		tcPostgres.WithDatabase("ingestor"),
+		tcPostgres.WithUsername("ingestor"),
+		tcPostgres.WithPassword("ingestor"),
+		tcPostgres.BasicWaitStrategies(),
+	)
+	require.NoError(t, err)
+	defer func() {
+		if err := pgContainer.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate container: %s", err)
+		}
+	}()
+
+	dsn, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	store, err := jobs.OpenPostgres(ctx, dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	period := jobs.Job{CustomerID: "123", Dataset: "orders", Period: "2025-01", FilePath: "orders.csv"}
+	job, err := store.Create(ctx, period)
+	require.NoError(t, err)
+
+	_, err = store.Create(ctx, period)
+	assert.ErrorIs(t, err, jobs.ErrLocked)
+
+	crashed, err := store.Claim(ctx, job.ID, "pod-a")
+	require.NoError(t, err)
+	require.NoError(t, store.Checkpoint(ctx, crashed, csv.Offset{Bytes: 4096, Row: 100}))
+
+	time.Sleep(50 * time.Millisecond)
+	lease, err := store.ClaimStale(ctx, 10*time.Millisecond, "pod-b")
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, lease.JobID)
+	assert.ErrorIs(t, store.Heartbeat(ctx, crashed), jobs.ErrLeaseLost)
+	require.NoError(t, store.Complete(ctx, lease))
+
+	got, err := store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusCompleted, got.Status)
+	assert.Equal(t, csv.Offset{Bytes: 4096, Row: 100}, got.LastOffset)
+	assert.NotNil(t, got.HeartbeatAt)
+
+	_, err = store.Create(ctx, period)
+	assert.NoError(t, err, "the lock is released once the job completed")
+}
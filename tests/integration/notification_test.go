@@ -0,0 +1,81 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	kafkaGo "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tcKafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+)
+
+func TestNotificationConsumerIntegration(t *testing.T) {
+	ctx := context.Background()
+
+	kafkaContainer, err := tcKafka.Run(ctx,
+		"confluentinc/cp-kafka:7.6.1",
+		tcKafka.WithClusterID("notifications-cluster"),
+	)
+	require.NoError(t, err)
+	defer func() {
+		if err := kafkaContainer.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate container: %s", err)
+		}
+	}()
+
+	brokers, err := kafkaContainer.Brokers(ctx)
+	require.NoError(t, err)
+	topic := "bucket-notifications"
+
+	conn, err := kafkaGo.Dial("tcp", brokers[0])
+	require.NoError(t, err)
+	defer conn.Close()
+	controller, err := conn.Controller()
+	require.NoError(t, err)
+	controllerConn, err := kafkaGo.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	require.NoError(t, err)
+	defer controllerConn.Close()
+	require.NoError(t, controllerConn.CreateTopics(kafkaGo.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}))
+
+	writer := &kafkaGo.Writer{Addr: kafkaGo.TCP(brokers...), Topic: topic}
+	defer writer.Close()
+	require.NoError(t, writer.WriteMessages(ctx,
+		kafkaGo.Message{Value: []byte(`{"EventName":"s3:ObjectCreated:Put","Key":"datasets/a.csv"}`)},
+		kafkaGo.Message{Value: []byte(`{"EventName":"s3:ObjectCreated:Put","Key":"datasets/b.csv"}`)},
+	))
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	runCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// The first message fails once and is handled again before the second.
+	var handled []string
+	failed := false
+	consumer := kafka.NewConsumer(brokers, topic, "ingestor-test", logger)
+	defer consumer.Close()
+	err = consumer.Run(runCtx, func(ctx context.Context, value []byte) error {
+		if !failed {
+			failed = true
+			return errors.New("job store unavailable")
+		}
+		handled = append(handled, string(value))
+		if len(handled) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, handled, 2)
+	assert.Contains(t, handled[0], "a.csv")
+	assert.Contains(t, handled[1], "b.csv")
+}
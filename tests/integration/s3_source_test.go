@@ -0,0 +1,89 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/raphaelreis/go-event-ingestor/internal/ingest/csv"
+	"github.com/raphaelreis/go-event-ingestor/internal/metrics"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	"github.com/raphaelreis/go-event-ingestor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tcMinio "github.com/testcontainers/testcontainers-go/modules/minio"
+)
+
+type collectingProducer struct {
+	events []model.Event
+}
+
+func (c *collectingProducer) Publish(ctx context.Context, event model.Event) error {
+	c.events = append(c.events, event)
+	return nil
+}
+
+func (c *collectingProducer) Close() error { return nil }
+
+func TestS3SourceIntegration(t *testing.T) {
+	ctx := context.Background()
+
+	minioContainer, err := tcMinio.Run(ctx, "minio/minio:RELEASE.2024-01-16T16-07-38Z")
+	require.NoError(t, err)
+	defer func() {
+		if err := minioContainer.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate container: %s", err)
+		}
+	}()
+
+	endpoint, err := minioContainer.ConnectionString(ctx)
+	require.NoError(t, err)
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(minioContainer.Username, minioContainer.Password, ""),
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.MakeBucket(ctx, "datasets", minio.MakeBucketOptions{}))
+
+	lines := []string{"id,sku"}
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("%d,SKU-%d", i, i))
+	}
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	key := "customer_id=123/dataset=orders/year=2025/month=01/orders_2025_01.csv"
+	_, err = client.PutObject(ctx, "datasets", key, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{})
+	require.NoError(t, err)
+
+	source, err := storage.NewS3Source(storage.S3Config{
+		Endpoint:  endpoint,
+		Bucket:    "datasets",
+		AccessKey: minioContainer.Username,
+		SecretKey: minioContainer.Password,
+	})
+	require.NoError(t, err)
+
+	// Resume half way through, as if a previous run crashed after row 50.
+	prefix := strings.Join(lines[:51], "\n") + "\n"
+	require.NoError(t, source.Checkpoint(ctx, key, csv.Offset{Bytes: int64(len(prefix)), Row: 50}))
+
+	producer := &collectingProducer{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := csv.Config{FilePath: key, WorkerCount: 1, BatchSize: 10}
+	require.NoError(t, csv.NewPipeline(source, producer, logger, metrics.New()).Process(ctx, cfg))
+
+	require.Len(t, producer.events, 50)
+	assert.Equal(t, "SKU-51", producer.events[0].Payload["sku"])
+	assert.Equal(t, "SKU-100", producer.events[49].Payload["sku"])
+
+	offset, err := source.ResumeOffset(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, csv.Offset{Bytes: int64(len(content)), Row: 100}, offset)
+}
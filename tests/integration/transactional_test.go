@@ -0,0 +1,146 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/raphaelreis/go-event-ingestor/internal/kafka"
+	"github.com/raphaelreis/go-event-ingestor/internal/model"
+	kafkaGo "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tcKafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func billingEvents(from, to int) []model.Event {
+	events := make([]model.Event, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		events = append(events, model.Event{
+			ID:        fmt.Sprintf("invoice-%d", i),
+			Type:      "billing",
+			Timestamp: time.Now(),
+			Payload:   map[string]interface{}{"row": i},
+		})
+	}
+	return events
+}
+
+func TestTransactionalProducerIntegration(t *testing.T) {
+	ctx := context.Background()
+
+	kafkaContainer, err := tcKafka.Run(ctx,
+		"confluentinc/cp-kafka:7.6.1",
+		tcKafka.WithClusterID("test-cluster"),
+	)
+	require.NoError(t, err)
+	defer func() {
+		if err := kafkaContainer.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate container: %s", err)
+		}
+	}()
+
+	brokers, err := kafkaContainer.Brokers(ctx)
+	require.NoError(t, err)
+
+	topic := "billing"
+	checkpointTopic := "billing-checkpoints"
+	transactionalID := "ingestor-billing"
+
+	conn, err := kafkaGo.Dial("tcp", brokers[0])
+	require.NoError(t, err)
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	require.NoError(t, err)
+	controllerConn, err := kafkaGo.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	require.NoError(t, err)
+	defer controllerConn.Close()
+
+	err = controllerConn.CreateTopics(
+		kafkaGo.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1},
+		// Checkpoints all go to the first partition whatever their key.
+		kafkaGo.TopicConfig{Topic: checkpointTopic, NumPartitions: 3, ReplicationFactor: 1},
+	)
+	require.NoError(t, err)
+
+	first, err := kafka.NewTransactionalProducer(brokers, topic, checkpointTopic, transactionalID, 10*time.Second, nil)
+	require.NoError(t, err)
+
+	err = first.PublishBatch(ctx, kafka.Batch{
+		Events:     billingEvents(1, 3),
+		Checkpoint: kafka.Checkpoint{Source: "invoices.csv", Offset: 3},
+	})
+	require.NoError(t, err)
+	require.NoError(t, first.Close())
+
+	// Simulate the process dying half way through the second batch: records
+	// reach the broker inside a transaction that is never ended.
+	crashed, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.TransactionalID(transactionalID),
+		kgo.DefaultProduceTopic(topic),
+	)
+	require.NoError(t, err)
+	defer crashed.Close()
+
+	require.NoError(t, crashed.BeginTransaction())
+	for _, event := range billingEvents(4, 5) {
+		value, err := json.Marshal(event)
+		require.NoError(t, err)
+		require.NoError(t, crashed.ProduceSync(ctx, &kgo.Record{Key: []byte(event.ID), Value: value}).FirstErr())
+	}
+
+	// The restarted producer fences the crashed one, resumes from the last
+	// committed checkpoint and publishes the second batch again.
+	resumed, err := kafka.NewTransactionalProducer(brokers, topic, checkpointTopic, transactionalID, 10*time.Second, nil)
+	require.NoError(t, err)
+	defer resumed.Close()
+
+	checkpoint, err := resumed.LastCheckpoint(ctx, "invoices.csv")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), checkpoint.Offset)
+
+	err = resumed.PublishBatch(ctx, kafka.Batch{
+		Events:     billingEvents(int(checkpoint.Offset)+1, 6),
+		Checkpoint: kafka.Checkpoint{Source: "invoices.csv", Offset: 6, Completed: true},
+	})
+	require.NoError(t, err)
+	checkpoint, err = resumed.LastCheckpoint(ctx, "invoices.csv")
+	require.NoError(t, err)
+	require.Equal(t, kafka.Checkpoint{Source: "invoices.csv", Offset: 6, Completed: true}, checkpoint)
+
+	reader := kafkaGo.NewReader(kafkaGo.ReaderConfig{
+		Brokers:        brokers,
+		Topic:          topic,
+		Partition:      0,
+		MaxBytes:       10e6,
+		IsolationLevel: kafkaGo.ReadCommitted,
+	})
+	defer reader.Close()
+
+	ctxRead, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var ids []string
+	for len(ids) < 6 {
+		m, err := reader.ReadMessage(ctxRead)
+		require.NoError(t, err)
+		ids = append(ids, string(m.Key))
+	}
+
+	assert.Equal(t, []string{"invoice-1", "invoice-2", "invoice-3", "invoice-4", "invoice-5", "invoice-6"}, ids)
+
+	// Nothing else may follow: the crashed records were aborted.
+	ctxTail, cancelTail := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelTail()
+	_, err = reader.ReadMessage(ctxTail)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}